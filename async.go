@@ -0,0 +1,392 @@
+// +build linux
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MessageIDSubmitterReport is the MESSAGE_ID of entries written by an
+// AsyncSubmitter to report dropped and failed submissions.
+const MessageIDSubmitterReport ID128 = "e9a6b119f765480c88f5acd425c34b71"
+
+const (
+	defaultQueueSize      = 1024
+	defaultReportInterval = time.Minute
+	// Maximum number of entries a worker takes from the queue at once
+	asyncBatchSize = 64
+)
+
+var (
+	// ErrSubmitterClosed is returned when submitting to a closed AsyncSubmitter.
+	ErrSubmitterClosed = errors.New("journal: submitter closed")
+	// ErrQueueFull is returned when an entry is dropped because the queue
+	// is full and the overflow policy is OverflowDropNewest.
+	ErrQueueFull = errors.New("journal: submit queue full")
+)
+
+// OverflowPolicy decides what an AsyncSubmitter does when its queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is room in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued entry to make room
+	OverflowDropOldest
+	// OverflowDropNewest drops the entry being submitted
+	OverflowDropNewest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "Block"
+	case OverflowDropOldest:
+		return "DropOldest"
+	case OverflowDropNewest:
+		return "DropNewest"
+	default:
+		return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+	}
+}
+
+// AsyncConfig configures an AsyncSubmitter
+type AsyncConfig struct {
+	// QueueSize is the maximum number of queued entries. Defaults to 1024.
+	QueueSize int
+	// Workers is the number of goroutines submitting queued entries.
+	// Defaults to 1.
+	Workers int
+	// Overflow decides what happens when the queue is full
+	Overflow OverflowPolicy
+	// ReportInterval is how often dropped and failed submissions are
+	// reported to the journal. Defaults to one minute. A negative value
+	// disables reporting.
+	ReportInterval time.Duration
+	// Submitter receives the queued entries. Defaults to the journal.
+	Submitter Submitter
+}
+
+type asyncEntry struct {
+	priority Priority
+	message  string
+	fields   Fields
+}
+
+// AsyncSubmitter submits entries to the journal from a bounded queue
+// served by one or more worker goroutines. Dropped and failed submissions
+// are counted and periodically reported to the journal as an entry with
+// MESSAGE_ID set to MessageIDSubmitterReport.
+type AsyncSubmitter struct {
+	// Updated atomically and first in the struct to be 64-bit aligned
+	// on 32-bit platforms
+	dropped uint64
+	failed  uint64
+
+	queue     chan asyncEntry
+	overflow  OverflowPolicy
+	submitter Submitter
+
+	// Guards queue against being closed while submitting
+	closeMutex sync.RWMutex
+	closed     bool
+	// Closed by Close to release callers blocked on a full queue
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// Number of queued or in-flight entries and callers waiting
+	// for it to reach zero
+	pendingMutex sync.Mutex
+	pending      int
+	flushed      []chan struct{}
+
+	reportMutex  sync.Mutex
+	lastDropped  uint64
+	lastFailed   uint64
+	stopReport   chan struct{}
+	workersDone  chan struct{}
+	reporterDone chan struct{}
+}
+
+// NewAsyncSubmitter creates an AsyncSubmitter and starts its workers.
+// Call Close to stop it.
+func NewAsyncSubmitter(cfg AsyncConfig) *AsyncSubmitter {
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.ReportInterval == 0 {
+		cfg.ReportInterval = defaultReportInterval
+	}
+	if cfg.Submitter == nil {
+		cfg.Submitter = journalSubmitter{}
+	}
+
+	s := &AsyncSubmitter{
+		queue:        make(chan asyncEntry, cfg.QueueSize),
+		overflow:     cfg.Overflow,
+		submitter:    cfg.Submitter,
+		closing:      make(chan struct{}),
+		stopReport:   make(chan struct{}),
+		workersDone:  make(chan struct{}),
+		reporterDone: make(chan struct{}),
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(s.workersDone)
+	}()
+
+	if cfg.ReportInterval > 0 {
+		go s.reportLoop(cfg.ReportInterval)
+	} else {
+		close(s.reporterDone)
+	}
+
+	return s
+}
+
+// Submit queues a new entry
+func (s *AsyncSubmitter) Submit(p Priority, m string) error {
+	return s.SubmitWithFields(p, m, nil)
+}
+
+// SubmitWithFields queues a new entry with optional fields. The fields
+// are copied, so f may be reused once SubmitWithFields returns.
+// Invalid field names are reported when the entry is submitted and
+// counted as failed submissions.
+func (s *AsyncSubmitter) SubmitWithFields(p Priority, m string, f Fields) error {
+
+	e := asyncEntry{
+		priority: p,
+		message:  m,
+		fields:   make(Fields, len(f)+2),
+	}
+
+	for k, v := range f {
+		e.fields[k] = v
+	}
+
+	s.closeMutex.RLock()
+	defer s.closeMutex.RUnlock()
+
+	if s.closed {
+		return ErrSubmitterClosed
+	}
+
+	s.addPending(1)
+
+	switch s.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- e:
+				return nil
+			default:
+			}
+
+			select {
+			case <-s.queue:
+				atomic.AddUint64(&s.dropped, 1)
+				s.addPending(-1)
+			default:
+			}
+		}
+	case OverflowDropNewest:
+		select {
+		case s.queue <- e:
+			return nil
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			s.addPending(-1)
+			return ErrQueueFull
+		}
+	default:
+		select {
+		case s.queue <- e:
+			return nil
+		case <-s.closing:
+			s.addPending(-1)
+			return ErrSubmitterClosed
+		}
+	}
+}
+
+// Flush waits until all queued entries have been submitted or
+// the context is done.
+func (s *AsyncSubmitter) Flush(ctx context.Context) error {
+
+	s.pendingMutex.Lock()
+	if s.pending == 0 {
+		s.pendingMutex.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	s.flushed = append(s.flushed, ch)
+	s.pendingMutex.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting new entries and waits for the queued ones to be
+// submitted or the context to be done. Callers blocked on a full queue
+// get ErrSubmitterClosed. Dropped and failed submissions not yet reported
+// are reported before Close returns.
+func (s *AsyncSubmitter) Close(ctx context.Context) error {
+
+	first := false
+	s.closeOnce.Do(func() {
+		first = true
+		close(s.closing)
+	})
+
+	if !first {
+		return ErrSubmitterClosed
+	}
+
+	// Blocked callers return once closing is closed, releasing the lock
+	s.closeMutex.Lock()
+	s.closed = true
+	close(s.queue)
+	s.closeMutex.Unlock()
+
+	close(s.stopReport)
+	<-s.reporterDone
+
+	select {
+	case <-s.workersDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return s.report()
+}
+
+// Dropped returns the total number of entries dropped due to a full queue
+func (s *AsyncSubmitter) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Failed returns the total number of entries that failed to be submitted
+func (s *AsyncSubmitter) Failed() uint64 {
+	return atomic.LoadUint64(&s.failed)
+}
+
+func (s *AsyncSubmitter) addPending(n int) {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+
+	s.pending += n
+	if s.pending == 0 {
+		for _, ch := range s.flushed {
+			close(ch)
+		}
+		s.flushed = nil
+	}
+}
+
+func (s *AsyncSubmitter) work() {
+
+	batch := make([]asyncEntry, 0, asyncBatchSize)
+
+	for e := range s.queue {
+		batch = append(batch[:0], e)
+
+	drain:
+		for len(batch) < asyncBatchSize {
+			select {
+			case e, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, e)
+			default:
+				break drain
+			}
+		}
+
+		for _, e := range batch {
+			if err := s.submitter.SubmitWithFields(e.priority, e.message, e.fields); err != nil {
+				atomic.AddUint64(&s.failed, 1)
+			}
+		}
+
+		s.addPending(-len(batch))
+	}
+}
+
+func (s *AsyncSubmitter) reportLoop(interval time.Duration) {
+
+	defer close(s.reporterDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Failing to report is retried on the next tick
+			_ = s.report()
+		case <-s.stopReport:
+			return
+		}
+	}
+}
+
+// report writes dropped and failed submissions since the last
+// report to the journal
+func (s *AsyncSubmitter) report() error {
+
+	s.reportMutex.Lock()
+	defer s.reportMutex.Unlock()
+
+	dropped := atomic.LoadUint64(&s.dropped)
+	failed := atomic.LoadUint64(&s.failed)
+
+	nDropped := dropped - s.lastDropped
+	nFailed := failed - s.lastFailed
+
+	if nDropped == 0 && nFailed == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Asynchronous journal submitter dropped %d and failed to submit %d entries",
+		nDropped, nFailed)
+
+	err := s.submitter.SubmitWithFields(PriorityWarning, msg, Fields{
+		FieldMessageID: MessageIDSubmitterReport.String(),
+		"N_DROPPED":    strconv.FormatUint(nDropped, 10),
+		"N_FAILED":     strconv.FormatUint(nFailed, 10),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to report dropped entries: %w", err)
+	}
+
+	s.lastDropped = dropped
+	s.lastFailed = failed
+
+	return nil
+}
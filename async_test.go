@@ -0,0 +1,134 @@
+// +build linux
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingSubmitter blocks every submission until release is closed
+type blockingSubmitter struct {
+	release chan struct{}
+
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (b *blockingSubmitter) Submit(p Priority, m string) error {
+	return b.SubmitWithFields(p, m, nil)
+}
+
+func (b *blockingSubmitter) SubmitWithFields(p Priority, m string, f Fields) error {
+	<-b.release
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.messages = append(b.messages, m)
+
+	return nil
+}
+
+func TestAsyncSubmitterOverflow(t *testing.T) {
+
+	tests := []struct {
+		policy  OverflowPolicy
+		err     error
+		dropped uint64
+	}{
+		{OverflowDropOldest, nil, 1},
+		{OverflowDropNewest, ErrQueueFull, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			b := &blockingSubmitter{release: make(chan struct{})}
+			s := NewAsyncSubmitter(AsyncConfig{
+				QueueSize:      1,
+				Overflow:       test.policy,
+				ReportInterval: -1,
+				Submitter:      b,
+			})
+
+			// The worker takes the first entry and blocks, the second
+			// fills the queue
+			s.Submit(PriorityInfo, "1")
+			waitFor(t, func() bool { return len(s.queue) == 0 })
+			s.Submit(PriorityInfo, "2")
+
+			if err := s.Submit(PriorityInfo, "3"); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			close(b.release)
+
+			if err := s.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if s.Dropped() != test.dropped {
+				t.Errorf("expected %d dropped, got %d", test.dropped, s.Dropped())
+			}
+		})
+	}
+}
+
+func TestAsyncSubmitterCloseBlocked(t *testing.T) {
+
+	b := &blockingSubmitter{release: make(chan struct{})}
+	s := NewAsyncSubmitter(AsyncConfig{
+		QueueSize: 1,
+		Overflow:  OverflowBlock,
+		Submitter: b,
+	})
+
+	s.Submit(PriorityInfo, "1")
+	waitFor(t, func() bool { return len(s.queue) == 0 })
+	s.Submit(PriorityInfo, "2")
+
+	blocked := make(chan error)
+	go func() {
+		blocked <- s.Submit(PriorityInfo, "3")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := s.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected close to time out, got %v", err)
+	}
+
+	select {
+	case err := <-blocked:
+		if err != ErrSubmitterClosed {
+			t.Fatalf("expected %v, got %v", ErrSubmitterClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("submit still blocked after close")
+	}
+
+	select {
+	case <-s.reporterDone:
+	default:
+		t.Fatal("reporter still running after close")
+	}
+
+	close(b.release)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("condition not met")
+}
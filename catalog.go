@@ -0,0 +1,316 @@
+// +build linux
+
+package journal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CatalogHeader is a header line such as "Subject:" of a catalog entry
+type CatalogHeader struct {
+	Name  string
+	Value string
+}
+
+// CatalogEntry is a single entry of a message catalog (.catalog) file
+type CatalogEntry struct {
+	ID      ID128
+	Locale  string
+	Headers []CatalogHeader
+	Body    string
+}
+
+// Header returns the value of the first header with the given name
+// or an empty string if there is no such header
+func (e *CatalogEntry) Header(name string) string {
+	for _, h := range e.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+
+	return ""
+}
+
+// Text returns the entry in the same form as returned by Catalog and
+// CatalogForMessageID, headers first followed by the body.
+func (e *CatalogEntry) Text() string {
+
+	var b strings.Builder
+
+	for _, h := range e.Headers {
+		b.WriteString(h.Name + ": " + h.Value + "\n")
+	}
+
+	if len(e.Headers) > 0 && e.Body != "" {
+		b.WriteString("\n")
+	}
+
+	b.WriteString(e.Body)
+
+	return b.String()
+}
+
+// Render returns the entry text with every @FIELD@ reference replaced
+// by the value of the field. Like the journal, references to missing
+// fields are replaced by the field name.
+func (e *CatalogEntry) Render(f Fields) string {
+
+	text := e.Text()
+
+	var b strings.Builder
+
+	for {
+		start := strings.IndexByte(text, '@')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(text[start+1:], '@')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		name := text[start+1 : end]
+		if !isCatalogVariable(name) {
+			// Not a reference, keep the first '@' and continue after it
+			b.WriteString(text[:start+1])
+			text = text[start+1:]
+			continue
+		}
+
+		b.WriteString(text[:start])
+		if v, ok := f[name]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(name)
+		}
+
+		text = text[end+1:]
+	}
+
+	b.WriteString(text)
+
+	return b.String()
+}
+
+// Validate checks that the entry can be written to and read back
+// from a catalog file.
+func (e *CatalogEntry) Validate() error {
+
+	if _, err := ParseID128(string(e.ID)); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(e.Locale, " \t\n") {
+		return fmt.Errorf("invalid locale '%s' in catalog entry %s", e.Locale, e.ID)
+	}
+
+	for _, h := range e.Headers {
+		if !isCatalogHeaderName(h.Name) {
+			return fmt.Errorf("invalid header name '%s' in catalog entry %s", h.Name, e.ID)
+		}
+		if strings.Contains(h.Value, "\n") {
+			return fmt.Errorf("header '%s' in catalog entry %s spans multiple lines", h.Name, e.ID)
+		}
+	}
+
+	if len(e.Headers) == 0 && e.Body == "" {
+		return fmt.Errorf("catalog entry %s is empty", e.ID)
+	}
+
+	for _, line := range strings.Split(e.Body, "\n") {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-- ") {
+			return fmt.Errorf("body of catalog entry %s contains line '%s' that would be misread", e.ID, line)
+		}
+	}
+
+	return nil
+}
+
+// ParseCatalog parses a catalog file. Each entry starts with a
+// "-- <id> [locale]" line preceded by an empty line or the start of the
+// file. Lines starting with '#' are comments. Leading "Name: value" lines
+// of an entry are parsed as headers and the remainder as the body.
+func ParseCatalog(r io.Reader) ([]CatalogEntry, error) {
+
+	var (
+		entries []CatalogEntry
+		current *CatalogEntry
+		payload []string
+		empty   = true
+		lineNo  = 0
+		seen    = map[string]int{}
+	)
+
+	finish := func() {
+		if current != nil {
+			current.Headers, current.Body = splitCatalogPayload(payload)
+			entries = append(entries, *current)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNo++
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			empty = true
+			continue
+		}
+
+		if empty && strings.HasPrefix(line, "-- ") {
+			parts := strings.Fields(line[3:])
+			if len(parts) < 1 || len(parts) > 2 {
+				return nil, fmt.Errorf("line %d: malformed catalog entry header", lineNo)
+			}
+
+			id, err := ParseID128(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+
+			finish()
+
+			current = &CatalogEntry{ID: id}
+			if len(parts) == 2 {
+				current.Locale = parts[1]
+			}
+
+			key := string(current.ID) + " " + current.Locale
+			if prev, ok := seen[key]; ok {
+				return nil, fmt.Errorf("line %d: duplicate catalog entry %s, first defined on line %d",
+					lineNo, strings.TrimSpace(key), prev)
+			}
+			seen[key] = lineNo
+
+			payload = nil
+			empty = false
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("line %d: payload before catalog entry header", lineNo)
+		}
+
+		// Consecutive empty lines collapse into one, as in the journal
+		if empty && len(payload) > 0 {
+			payload = append(payload, "")
+		}
+
+		payload = append(payload, line)
+		empty = false
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	finish()
+
+	return entries, nil
+}
+
+// WriteCatalog writes entries in catalog file format
+func WriteCatalog(w io.Writer, entries []CatalogEntry) error {
+
+	bw := bufio.NewWriter(w)
+
+	for i, e := range entries {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+
+		bw.WriteString("-- " + string(e.ID))
+		if e.Locale != "" {
+			bw.WriteString(" " + e.Locale)
+		}
+		bw.WriteString("\n")
+
+		if text := e.Text(); text != "" {
+			bw.WriteString(strings.TrimRight(text, "\n") + "\n")
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+
+	return nil
+}
+
+// splitCatalogPayload splits the payload lines of an entry into
+// leading headers and body
+func splitCatalogPayload(lines []string) ([]CatalogHeader, string) {
+
+	var headers []CatalogHeader
+
+	i := 0
+	for ; i < len(lines) && lines[i] != ""; i++ {
+		idx := strings.Index(lines[i], ":")
+		if idx < 0 || !isCatalogHeaderName(lines[i][:idx]) {
+			// Not a header block, everything is body
+			return nil, strings.Join(lines, "\n") + "\n"
+		}
+
+		headers = append(headers, CatalogHeader{
+			Name:  lines[i][:idx],
+			Value: strings.TrimSpace(lines[i][idx+1:]),
+		})
+	}
+
+	// Skip the empty line separating headers from body
+	if i < len(lines) {
+		i++
+	}
+
+	body := ""
+	if i < len(lines) {
+		body = strings.Join(lines[i:], "\n") + "\n"
+	}
+
+	return headers, body
+}
+
+func isCatalogHeaderName(name string) bool {
+
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isCatalogVariable(name string) bool {
+
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+
+	return true
+}
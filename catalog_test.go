@@ -0,0 +1,180 @@
+// +build linux
+
+package journal
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `# Comment before the first entry
+
+-- fc2e22bc6ee647b6b90729ab34a250b1
+Subject: Process @COREDUMP_PID@ (@COREDUMP_COMM@) dumped core
+Defined-By: systemd
+Support: %SUPPORT_URL%
+
+Process @COREDUMP_PID@ (@COREDUMP_COMM@) crashed and dumped core.
+# Comments within the body are skipped
+
+
+This usually indicates a programming error.
+
+-- fc2e22bc6ee647b6b90729ab34a250b1 de
+Subject: Speicherabbild für Prozess @COREDUMP_PID@ (@COREDUMP_COMM@) generiert
+
+-- 39f53479d3a045ac8e11786248231fbf
+This entry has no headers: only a body.
+-- f77379a8490b408bbe5f6940505a777b
+`
+
+func TestParseCatalog(t *testing.T) {
+
+	entries, err := ParseCatalog(strings.NewReader(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CatalogEntry{
+		{
+			ID: "fc2e22bc6ee647b6b90729ab34a250b1",
+			Headers: []CatalogHeader{
+				{"Subject", "Process @COREDUMP_PID@ (@COREDUMP_COMM@) dumped core"},
+				{"Defined-By", "systemd"},
+				{"Support", "%SUPPORT_URL%"},
+			},
+			Body: "Process @COREDUMP_PID@ (@COREDUMP_COMM@) crashed and dumped core.\n\n" +
+				"This usually indicates a programming error.\n",
+		},
+		{
+			ID:     "fc2e22bc6ee647b6b90729ab34a250b1",
+			Locale: "de",
+			Headers: []CatalogHeader{
+				{"Subject", "Speicherabbild für Prozess @COREDUMP_PID@ (@COREDUMP_COMM@) generiert"},
+			},
+		},
+		{
+			// "-- <id>" only starts an entry after an empty line
+			ID: "39f53479d3a045ac8e11786248231fbf",
+			Body: "This entry has no headers: only a body.\n" +
+				"-- f77379a8490b408bbe5f6940505a777b\n",
+		},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestParseCatalogErrors(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		catalog string
+	}{
+		{"duplicate", "-- fc2e22bc6ee647b6b90729ab34a250b1\nA\n\n-- fc2e22bc6ee647b6b90729ab34a250b1\nB\n"},
+		{"duplicate locale", "-- fc2e22bc6ee647b6b90729ab34a250b1 de\nA\n\n-- fc2e22bc6ee647b6b90729ab34a250b1 de\nB\n"},
+		{"malformed id", "-- fc2e22bc\nA\n"},
+		{"too many parts", "-- fc2e22bc6ee647b6b90729ab34a250b1 de x\nA\n"},
+		{"missing id", "-- \nA\n"},
+		{"payload first", "A\n\n-- fc2e22bc6ee647b6b90729ab34a250b1\nB\n"},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseCatalog(strings.NewReader(test.catalog)); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+
+	// The same ID in different locales is not a duplicate
+	c := "-- fc2e22bc6ee647b6b90729ab34a250b1\nA\n\n-- fc2e22bc6ee647b6b90729ab34a250b1 de\nB\n"
+	if _, err := ParseCatalog(strings.NewReader(c)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCatalogRoundTrip(t *testing.T) {
+
+	entries, err := ParseCatalog(strings.NewReader(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The body of the last entry contains a line that would be misread
+	entries = entries[:2]
+
+	var buf bytes.Buffer
+	if err := WriteCatalog(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseCatalog(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("expected %+v, got %+v", entries, parsed)
+	}
+}
+
+func TestCatalogEntryValidate(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		entry CatalogEntry
+		valid bool
+	}{
+		{"body", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Body: "A\n"}, true},
+		{"header", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Headers: []CatalogHeader{{"Subject", "A"}}}, true},
+		{"invalid id", CatalogEntry{ID: "x", Body: "A\n"}, false},
+		{"invalid locale", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Locale: "d e", Body: "A\n"}, false},
+		{"invalid header", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Headers: []CatalogHeader{{"A B", "A"}}}, false},
+		{"multi-line header", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Headers: []CatalogHeader{{"Subject", "A\nB"}}}, false},
+		{"empty", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1"}, false},
+		{"comment in body", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Body: "A\n# B\n"}, false},
+		{"header in body", CatalogEntry{ID: "fc2e22bc6ee647b6b90729ab34a250b1", Body: "A\n-- B\n"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.entry.Validate()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: expected valid %v, got error %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestCatalogEntryRender(t *testing.T) {
+
+	e := CatalogEntry{
+		Headers: []CatalogHeader{{"Subject", "Process @COREDUMP_PID@ dumped core"}},
+		Body:    "Mail admin@example.com about @COREDUMP_COMM@ and @@ @lower@.\n",
+	}
+
+	tests := []struct {
+		fields   Fields
+		expected string
+	}{
+		{
+			Fields{"COREDUMP_PID": "42", "COREDUMP_COMM": "app"},
+			"Subject: Process 42 dumped core\n\nMail admin@example.com about app and @@ @lower@.\n",
+		},
+		{
+			// Missing fields are replaced by their name
+			Fields{"COREDUMP_PID": "42"},
+			"Subject: Process 42 dumped core\n\nMail admin@example.com about COREDUMP_COMM and @@ @lower@.\n",
+		},
+		{
+			nil,
+			"Subject: Process COREDUMP_PID dumped core\n\nMail admin@example.com about COREDUMP_COMM and @@ @lower@.\n",
+		},
+	}
+
+	for _, test := range tests {
+		if s := e.Render(test.fields); s != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, s)
+		}
+	}
+}
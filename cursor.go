@@ -0,0 +1,178 @@
+// +build linux
+
+package journal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flags telling what parts are present in a cursor
+const (
+	cursorHasSeqnumID = 1 << iota
+	cursorHasSeqnum
+	cursorHasBootID
+	cursorHasMonotonic
+	cursorHasRealtime
+	cursorHasXorHash
+)
+
+// Cursor is a position in the journal as returned by Journal.Cursor.
+// A cursor encodes the sequence number ID and sequence number, the boot
+// ID and monotonic timestamp, the realtime timestamp and a hash of the
+// entry it points to. The zero value is an empty cursor.
+type Cursor struct {
+	raw       string
+	has       int
+	seqnumID  ID128
+	seqnum    uint64
+	bootID    ID128
+	monotonic uint64
+	realtime  uint64
+	xorHash   uint64
+}
+
+// ParseCursor parses a cursor in the form returned by the journal,
+// e.g. "s=...;i=...;b=...;m=...;t=...;x=...". Unknown parts are ignored.
+func ParseCursor(s string) (Cursor, error) {
+
+	c := Cursor{raw: s}
+
+	if s == "" {
+		return c, fmt.Errorf("empty cursor")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || len(kv[0]) != 1 {
+			return Cursor{}, fmt.Errorf("malformed cursor '%s'", s)
+		}
+
+		var err error
+
+		switch kv[0][0] {
+		case 's':
+			c.seqnumID, err = ParseID128(kv[1])
+			c.has |= cursorHasSeqnumID
+		case 'i':
+			c.seqnum, err = strconv.ParseUint(kv[1], 16, 64)
+			c.has |= cursorHasSeqnum
+		case 'b':
+			c.bootID, err = ParseID128(kv[1])
+			c.has |= cursorHasBootID
+		case 'm':
+			c.monotonic, err = strconv.ParseUint(kv[1], 16, 64)
+			c.has |= cursorHasMonotonic
+		case 't':
+			c.realtime, err = strconv.ParseUint(kv[1], 16, 64)
+			c.has |= cursorHasRealtime
+		case 'x':
+			c.xorHash, err = strconv.ParseUint(kv[1], 16, 64)
+			c.has |= cursorHasXorHash
+		}
+
+		if err != nil {
+			return Cursor{}, fmt.Errorf("malformed cursor '%s': %w", s, err)
+		}
+	}
+
+	return c, nil
+}
+
+// String returns the cursor in the form returned by the journal
+func (c Cursor) String() string {
+	return c.raw
+}
+
+// IsZero reports whether the cursor is empty
+func (c Cursor) IsZero() bool {
+	return c.raw == ""
+}
+
+// SeqnumID returns the ID of the sequence number space of the cursor
+func (c Cursor) SeqnumID() ID128 {
+	return c.seqnumID
+}
+
+// Seqnum returns the sequence number of the entry
+func (c Cursor) Seqnum() uint64 {
+	return c.seqnum
+}
+
+// BootID returns the ID of the boot the entry was written in
+func (c Cursor) BootID() ID128 {
+	return c.bootID
+}
+
+// Monotonic returns the monotonic timestamp of the entry, i.e. the time
+// elapsed since boot
+func (c Cursor) Monotonic() time.Duration {
+	return time.Duration(c.monotonic) * time.Microsecond
+}
+
+// Realtime returns the realtime timestamp of the entry
+func (c Cursor) Realtime() time.Time {
+	return time.Unix(0, int64(c.realtime)*int64(time.Microsecond))
+}
+
+// XorHash returns the XOR of the hashes of all fields of the entry
+func (c Cursor) XorHash() uint64 {
+	return c.xorHash
+}
+
+// Compare orders c relative to o and returns -1 if c is before o, 0 if
+// they point at the same position and +1 if c is after o. Cursors from the
+// same sequence number space are ordered by sequence number. Otherwise
+// cursors from the same boot are ordered by monotonic timestamp and
+// remaining cursors by realtime timestamp.
+func (c Cursor) Compare(o Cursor) int {
+
+	const seqnum = cursorHasSeqnumID | cursorHasSeqnum
+	const monotonic = cursorHasBootID | cursorHasMonotonic
+
+	switch {
+	case c.has&seqnum == seqnum && o.has&seqnum == seqnum && c.seqnumID == o.seqnumID:
+		return compareUint64(c.seqnum, o.seqnum)
+	case c.has&monotonic == monotonic && o.has&monotonic == monotonic && c.bootID == o.bootID:
+		return compareUint64(c.monotonic, o.monotonic)
+	default:
+		return compareUint64(c.realtime, o.realtime)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (c Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.raw), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// Empty text results in a zero cursor.
+func (c *Cursor) UnmarshalText(text []byte) error {
+
+	if len(text) == 0 {
+		*c = Cursor{}
+		return nil
+	}
+
+	v, err := ParseCursor(string(text))
+	if err != nil {
+		return err
+	}
+
+	*c = v
+
+	return nil
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,134 @@
+// +build linux
+
+package journal
+
+import (
+	"testing"
+	"time"
+)
+
+// Cursors in the form returned by sd_journal_get_cursor
+const (
+	cursorA1 = "s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7;b=6c7c6013a8824fe8b0b5e6d0eb8b7b59;m=299c99;t=5ba1e7e4a5f4f;x=2d5c3d3a7e11d1aa"
+	cursorA2 = "s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece8;b=6c7c6013a8824fe8b0b5e6d0eb8b7b59;m=29a003;t=5ba1e7e4a62b9;x=9e2b1c8d41f0a7e3"
+	// Same boot as A, another sequence number space
+	cursorB1 = "s=c8a4f8e1b5d24b4a9a0d8e2b1f6c7d30;i=12;b=6c7c6013a8824fe8b0b5e6d0eb8b7b59;m=299d00;t=5ba1e7e4a0000;x=57f1e2c3d4b5a697"
+	// Another boot, another sequence number space
+	cursorC1 = "s=0f4c0a0e2b6c4d0a9a3f8c1d2e3f4a5b;i=1;b=2a5e5c6a1d0e4f3b8c7d6e5f4a3b2c1d;m=1b8a0f;t=5ba1e7e4a5f50;x=1f2e3d4c5b6a7988"
+)
+
+func TestParseCursor(t *testing.T) {
+
+	c, err := ParseCursor(cursorA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.String() != cursorA1 || c.IsZero() {
+		t.Errorf("expected %s, got %s", cursorA1, c)
+	}
+	if c.SeqnumID() != "739ad463348b4ceca5a9e69c95a3c93f" {
+		t.Errorf("unexpected seqnum ID %s", c.SeqnumID())
+	}
+	if c.Seqnum() != 0x4ece7 {
+		t.Errorf("unexpected seqnum %x", c.Seqnum())
+	}
+	if c.BootID() != "6c7c6013a8824fe8b0b5e6d0eb8b7b59" {
+		t.Errorf("unexpected boot ID %s", c.BootID())
+	}
+	if c.Monotonic() != 0x299c99*time.Microsecond {
+		t.Errorf("unexpected monotonic timestamp %v", c.Monotonic())
+	}
+	if c.Realtime().UnixNano() != 0x5ba1e7e4a5f4f*int64(time.Microsecond) {
+		t.Errorf("unexpected realtime timestamp %v", c.Realtime())
+	}
+	if c.XorHash() != 0x2d5c3d3a7e11d1aa {
+		t.Errorf("unexpected hash %x", c.XorHash())
+	}
+
+	tests := []struct {
+		cursor string
+		valid  bool
+	}{
+		// Partial cursors
+		{"s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7", true},
+		{"b=6c7c6013a8824fe8b0b5e6d0eb8b7b59;m=299c99", true},
+		{"t=5ba1e7e4a5f4f", true},
+		// Unknown parts are ignored
+		{"t=5ba1e7e4a5f4f;z=1", true},
+		// Malformed cursors
+		{"", false},
+		{"s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7;", false},
+		{"s=739ad463348b4ceca5a9e69c95a3c93f;i", false},
+		{"s=739ad463;i=4ece7", false},
+		{"i=4ecg7", false},
+		{"m=-1", false},
+		{"t=5ba1e7e4a5f4f5ba1e7e4a5f4f", false},
+		{"seqnum=1", false},
+		{"739ad463348b4ceca5a9e69c95a3c93f", false},
+	}
+
+	for _, test := range tests {
+		_, err := ParseCursor(test.cursor)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%q: expected valid %v, got error %v", test.cursor, test.valid, err)
+		}
+	}
+}
+
+func TestCursorCompare(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		a, b     string
+		expected int
+	}{
+		{"same", cursorA1, cursorA1, 0},
+		{"seqnum", cursorA1, cursorA2, -1},
+		{"seqnum reversed", cursorA2, cursorA1, 1},
+		// B1 was written before A1 but has a later monotonic timestamp
+		{"monotonic within boot", cursorA1, cursorB1, -1},
+		{"monotonic within boot reversed", cursorB1, cursorA1, 1},
+		// C1 has an earlier monotonic timestamp but a later realtime one
+		{"realtime across boots", cursorA1, cursorC1, -1},
+		{"realtime across boots reversed", cursorC1, cursorA1, 1},
+		{"realtime of partial cursors", "t=5ba1e7e4a5f4f", "s=739ad463348b4ceca5a9e69c95a3c93f;i=1;t=5ba1e7e4a5f50", -1},
+		{"seqnum without seqnum ID", "i=2;t=5ba1e7e4a5f4f", "i=1;t=5ba1e7e4a5f50", -1},
+	}
+
+	for _, test := range tests {
+		a, err := ParseCursor(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseCursor(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v := a.Compare(b); v != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, v)
+		}
+	}
+}
+
+func TestCursorText(t *testing.T) {
+
+	var c Cursor
+	if err := c.UnmarshalText([]byte(cursorA1)); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := c.MarshalText()
+	if err != nil || string(text) != cursorA1 {
+		t.Errorf("expected %s, got %s (%v)", cursorA1, text, err)
+	}
+
+	if err := c.UnmarshalText(nil); err != nil || !c.IsZero() {
+		t.Errorf("expected zero cursor, got %s (%v)", c, err)
+	}
+
+	if err := c.UnmarshalText([]byte("x")); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,290 @@
+// +build linux
+
+// Package elastic indexes journal entries in Elasticsearch or OpenSearch
+// as Elastic Common Schema documents.
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/retry"
+)
+
+// IndexerConfig configures an Indexer
+type IndexerConfig struct {
+	// URL of Elasticsearch or OpenSearch, e.g. "https://es:9200"
+	URL string
+	// Index is the prefix of the daily index names. Defaults to "journal".
+	Index string
+	// IndexDateLayout is the layout of the date, in UTC, appended to the
+	// index prefix. Defaults to "2006.01.02", i.e. daily indices like
+	// journal-2024.05.17. "-" writes all entries to the prefix only,
+	// e.g. a data stream.
+	IndexDateLayout string
+	// Username and Password are used for basic authentication if set
+	Username string
+	Password string
+	// APIKey is the encoded API key used for authentication if set
+	APIKey string
+	// Headers are added to every request
+	Headers map[string]string
+	// Client is used for requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// StateFile is where the cursor of the last indexed entry is saved.
+	// Indexing resumes after the saved cursor.
+	StateFile string
+	// BatchSize is the maximum number of entries per request.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back while
+	// following. Defaults to 1s.
+	FlushInterval time.Duration
+	// Retries is the number of times failed documents are retried.
+	// Defaults to 4. A negative value retries until they're indexed.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for
+	// every following retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+	// OnError is called with errors while following, and with documents
+	// rejected by the server
+	OnError func(err error)
+}
+
+// Indexer indexes journal entries through the bulk API. The cursor of an
+// entry is the ID of its document, so documents aren't duplicated when
+// retried.
+type Indexer struct {
+	cfg     IndexerConfig
+	url     string
+	backoff retry.Backoff
+}
+
+// bulkItem is an action and document of a bulk request
+type bulkItem struct {
+	cursor journal.Cursor
+	data   []byte
+}
+
+// bulkResponse is the response of a bulk request
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// NewIndexer creates an Indexer
+func NewIndexer(cfg IndexerConfig) (*Indexer, error) {
+
+	if cfg.URL == "" {
+		return nil, errors.New("an Elasticsearch URL must be provided")
+	}
+	if cfg.Index == "" {
+		cfg.Index = "journal"
+	}
+	if cfg.IndexDateLayout == "" {
+		cfg.IndexDateLayout = "2006.01.02"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	return &Indexer{
+		cfg:     cfg,
+		url:     strings.TrimSuffix(cfg.URL, "/") + "/_bulk",
+		backoff: retry.WithRetries(cfg.Retries, cfg.RetryBackoff),
+	}, nil
+}
+
+// Export indexes entries in a bulk request. Documents failing with
+// server errors or rate limiting are retried, and the rest of the
+// failing documents are passed to OnError.
+func (x *Indexer) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	items := make([]bulkItem, 0, len(entries))
+
+	for _, e := range entries {
+		item, err := x.newItem(e)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	return x.backoff.Do(ctx, func() error {
+		failed, err := x.bulk(ctx, items)
+		if err != nil {
+			return err
+		}
+
+		if len(failed) > 0 {
+			items = failed
+			return fmt.Errorf("failed to index %d documents", len(failed))
+		}
+
+		return nil
+	})
+}
+
+// IndexJournal indexes the entries of j from its current position, or
+// after the cursor in the state file, until there are no more entries.
+func (x *Indexer) IndexJournal(ctx context.Context, j journal.Reader) error {
+	return batch.Read(ctx, j, x.batchConfig(), x.Export)
+}
+
+// Follow follows j from its current position, or after the cursor in
+// the state file, and indexes entries as they are written. Errors are
+// passed to OnError. Following stops if entries fail to be indexed.
+func (x *Indexer) Follow(j journal.Follower) (journal.FollowStop, error) {
+	return batch.Follow(j, x.batchConfig(), x.Export)
+}
+
+func (x *Indexer) batchConfig() batch.Config {
+	return batch.Config{
+		Size:      x.cfg.BatchSize,
+		Interval:  x.cfg.FlushInterval,
+		StateFile: x.cfg.StateFile,
+		OnError:   x.cfg.OnError,
+	}
+}
+
+// index returns the index of a document
+func (x *Indexer) index(e *journal.Entry) string {
+
+	if x.cfg.IndexDateLayout == "-" {
+		return x.cfg.Index
+	}
+
+	return x.cfg.Index + "-" + e.Timestamp.UTC().Format(x.cfg.IndexDateLayout)
+}
+
+// newItem encodes the create action and document of an entry. Creating
+// rather than indexing documents works with data streams as well.
+func (x *Indexer) newItem(e *journal.Entry) (bulkItem, error) {
+
+	if e.Cursor.IsZero() {
+		return bulkItem{}, errors.New("failed to index entry: entry has no cursor")
+	}
+
+	var buf bytes.Buffer
+
+	action := map[string]interface{}{
+		"create": map[string]string{
+			"_index": x.index(e),
+			"_id":    e.Cursor.String(),
+		},
+	}
+
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(action); err != nil {
+		return bulkItem{}, fmt.Errorf("failed to encode bulk action: %w", err)
+	}
+	if err := enc.Encode(newDocument(e)); err != nil {
+		return bulkItem{}, fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	return bulkItem{cursor: e.Cursor, data: buf.Bytes()}, nil
+}
+
+// bulk sends a bulk request and returns the items to retry. Documents
+// already created by an earlier attempt are conflicts and thus indexed.
+func (x *Indexer) bulk(ctx context.Context, items []bulkItem) ([]bulkItem, error) {
+
+	var body bytes.Buffer
+	for _, item := range items {
+		body.Write(item.data)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, x.url, &body)
+	if err != nil {
+		return nil, retry.Permanent(fmt.Errorf("failed to create bulk request: %w", err))
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if x.cfg.Username != "" || x.cfg.Password != "" {
+		req.SetBasicAuth(x.cfg.Username, x.cfg.Password)
+	}
+	if x.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+x.cfg.APIKey)
+	}
+	for k, v := range x.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := x.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index documents: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("failed to index documents: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+
+		if retryable(resp.StatusCode) {
+			return nil, err
+		}
+
+		return nil, retry.Permanent(err)
+	}
+
+	var r bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+
+	if !r.Errors {
+		return nil, nil
+	}
+
+	if len(r.Items) != len(items) {
+		return nil, retry.Permanent(fmt.Errorf("bulk response has %d items, expected %d", len(r.Items), len(items)))
+	}
+
+	var failed []bulkItem
+
+	for i, result := range r.Items {
+		for _, res := range result {
+			switch {
+			case res.Status < 300, res.Status == http.StatusConflict:
+			case retryable(res.Status):
+				failed = append(failed, items[i])
+			default:
+				x.cfg.OnError(fmt.Errorf("failed to index entry '%s': %d: %s: %s",
+					items[i].cursor, res.Status, res.Error.Type, res.Error.Reason))
+			}
+		}
+	}
+
+	return failed, nil
+}
+
+// retryable returns true if a status is worth retrying
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
@@ -0,0 +1,277 @@
+// +build linux
+
+package elastic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// bulkServer replies to bulk requests with the given item statuses in
+// turn, one list per request and 201 for items beyond it. A status of a
+// whole request is given as a list with a single negative status. The
+// messages of the documents of every request are recorded.
+type bulkServer struct {
+	*httptest.Server
+	statuses [][]int
+	requests []string
+	indices  map[string]bool
+	header   http.Header
+	mutex    sync.Mutex
+}
+
+func newBulkServer(t *testing.T, statuses ...[]int) *bulkServer {
+
+	s := &bulkServer{statuses: statuses, indices: map[string]bool{}}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("expected path /_bulk, got %s", r.URL.Path)
+		}
+		s.header = r.Header
+
+		var statuses []int
+		if n := len(s.requests); n < len(s.statuses) {
+			statuses = s.statuses[n]
+		}
+
+		var messages []string
+		var items []map[string]interface{}
+
+		sc := bufio.NewScanner(r.Body)
+		for i := 0; sc.Scan(); i++ {
+			var action struct {
+				Create struct {
+					Index string `json:"_index"`
+					ID    string `json:"_id"`
+				} `json:"create"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &action); err != nil {
+				t.Errorf("failed to decode action: %v", err)
+			}
+			s.indices[action.Create.Index] = true
+
+			if !sc.Scan() {
+				t.Errorf("missing document of %s", action.Create.ID)
+				break
+			}
+
+			var doc struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+				t.Errorf("failed to decode document: %v", err)
+			}
+			messages = append(messages, doc.Message)
+
+			status := http.StatusCreated
+			if i < len(statuses) {
+				status = statuses[i]
+			}
+
+			item := map[string]interface{}{"_id": action.Create.ID, "status": status}
+			if status >= 300 {
+				item["error"] = map[string]string{"type": "error", "reason": "rejected"}
+			}
+			items = append(items, map[string]interface{}{"create": item})
+		}
+
+		s.requests = append(s.requests, strings.Join(messages, " "))
+
+		if len(statuses) == 1 && statuses[0] < 0 {
+			http.Error(w, "rejected", -statuses[0])
+			return
+		}
+
+		errors := false
+		for _, status := range statuses {
+			errors = errors || status >= 300
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors, "items": items})
+	}))
+
+	return s
+}
+
+func (s *bulkServer) result() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return strings.Join(s.requests, "; ")
+}
+
+func TestIndexerExport(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		statuses [][]int
+		// Messages of the documents of every request
+		want   string
+		errors string
+		err    bool
+	}{
+		{
+			name: "created",
+			want: "1 2 3 4 5",
+		},
+		{
+			name: "mixed",
+			statuses: [][]int{
+				{http.StatusCreated, http.StatusConflict, http.StatusTooManyRequests, http.StatusBadRequest, http.StatusServiceUnavailable},
+				{http.StatusCreated, http.StatusInternalServerError},
+			},
+			want:   "1 2 3 4 5; 3 5; 5",
+			errors: "failed to index entry '" + journaltest.Entries(4)[3].Cursor.String() + "': 400: error: rejected",
+		},
+		{
+			name: "request retried",
+			statuses: [][]int{
+				{-http.StatusServiceUnavailable},
+				{-http.StatusTooManyRequests},
+			},
+			want: "1 2 3 4 5; 1 2 3 4 5; 1 2 3 4 5",
+		},
+		{
+			name: "request rejected",
+			statuses: [][]int{
+				{-http.StatusBadRequest},
+			},
+			want: "1 2 3 4 5",
+			err:  true,
+		},
+		{
+			name: "retries used up",
+			statuses: [][]int{
+				{http.StatusCreated, http.StatusTooManyRequests},
+				{http.StatusTooManyRequests},
+				{http.StatusTooManyRequests},
+			},
+			want: "1 2 3 4 5; 2; 2",
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newBulkServer(t, test.statuses...)
+			defer s.Close()
+
+			var errs []string
+
+			x, err := NewIndexer(IndexerConfig{
+				URL:          s.URL + "/",
+				APIKey:       "key",
+				Retries:      2,
+				RetryBackoff: time.Millisecond,
+				OnError:      func(err error) { errs = append(errs, err.Error()) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = x.Export(context.Background(), journaltest.Entries(5))
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if got := s.result(); got != test.want {
+				t.Errorf("expected requests [%s], got [%s]", test.want, got)
+			}
+			if e := strings.Join(errs, "; "); e != test.errors {
+				t.Errorf("expected errors %q, got %q", test.errors, e)
+			}
+			if h := s.header.Get("Authorization"); h != "ApiKey key" {
+				t.Errorf("expected Authorization header, got %q", h)
+			}
+			if !s.indices["journal-2020.09.13"] || len(s.indices) != 1 {
+				t.Errorf("expected index journal-2020.09.13, got %v", s.indices)
+			}
+		})
+	}
+}
+
+func TestIndexerIndexJournal(t *testing.T) {
+
+	s := newBulkServer(t)
+	defer s.Close()
+
+	x, err := NewIndexer(IndexerConfig{
+		URL:             s.URL,
+		Index:           "logs-journal",
+		IndexDateLayout: "-",
+		BatchSize:       2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := x.IndexJournal(context.Background(), &journaltest.SliceReader{Entries: journaltest.Entries(5)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "1 2; 3 4; 5"; s.result() != want {
+		t.Errorf("expected requests [%s], got [%s]", want, s.result())
+	}
+	if !s.indices["logs-journal"] || len(s.indices) != 1 {
+		t.Errorf("expected index logs-journal, got %v", s.indices)
+	}
+}
+
+func TestIndexerExportNoCursor(t *testing.T) {
+
+	x, err := NewIndexer(IndexerConfig{URL: "http://127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []*journal.Entry{{Fields: journal.Fields{journal.FieldMessage: "no cursor"}}}
+
+	if err := x.Export(context.Background(), entries); err == nil {
+		t.Error("expected error for entry without cursor")
+	}
+}
+
+func BenchmarkIndexerExport(b *testing.B) {
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		io.WriteString(w, `{"errors":false,"items":[]}`)
+	}))
+	defer s.Close()
+
+	x, err := NewIndexer(IndexerConfig{URL: s.URL})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	entries := journaltest.Entries(100)
+	for _, e := range entries {
+		e.Fields[journal.FieldPriority] = "6"
+		e.Fields[journal.FieldUnit] = "app.service"
+		e.Fields[journal.FieldPID] = "42"
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := x.Export(context.Background(), entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
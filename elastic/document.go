@@ -0,0 +1,121 @@
+// +build linux
+
+package elastic
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Journal fields mapped to ECS fields, stored as strings
+var ecsStringFields = map[string]string{
+	journal.FieldMessage:          "message",
+	journal.FieldHostname:         "host.name",
+	journal.FieldMachineID:        "host.id",
+	journal.FieldBootID:           "host.boot.id",
+	journal.FieldComm:             "process.name",
+	journal.FieldExe:              "process.executable",
+	journal.FieldCmdLine:          "process.command_line",
+	journal.FieldUID:              "user.id",
+	journal.FieldGID:              "user.group.id",
+	journal.FieldCodeFile:         "log.origin.file.name",
+	journal.FieldCodeFunc:         "log.origin.function",
+	journal.FieldSyslogIdentifier: "syslog.identifier",
+	journal.FieldUnit:             "systemd.unit",
+	journal.FieldUserUnit:         "systemd.user_unit",
+	journal.FieldSlice:            "systemd.slice",
+	journal.FieldCGroup:           "systemd.cgroup",
+	journal.FieldSession:          "systemd.session",
+	journal.FieldOwnerUID:         "systemd.owner_uid",
+	journal.FieldInvocationID:     "systemd.invocation_id",
+	journal.FieldTransport:        "systemd.transport",
+	journal.FieldMessageID:        "journald.message_id",
+}
+
+// Journal fields mapped to ECS fields, stored as numbers if valid
+var ecsNumberFields = map[string]string{
+	journal.FieldPID:       "process.pid",
+	journal.FieldSyslogPID: "syslog.pid",
+	journal.FieldCodeLine:  "log.origin.file.line",
+}
+
+// Fields handled separately or left out of documents
+var ecsSkipFields = map[string]bool{
+	journal.FieldPriority:                true,
+	journal.FieldSyslogFacility:          true,
+	journal.FieldSourceRealtimeTimestamp: true,
+}
+
+// newDocument converts an entry to an ECS document. Fields without an
+// ECS counterpart are kept below journald.custom, named in lower case
+// without leading underscores.
+func newDocument(e *journal.Entry) map[string]interface{} {
+
+	doc := map[string]interface{}{}
+
+	t, err := e.SourceTime()
+	if err != nil || t.IsZero() {
+		t = e.Timestamp
+	}
+
+	setField(doc, "@timestamp", t.UTC().Format(time.RFC3339Nano))
+	setField(doc, "event.created", e.Timestamp.UTC().Format(time.RFC3339Nano))
+	setField(doc, "event.kind", "event")
+
+	if p, err := e.Priority(); err == nil && p >= journal.PriorityEmergency && p <= journal.PriorityDebug {
+		text, _ := p.MarshalText()
+		setField(doc, "log.level", string(text))
+		setField(doc, "log.syslog.severity.code", int(p))
+		setField(doc, "log.syslog.severity.name", string(text))
+	}
+
+	if f, err := e.Facility(); err == nil {
+		setField(doc, "log.syslog.facility.code", int(f))
+		setField(doc, "log.syslog.facility.name", f.String())
+	}
+
+	for name, v := range e.Fields {
+		if ecsSkipFields[name] || strings.HasPrefix(name, "__") {
+			continue
+		}
+
+		if key, ok := ecsStringFields[name]; ok {
+			setField(doc, key, v)
+			continue
+		}
+
+		if key, ok := ecsNumberFields[name]; ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				setField(doc, key, n)
+			} else {
+				setField(doc, key, v)
+			}
+			continue
+		}
+
+		setField(doc, "journald.custom."+strings.ToLower(strings.TrimLeft(name, "_")), v)
+	}
+
+	return doc
+}
+
+// setField sets a dotted field of a document, creating the objects
+// along the way. "@timestamp" and other keys without dots are set as is.
+func setField(doc map[string]interface{}, key string, v interface{}) {
+
+	parts := strings.Split(key, ".")
+
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := doc[p].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			doc[p] = child
+		}
+		doc = child
+	}
+
+	doc[parts[len(parts)-1]] = v
+}
@@ -0,0 +1,211 @@
+// +build linux
+
+package journal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// field returns the value of a field or ErrFieldNotFound
+func (e *Entry) field(name string) (string, error) {
+
+	v, ok := e.Fields[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrFieldNotFound, name)
+	}
+
+	return v, nil
+}
+
+// BootID returns the ID of the boot the entry was written in
+func (e *Entry) BootID() (ID128, error) {
+
+	if e.bootID != "" {
+		return e.bootID, nil
+	}
+
+	v, err := e.field(FieldBootID)
+	if err != nil {
+		return "", err
+	}
+
+	return ParseID128(v)
+}
+
+// Priority returns the priority of the entry
+func (e *Entry) Priority() (Priority, error) {
+
+	v, err := e.field(FieldPriority)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < int(PriorityEmergency) || n > int(PriorityDebug) {
+		return 0, fmt.Errorf("invalid priority '%s'", v)
+	}
+
+	return Priority(n), nil
+}
+
+// Facility returns the syslog facility of the entry
+func (e *Entry) Facility() (Facility, error) {
+
+	v, err := e.field(FieldSyslogFacility)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < int(FacilityKern) || n > int(FacilityLocal7) {
+		return 0, fmt.Errorf("invalid syslog facility '%s'", v)
+	}
+
+	return Facility(n), nil
+}
+
+// Transport describes how an entry was received by the journal
+type Transport int
+
+// Transport constants
+const (
+	// TransportAudit indicates an entry read from the kernel audit subsystem
+	TransportAudit Transport = iota
+	// TransportDriver indicates an entry generated internally by journald
+	TransportDriver
+	// TransportSyslog indicates an entry received via the local syslog socket
+	TransportSyslog
+	// TransportJournal indicates an entry received via the native journal protocol
+	TransportJournal
+	// TransportStdout indicates an entry read from a service's standard output or error
+	TransportStdout
+	// TransportKernel indicates an entry read from the kernel
+	TransportKernel
+)
+
+var transportNames = []string{
+	"audit",
+	"driver",
+	"syslog",
+	"journal",
+	"stdout",
+	"kernel",
+}
+
+func (t Transport) String() string {
+
+	if t < TransportAudit || t > TransportKernel {
+		return "Transport(" + strconv.Itoa(int(t)) + ")"
+	}
+
+	return transportNames[t]
+}
+
+// PID returns the process ID of the process the entry originates from
+func (e *Entry) PID() (int, error) {
+
+	v, err := e.field(FieldPID)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(v)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid process ID '%s'", v)
+	}
+
+	return pid, nil
+}
+
+// UID returns the user ID of the process the entry originates from
+func (e *Entry) UID() (uint32, error) {
+	return e.uint32Field(FieldUID)
+}
+
+// GID returns the group ID of the process the entry originates from
+func (e *Entry) GID() (uint32, error) {
+	return e.uint32Field(FieldGID)
+}
+
+// Unit returns the systemd unit of the process the entry originates from
+func (e *Entry) Unit() (string, error) {
+	return e.field(FieldUnit)
+}
+
+// Hostname returns the name of the host the entry originates from
+func (e *Entry) Hostname() (string, error) {
+	return e.field(FieldHostname)
+}
+
+// CmdLine returns the command line of the process the entry originates from
+func (e *Entry) CmdLine() (string, error) {
+	return e.field(FieldCmdLine)
+}
+
+// Identifier returns the syslog identifier of the entry
+func (e *Entry) Identifier() (string, error) {
+	return e.field(FieldSyslogIdentifier)
+}
+
+// MachineID returns the ID of the machine the entry originates from
+func (e *Entry) MachineID() (ID128, error) {
+
+	v, err := e.field(FieldMachineID)
+	if err != nil {
+		return "", err
+	}
+
+	return ParseID128(v)
+}
+
+// SourceTime returns the time the entry was created by its originating
+// process. The time the journal received the entry is returned if the
+// entry carries no source timestamp.
+func (e *Entry) SourceTime() (time.Time, error) {
+
+	v, ok := e.Fields[FieldSourceRealtimeTimestamp]
+	if !ok {
+		return e.Timestamp, nil
+	}
+
+	usec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid source timestamp '%s'", v)
+	}
+
+	return time.Unix(0, usec*int64(time.Microsecond)), nil
+}
+
+// Transport returns how the entry was received by the journal
+func (e *Entry) Transport() (Transport, error) {
+
+	v, err := e.field(FieldTransport)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, n := range transportNames {
+		if n == v {
+			return Transport(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown transport '%s'", v)
+}
+
+func (e *Entry) uint32Field(name string) (uint32, error) {
+
+	v, err := e.field(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s' of field %s", v, name)
+	}
+
+	return uint32(n), nil
+}
@@ -0,0 +1,150 @@
+// +build linux
+
+package journal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEntryAccessors(t *testing.T) {
+
+	e := &Entry{
+		Fields: Fields{
+			FieldBootID:                  "FC2E22BC-6EE6-47B6-B907-29AB34A250B1",
+			FieldMachineID:               "39f53479d3a045ac8e11786248231fbf",
+			FieldPriority:                "3",
+			FieldSyslogFacility:          "16",
+			FieldPID:                     "42",
+			FieldUID:                     "1000",
+			FieldGID:                     "4294967295",
+			FieldUnit:                    "app.service",
+			FieldHostname:                "host",
+			FieldCmdLine:                 "/usr/bin/app -v",
+			FieldSyslogIdentifier:        "app",
+			FieldTransport:               "stdout",
+			FieldSourceRealtimeTimestamp: "1577836800000001",
+		},
+	}
+
+	check := func(name string, v, expected interface{}, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if v != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, v)
+		}
+	}
+
+	bootID, err := e.BootID()
+	check("BootID", bootID, ID128("fc2e22bc6ee647b6b90729ab34a250b1"), err)
+	machineID, err := e.MachineID()
+	check("MachineID", machineID, ID128("39f53479d3a045ac8e11786248231fbf"), err)
+	p, err := e.Priority()
+	check("Priority", p, PriorityError, err)
+	f, err := e.Facility()
+	check("Facility", f, FacilityLocal0, err)
+	pid, err := e.PID()
+	check("PID", pid, 42, err)
+	uid, err := e.UID()
+	check("UID", uid, uint32(1000), err)
+	gid, err := e.GID()
+	check("GID", gid, uint32(4294967295), err)
+	unit, err := e.Unit()
+	check("Unit", unit, "app.service", err)
+	hostname, err := e.Hostname()
+	check("Hostname", hostname, "host", err)
+	cmdLine, err := e.CmdLine()
+	check("CmdLine", cmdLine, "/usr/bin/app -v", err)
+	identifier, err := e.Identifier()
+	check("Identifier", identifier, "app", err)
+	transport, err := e.Transport()
+	check("Transport", transport, TransportStdout, err)
+	sourceTime, err := e.SourceTime()
+	check("SourceTime", sourceTime.UnixNano(), int64(1577836800000001000), err)
+
+	// The boot ID read along with the entry takes precedence
+	e.bootID = "39f53479d3a045ac8e11786248231fbf"
+	bootID, err = e.BootID()
+	check("BootID", bootID, e.bootID, err)
+}
+
+func TestEntryAccessorErrors(t *testing.T) {
+
+	accessors := map[string]func(e *Entry) error{
+		"BootID":     func(e *Entry) error { _, err := e.BootID(); return err },
+		"MachineID":  func(e *Entry) error { _, err := e.MachineID(); return err },
+		"Priority":   func(e *Entry) error { _, err := e.Priority(); return err },
+		"Facility":   func(e *Entry) error { _, err := e.Facility(); return err },
+		"PID":        func(e *Entry) error { _, err := e.PID(); return err },
+		"UID":        func(e *Entry) error { _, err := e.UID(); return err },
+		"GID":        func(e *Entry) error { _, err := e.GID(); return err },
+		"Unit":       func(e *Entry) error { _, err := e.Unit(); return err },
+		"Hostname":   func(e *Entry) error { _, err := e.Hostname(); return err },
+		"CmdLine":    func(e *Entry) error { _, err := e.CmdLine(); return err },
+		"Identifier": func(e *Entry) error { _, err := e.Identifier(); return err },
+		"Transport":  func(e *Entry) error { _, err := e.Transport(); return err },
+	}
+
+	// Missing fields
+	for name, get := range accessors {
+		if err := get(&Entry{Fields: Fields{}}); !errors.Is(err, ErrFieldNotFound) {
+			t.Errorf("%s: expected ErrFieldNotFound, got %v", name, err)
+		}
+	}
+
+	// Invalid values
+	tests := []struct {
+		accessor string
+		field    string
+		value    string
+	}{
+		{"BootID", FieldBootID, "x"},
+		{"MachineID", FieldMachineID, "fc2e22bc"},
+		{"Priority", FieldPriority, "8"},
+		{"Priority", FieldPriority, "err"},
+		{"Facility", FieldSyslogFacility, "24"},
+		{"PID", FieldPID, "0"},
+		{"PID", FieldPID, "-1"},
+		{"UID", FieldUID, "-1"},
+		{"GID", FieldGID, "4294967296"},
+		{"Transport", FieldTransport, "console"},
+	}
+
+	for _, test := range tests {
+		e := &Entry{Fields: Fields{test.field: test.value}}
+		if err := accessors[test.accessor](e); err == nil || errors.Is(err, ErrFieldNotFound) {
+			t.Errorf("%s %q: expected invalid value error, got %v", test.accessor, test.value, err)
+		}
+	}
+}
+
+func TestEntrySourceTime(t *testing.T) {
+
+	ts := time.Unix(1577836800, 0)
+
+	e := &Entry{Timestamp: ts, Fields: Fields{}}
+	if v, err := e.SourceTime(); err != nil || !v.Equal(ts) {
+		t.Errorf("expected %v, got %v (%v)", ts, v, err)
+	}
+
+	e.Fields[FieldSourceRealtimeTimestamp] = "x"
+	if _, err := e.SourceTime(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestTransport(t *testing.T) {
+
+	for tr := TransportAudit; tr <= TransportKernel; tr++ {
+		e := &Entry{Fields: Fields{FieldTransport: tr.String()}}
+		if v, err := e.Transport(); err != nil || v != tr {
+			t.Errorf("%s: expected %v, got %v (%v)", tr, tr, v, err)
+		}
+	}
+
+	if s := Transport(6).String(); s != "Transport(6)" {
+		t.Errorf("expected Transport(6), got %s", s)
+	}
+}
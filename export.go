@@ -0,0 +1,345 @@
+// +build linux
+
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ExportContentType is the MIME type of the Journal Export Format
+const ExportContentType = "application/vnd.fdo.journal"
+
+// Default maximum size of an entry read by an ExportDecoder
+const defaultMaxExportEntrySize = 64 << 20
+
+var (
+	// ErrInvalidExport is returned when decoding malformed Journal Export Format
+	ErrInvalidExport = errors.New("journal: invalid export format")
+)
+
+// ExportSizeError is returned when decoding an entry larger than the
+// maximum entry size. It matches ErrInvalidExport using errors.Is.
+type ExportSizeError struct {
+	// Maximum entry size in bytes
+	Max int64
+}
+
+func (e *ExportSizeError) Error() string {
+	return fmt.Sprintf("%s: entry larger than %d bytes", ErrInvalidExport, e.Max)
+}
+
+// Is reports whether target is ErrInvalidExport
+func (e *ExportSizeError) Is(target error) bool {
+	return target == ErrInvalidExport
+}
+
+// ExportEncoder writes entries in the Journal Export Format, as
+// produced by journalctl -o export and accepted by systemd-journal-remote.
+type ExportEncoder struct {
+	w *bufio.Writer
+}
+
+// NewExportEncoder creates an ExportEncoder writing to w
+func NewExportEncoder(w io.Writer) *ExportEncoder {
+	return &ExportEncoder{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Encode writes an entry. The cursor, timestamps and boot ID of the entry
+// are written first, followed by its fields in name order. Fields that are
+// not printable text are written in the binary form of the format.
+func (enc *ExportEncoder) Encode(e *Entry) error {
+
+	eachExportField(e, enc.writeField)
+
+	enc.w.WriteByte('\n')
+
+	if err := enc.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write entry: %w", err)
+	}
+
+	return nil
+}
+
+// eachExportField calls fn for the cursor, timestamps and boot ID of an
+// entry followed by its fields in name order
+func eachExportField(e *Entry, fn func(name, value string)) {
+
+	if !e.Cursor.IsZero() {
+		fn(FieldCursor, e.Cursor.String())
+	}
+	if !e.Timestamp.IsZero() {
+		fn(FieldRealtimeTimestamp, strconv.FormatInt(e.Timestamp.UnixNano()/1000, 10))
+	}
+	if e.Elapsed != 0 {
+		// Elapsed holds the monotonic timestamp in microseconds
+		fn(FieldMonotonicTimestamp, strconv.FormatInt(int64(e.Elapsed), 10))
+	}
+
+	bootID := e.bootID.String()
+	if bootID == "" {
+		bootID = e.Fields[FieldBootID]
+	}
+	if bootID != "" {
+		fn(FieldBootID, bootID)
+	}
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		if name == FieldBootID || strings.HasPrefix(name, "__") {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fn(name, e.Fields[name])
+	}
+}
+
+func (enc *ExportEncoder) writeField(name, value string) {
+
+	enc.w.WriteString(name)
+
+	if exportPrintable(value) {
+		enc.w.WriteByte('=')
+		enc.w.WriteString(value)
+		enc.w.WriteByte('\n')
+		return
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+
+	enc.w.WriteByte('\n')
+	enc.w.Write(size[:])
+	enc.w.WriteString(value)
+	enc.w.WriteByte('\n')
+}
+
+// exportPrintable reports whether a value can be written in the
+// text form of the Journal Export Format
+func exportPrintable(s string) bool {
+
+	if !utf8.ValidString(s) {
+		return false
+	}
+
+	for _, r := range s {
+		if (r < ' ' && r != '\t') || r == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExportDecoder reads entries in the Journal Export Format
+type ExportDecoder struct {
+	r            *bufio.Reader
+	maxEntrySize int64
+}
+
+// NewExportDecoder creates an ExportDecoder reading from r
+func NewExportDecoder(r io.Reader) *ExportDecoder {
+	return &ExportDecoder{
+		r:            bufio.NewReader(r),
+		maxEntrySize: defaultMaxExportEntrySize,
+	}
+}
+
+// SetMaxEntrySize sets the maximum size in bytes of an entry, including
+// field names. Larger entries fail to decode. Defaults to 64 MiB.
+func (dec *ExportDecoder) SetMaxEntrySize(n int64) {
+	dec.maxEntrySize = n
+}
+
+// Decode reads the next entry. The cursor, timestamps and boot ID are read
+// into the respective members of the entry. Other fields whose names
+// begin with "__" are ignored. io.EOF is returned when there are no more
+// entries. Errors for malformed input wrap ErrInvalidExport, entries
+// larger than the maximum entry size fail with an *ExportSizeError.
+func (dec *ExportDecoder) Decode() (*Entry, error) {
+
+	e := &Entry{
+		Fields: Fields{},
+	}
+
+	var (
+		size   int64
+		fields int
+	)
+
+	for {
+		line, err := dec.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Long text field, read the remainder within the size limit
+			line = append([]byte(nil), line...)
+			for err == bufio.ErrBufferFull {
+				if size+int64(len(line)) > dec.maxEntrySize {
+					return nil, &ExportSizeError{Max: dec.maxEntrySize}
+				}
+				var rest []byte
+				rest, err = dec.r.ReadSlice('\n')
+				line = append(line, rest...)
+			}
+		}
+
+		if err == io.EOF && len(line) == 0 {
+			if fields == 0 {
+				return nil, io.EOF
+			}
+			// Last entry not followed by an empty line
+			return e, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read entry: %w", err)
+		}
+
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+
+		if len(line) == 0 {
+			if fields == 0 {
+				// Tolerate extra empty lines between entries
+				continue
+			}
+			return e, nil
+		}
+
+		size += int64(len(line))
+		if size > dec.maxEntrySize {
+			return nil, &ExportSizeError{Max: dec.maxEntrySize}
+		}
+
+		var name, value string
+
+		if i := bytes.IndexByte(line, '='); i >= 0 {
+			name, value = string(line[:i]), string(line[i+1:])
+		} else {
+			name = string(line)
+			if value, err = dec.readBinary(dec.maxEntrySize - size); err != nil {
+				return nil, err
+			}
+			size += int64(len(value))
+		}
+
+		if !validExportFieldName(name) {
+			return nil, fmt.Errorf("%w: invalid field name '%.64s'", ErrInvalidExport, name)
+		}
+
+		if err := e.setField(name, value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+
+		fields++
+
+		if err == io.EOF {
+			return e, nil
+		}
+	}
+}
+
+// readBinary reads the size and data of a field in binary form
+func (dec *ExportDecoder) readBinary(max int64) (string, error) {
+
+	var size [8]byte
+	if _, err := io.ReadFull(dec.r, size[:]); err != nil {
+		return "", binaryReadError(err)
+	}
+
+	n := binary.LittleEndian.Uint64(size[:])
+	if n > uint64(max) {
+		return "", &ExportSizeError{Max: dec.maxEntrySize}
+	}
+
+	data := make([]byte, n+1)
+	if _, err := io.ReadFull(dec.r, data); err != nil {
+		return "", binaryReadError(err)
+	}
+
+	if data[n] != '\n' {
+		return "", fmt.Errorf("%w: binary field not terminated by newline", ErrInvalidExport)
+	}
+
+	return string(data[:n]), nil
+}
+
+// binaryReadError returns the error for a failure reading a binary field.
+// Only running out of input makes the field malformed, other errors of
+// the underlying reader are passed on.
+func binaryReadError(err error) error {
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated binary field", ErrInvalidExport)
+	}
+
+	return fmt.Errorf("failed to read entry: %w", err)
+}
+
+// setField sets a field read from the Journal Export Format or JSON
+func (e *Entry) setField(name, value string) error {
+
+	var err error
+
+	switch name {
+	case FieldCursor:
+		e.Cursor, err = ParseCursor(value)
+	case FieldRealtimeTimestamp:
+		var usec uint64
+		if usec, err = strconv.ParseUint(value, 10, 64); err == nil {
+			e.Timestamp = time.Unix(0, int64(usec)*int64(time.Microsecond))
+		}
+	case FieldMonotonicTimestamp:
+		var usec uint64
+		if usec, err = strconv.ParseUint(value, 10, 64); err == nil {
+			// Elapsed holds the monotonic timestamp in microseconds
+			e.Elapsed = time.Duration(usec)
+		}
+	case FieldBootID:
+		if e.bootID, err = ParseID128(value); err == nil {
+			e.Fields[name] = e.bootID.String()
+		}
+	default:
+		if !strings.HasPrefix(name, "__") {
+			e.Fields[name] = value
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// validExportFieldName reports whether name is a valid journal field name
+// consisting of upper-case letters, digits and underscores, not beginning
+// with a digit
+func validExportFieldName(name string) bool {
+
+	if name == "" || len(name) > 64 || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,507 @@
+// +build linux
+
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Offsets within entry and data objects
+const (
+	entryItemsOffset         = 64
+	dataPayloadOffset        = 64
+	dataCompactPayloadOffset = 72
+)
+
+// FileReader reads the entries of a single journal file in pure Go,
+// without opening it through the journal API. Use it to read archived
+// files, e.g. one per machine merged by a MergeReader. The entries are
+// those present when the file was opened, in the order they were
+// written. Fields compressed by journald using LZ4 are decompressed, while
+// fields compressed using XZ or ZSTD are skipped, see Skipped. Matches
+// never match the values of skipped fields.
+type FileReader struct {
+	f      *os.File
+	header *FileHeader
+	// Offsets of the entry objects
+	entries []uint64
+	// Index of the current entry, -1 before the first and len(entries)
+	// after the last
+	pos   int
+	exprs []matchExpr
+	match fileMatch
+	// Fields skipped when the current entry was last read
+	skipped int
+}
+
+// OpenFileReader opens a journal file for reading
+func OpenFileReader(path string) (*FileReader, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal file: %w", err)
+	}
+
+	h, err := readFileHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	known := FileCompressedXZ | FileCompressedLZ4 | FileKeyedHash | FileCompressedZSTD | FileCompact
+	if unknown := h.IncompatibleFlags &^ known; unknown != 0 {
+		f.Close()
+		return nil, fmt.Errorf("unsupported incompatible flags %x of journal file", unknown)
+	}
+
+	r := &FileReader{
+		f:      f,
+		header: h,
+		pos:    -1,
+	}
+
+	if r.entries, err = r.readEntryArrays(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close closes the file
+func (r *FileReader) Close() {
+	r.f.Close()
+}
+
+// Header returns the header of the file
+func (r *FileReader) Header() *FileHeader {
+	return r.header
+}
+
+// AddMatch adds a match expression. Matches are combined in the same way
+// as by Journal.AddMatch.
+func (r *FileReader) AddMatch(m *Match) error {
+
+	if m == nil || len(m.expr) == 0 {
+		return errors.New("no match expression to add")
+	}
+
+	r.exprs = append(r.exprs, m.expr...)
+	r.match = newFileMatch(r.exprs)
+
+	return nil
+}
+
+// FlushMatches removes all matches
+func (r *FileReader) FlushMatches() {
+	r.exprs = nil
+	r.match = nil
+}
+
+// Next moves to the next entry matching the matches added and returns 0
+// if there are no more entries
+func (r *FileReader) Next() (int, error) {
+	return r.move(1)
+}
+
+// Previous moves to the previous entry matching the matches added and
+// returns 0 if there are no more entries
+func (r *FileReader) Previous() (int, error) {
+	return r.move(-1)
+}
+
+// SeekHead moves before the first entry
+func (r *FileReader) SeekHead() error {
+	r.pos = -1
+	return nil
+}
+
+// SeekTail moves after the last entry
+func (r *FileReader) SeekTail() error {
+	r.pos = len(r.entries)
+	return nil
+}
+
+// SeekCursor moves before the entry of the cursor, or before the first
+// entry after it if there is no such entry in the file. Entries are
+// located by sequence number if the cursor is from the sequence number
+// space of the file and by realtime timestamp otherwise.
+// NOTE: This call must be followed by a call to Next before any data
+// can be read
+func (r *FileReader) SeekCursor(c Cursor) error {
+
+	if c.IsZero() {
+		return errors.New("no cursor to seek to")
+	}
+
+	bySeqnum := c.SeqnumID() == r.header.SeqnumID && c.has&cursorHasSeqnum != 0
+	if !bySeqnum && c.has&cursorHasRealtime == 0 {
+		return fmt.Errorf("cursor '%s' has neither sequence number nor timestamp", c)
+	}
+
+	var err error
+
+	i := sort.Search(len(r.entries), func(i int) bool {
+		if err != nil {
+			return true
+		}
+
+		var buf []byte
+		if buf, err = r.readObject(r.entries[i], objectEntry, entryItemsOffset); err != nil {
+			return true
+		}
+
+		if bySeqnum {
+			return binary.LittleEndian.Uint64(buf[16:]) >= c.Seqnum()
+		}
+
+		return binary.LittleEndian.Uint64(buf[24:]) >= c.realtime
+	})
+
+	if err != nil {
+		return err
+	}
+
+	r.pos = i - 1
+
+	return nil
+}
+
+// Skipped returns the number of fields left out of the entry last read
+// by ReadEntry because they are compressed using XZ or ZSTD, which
+// FileReader cannot decompress. Their names are compressed as well.
+func (r *FileReader) Skipped() int {
+	return r.skipped
+}
+
+// Cursor returns the cursor of the current entry
+func (r *FileReader) Cursor() (Cursor, error) {
+
+	buf, err := r.current()
+	if err != nil {
+		return Cursor{}, err
+	}
+
+	return r.cursor(buf)
+}
+
+// ReadEntry reads the current entry
+func (r *FileReader) ReadEntry() (*Entry, error) {
+
+	r.skipped = 0
+
+	buf, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.cursor(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+
+	entry := &Entry{
+		Fields:    Fields{},
+		Cursor:    cursor,
+		Timestamp: usecToTime(le.Uint64(buf[24:])),
+		Elapsed:   time.Duration(le.Uint64(buf[32:])),
+		bootID:    ID128(hex.EncodeToString(buf[40:56])),
+	}
+
+	r.skipped, err = r.eachField(buf, func(name, value []byte) bool {
+		entry.Fields[string(name)] = string(value)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// move moves n entries forward or back until an entry matches
+func (r *FileReader) move(n int) (int, error) {
+
+	for {
+		r.pos += n
+
+		if r.pos < 0 {
+			r.pos = -1
+			return 0, nil
+		}
+		if r.pos >= len(r.entries) {
+			r.pos = len(r.entries)
+			return 0, nil
+		}
+
+		if r.match == nil {
+			return 1, nil
+		}
+
+		buf, err := r.current()
+		if err != nil {
+			return 0, err
+		}
+
+		values := map[string][]string{}
+
+		_, err = r.eachField(buf, func(name, value []byte) bool {
+			if r.match.uses(string(name)) {
+				values[string(name)] = append(values[string(name)], string(value))
+			}
+			return true
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if r.match.matches(values) {
+			return 1, nil
+		}
+	}
+}
+
+// current reads the entry object at the current position
+func (r *FileReader) current() ([]byte, error) {
+
+	if r.pos < 0 || r.pos >= len(r.entries) {
+		return nil, fmt.Errorf("failed to read entry: %w", syscall.EADDRNOTAVAIL)
+	}
+
+	return r.readObject(r.entries[r.pos], objectEntry, entryItemsOffset)
+}
+
+func (r *FileReader) cursor(buf []byte) (Cursor, error) {
+
+	le := binary.LittleEndian
+
+	return ParseCursor(fmt.Sprintf("s=%s;i=%x;b=%s;m=%x;t=%x;x=%x",
+		r.header.SeqnumID, le.Uint64(buf[16:]), ID128(hex.EncodeToString(buf[40:56])),
+		le.Uint64(buf[32:]), le.Uint64(buf[24:]), le.Uint64(buf[56:])))
+}
+
+// eachField calls fn with the name and value of each field of an entry
+// object until fn returns false and returns the number of fields skipped
+// as they cannot be decompressed
+func (r *FileReader) eachField(entry []byte, fn func(name, value []byte) bool) (int, error) {
+
+	skipped := 0
+
+	compact := r.header.IncompatibleFlags&FileCompact != 0
+
+	itemSize, payload := 16, dataPayloadOffset
+	if compact {
+		itemSize, payload = 4, dataCompactPayloadOffset
+	}
+
+	for i := entryItemsOffset; i+itemSize <= len(entry); i += itemSize {
+		var offset uint64
+		if compact {
+			offset = uint64(binary.LittleEndian.Uint32(entry[i:]))
+		} else {
+			offset = binary.LittleEndian.Uint64(entry[i:])
+		}
+
+		data, err := r.readObject(offset, objectData, payload)
+		if err != nil {
+			return skipped, err
+		}
+
+		field := data[payload:]
+
+		switch flags := data[1]; {
+		case flags&objectCompressedLZ4 != 0:
+			if field, err = decompressLZ4(field); err != nil {
+				return skipped, fmt.Errorf("failed to decompress field at offset %d: %w", offset, err)
+			}
+		case flags&(objectCompressedXZ|objectCompressedZSTD) != 0:
+			skipped++
+			continue
+		}
+
+		idx := bytes.IndexByte(field, '=')
+		if idx < 0 {
+			return skipped, fmt.Errorf("failed to parse field at offset %d", offset)
+		}
+
+		if !fn(field[:idx], field[idx+1:]) {
+			break
+		}
+	}
+
+	return skipped, nil
+}
+
+// readEntryArrays returns the offsets of all entry objects by following
+// the chain of entry arrays
+func (r *FileReader) readEntryArrays() ([]uint64, error) {
+
+	var (
+		entries = make([]uint64, 0, r.header.NEntries)
+		offset  = r.header.EntryArrayOffset
+		seen    = map[uint64]bool{}
+	)
+
+	itemSize := 8
+	if r.header.IncompatibleFlags&FileCompact != 0 {
+		itemSize = 4
+	}
+
+	for offset != 0 && uint64(len(entries)) < r.header.NEntries {
+		if seen[offset] {
+			return nil, fmt.Errorf("entry array loop at offset %d", offset)
+		}
+		seen[offset] = true
+
+		buf, err := r.readObject(offset, objectEntryArray, objectHeaderSize+8)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := objectHeaderSize + 8; i+itemSize <= len(buf); i += itemSize {
+			var item uint64
+			if itemSize == 4 {
+				item = uint64(binary.LittleEndian.Uint32(buf[i:]))
+			} else {
+				item = binary.LittleEndian.Uint64(buf[i:])
+			}
+
+			if item == 0 || uint64(len(entries)) >= r.header.NEntries {
+				break
+			}
+
+			entries = append(entries, item)
+		}
+
+		offset = binary.LittleEndian.Uint64(buf[objectHeaderSize:])
+	}
+
+	return entries, nil
+}
+
+// readObject reads an object of the given type at offset, which must
+// be at least min bytes
+func (r *FileReader) readObject(offset uint64, typ uint8, min int) ([]byte, error) {
+
+	end := r.header.HeaderSize + r.header.ArenaSize
+
+	if offset < r.header.HeaderSize || offset+objectHeaderSize > end || offset%8 != 0 {
+		return nil, fmt.Errorf("invalid object offset %d", offset)
+	}
+
+	var head [objectHeaderSize]byte
+	if _, err := r.f.ReadAt(head[:], int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read object at offset %d: %w", offset, err)
+	}
+
+	size := binary.LittleEndian.Uint64(head[8:])
+
+	if head[0] != typ {
+		return nil, fmt.Errorf("unexpected type %d of object at offset %d", head[0], offset)
+	}
+	if size < uint64(min) || offset+size > end {
+		return nil, fmt.Errorf("invalid size %d of object at offset %d", size, offset)
+	}
+
+	buf := make([]byte, size)
+	if _, err := r.f.ReadAt(buf, int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read object at offset %d: %w", offset, err)
+	}
+
+	return buf, nil
+}
+
+// fileMatch evaluates match expressions like the journal does. Values of
+// the same field match OR-like and different fields AND-like within a
+// term. Terms separated by Or are ORed and groups of terms separated by
+// And are ANDed.
+type fileMatch [][]map[string][]string
+
+func newFileMatch(exprs []matchExpr) fileMatch {
+
+	m := fileMatch{{{}}}
+
+	for _, expr := range exprs {
+		group := m[len(m)-1]
+		term := group[len(group)-1]
+
+		switch expr.op {
+		case matchOpField:
+			term[expr.field] = append(term[expr.field], expr.values...)
+		case matchOpOr:
+			m[len(m)-1] = append(group, map[string][]string{})
+		case matchOpAnd:
+			m = append(m, []map[string][]string{{}})
+		}
+	}
+
+	return m
+}
+
+// uses reports whether the match depends on a field
+func (m fileMatch) uses(name string) bool {
+
+	for _, group := range m {
+		for _, term := range group {
+			if _, ok := term[name]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matches reports whether an entry with the given field values matches
+func (m fileMatch) matches(values map[string][]string) bool {
+
+	for _, group := range m {
+		matched, empty := false, true
+
+		for _, term := range group {
+			if len(term) == 0 {
+				continue
+			}
+
+			empty = false
+
+			if termMatches(term, values) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched && !empty {
+			return false
+		}
+	}
+
+	return true
+}
+
+func termMatches(term map[string][]string, values map[string][]string) bool {
+
+next:
+	for field, want := range term {
+		for _, v := range values[field] {
+			for _, w := range want {
+				if v == w {
+					continue next
+				}
+			}
+		}
+		return false
+	}
+
+	return true
+}
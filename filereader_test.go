@@ -0,0 +1,277 @@
+// +build linux
+
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFileReader(t *testing.T) {
+
+	path, remove := fixture(t, "entries.journal")
+	defer remove()
+
+	j, err := OpenFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	r, err := OpenFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	want := readAll(t, j, j.ReadEntry)
+
+	if err := r.AddMatch(NewMatch().Match(FieldSyslogIdentifier, "fixture")); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*Entry
+
+	for {
+		n, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+
+		e, err := r.ReadEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(got))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("entry %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+
+	// Seeking to a cursor moves before its entry
+	if err := r.SeekCursor(want[1].Cursor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := r.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != want[1].Cursor {
+		t.Errorf("expected cursor %s after seeking, got %s", want[1].Cursor, c)
+	}
+
+	if n, err := r.Previous(); err != nil || n != 1 {
+		t.Fatalf("expected previous entry, got %d, %v", n, err)
+	}
+	if c, _ := r.Cursor(); c != want[0].Cursor {
+		t.Errorf("expected cursor %s of previous entry, got %s", want[0].Cursor, c)
+	}
+}
+
+// compressField rewrites the data object of a field of the first entry
+// of a journal file as compressed with the given object flags, replacing
+// the payload by the one returned by compress. The object is appended to
+// the file and the entry pointed to it.
+func compressField(t *testing.T, path, name string, flags uint8, compress func(field []byte) []byte) {
+
+	t.Helper()
+
+	r, err := OpenFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	entry, err := r.readObject(r.entries[0], objectEntry, entryItemsOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	itemSize, payload := 16, dataPayloadOffset
+	if r.header.IncompatibleFlags&FileCompact != 0 {
+		itemSize, payload = 4, dataCompactPayloadOffset
+	}
+
+	info, err := r.f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := uint64(info.Size()+7) &^ 7
+
+	le := binary.LittleEndian
+
+	for i := entryItemsOffset; i+itemSize <= len(entry); i += itemSize {
+		var offset uint64
+		if itemSize == 4 {
+			offset = uint64(le.Uint32(entry[i:]))
+		} else {
+			offset = le.Uint64(entry[i:])
+		}
+
+		data, err := r.readObject(offset, objectData, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data[payload:], []byte(name+"=")) {
+			continue
+		}
+
+		obj := append(append([]byte{}, data[:payload]...), compress(data[payload:])...)
+		obj[1] = flags
+		le.PutUint64(obj[8:], uint64(len(obj)))
+		obj = append(obj, make([]byte, (8-len(obj)%8)%8)...)
+
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		// The new object, the arena size and the entry item pointing to it
+		arena := make([]byte, 8)
+		le.PutUint64(arena, end+uint64(len(obj))-r.header.HeaderSize)
+		item := make([]byte, 8)
+		le.PutUint64(item, end)
+		if itemSize == 4 {
+			item = item[:4]
+		}
+
+		writes := []struct {
+			b   []byte
+			off uint64
+		}{
+			{obj, end},
+			{arena, 96},
+			{item, r.entries[0] + uint64(i)},
+		}
+
+		for _, w := range writes {
+			if _, err := f.WriteAt(w.b, int64(w.off)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return
+	}
+
+	t.Fatalf("no field %s in first entry", name)
+}
+
+func TestFileReaderCompressed(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		flags    uint8
+		compress func(field []byte) []byte
+		skipped  int
+	}{
+		{"lz4", objectCompressedLZ4, lz4Literals, 0},
+		{"xz", objectCompressedXZ, func([]byte) []byte { return []byte("\xfd7zXZ\x00") }, 1},
+		{"zstd", objectCompressedZSTD, func([]byte) []byte { return []byte("\x28\xb5\x2f\xfd") }, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, remove := fixture(t, "entries.journal")
+			defer remove()
+
+			r, err := OpenFileReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Next(); err != nil {
+				t.Fatal(err)
+			}
+			want, err := r.ReadEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Close()
+
+			compressField(t, path, FieldMessage, test.flags, test.compress)
+
+			if r, err = OpenFileReader(path); err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			if test.skipped > 0 {
+				delete(want.Fields, FieldMessage)
+			}
+
+			// The entry is read and matched on its remaining fields
+			if err := r.AddMatch(NewMatch().Match(FieldSyslogIdentifier, want.Fields[FieldSyslogIdentifier])); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Next(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := r.ReadEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+			if r.Skipped() != test.skipped {
+				t.Errorf("expected %d skipped fields, got %d", test.skipped, r.Skipped())
+			}
+
+			// Reading goes on past the entry
+			if n, err := r.Next(); err != nil || n != 1 {
+				t.Fatalf("expected next entry, got %d, %v", n, err)
+			}
+			if _, err := r.ReadEntry(); err != nil || r.Skipped() != 0 {
+				t.Errorf("expected entry without skipped fields, got %d, %v", r.Skipped(), err)
+			}
+		})
+	}
+}
+
+func TestFileMatch(t *testing.T) {
+
+	values := map[string][]string{
+		"A": {"1"},
+		"B": {"2", "3"},
+	}
+
+	tests := []struct {
+		name  string
+		match *Match
+		want  bool
+	}{
+		{"field", NewMatch().Match("A", "1"), true},
+		{"value", NewMatch().Match("A", "2"), false},
+		{"values", NewMatch().Match("A", "2", "1"), true},
+		{"repeated field", NewMatch().Match("B", "3"), true},
+		{"fields", NewMatch().Match("A", "1").Match("B", "4"), false},
+		{"missing", NewMatch().Match("C", "1"), false},
+		{"or", NewMatch().Match("C", "1").Or().Match("A", "1"), true},
+		{"and", NewMatch().Match("A", "1").And().Match("C", "1"), false},
+		{"and of or", NewMatch().Match("C", "1").Or().Match("B", "2").And().Match("A", "1"), true},
+	}
+
+	for _, test := range tests {
+		if got := newFileMatch(test.match.expr).matches(values); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -65,7 +65,7 @@ func (j *Journal) Follow(h FollowHandler) (FollowStop, error) {
 	done := make(chan bool, 1)
 	once := sync.Once{}
 
-	go followJournal(h, done, cursor, j.matches, eof)
+	go followJournal(h, done, cursor, j.open, j.matches, eof)
 
 	return func() {
 		once.Do(func() {
@@ -74,9 +74,10 @@ func (j *Journal) Follow(h FollowHandler) (FollowStop, error) {
 	}, nil
 }
 
-func followJournal(h FollowHandler, done <-chan bool, cursor string, matches []*Match, eof bool) {
+func followJournal(h FollowHandler, done <-chan bool, cursor Cursor,
+	open func() (*Journal, error), matches []*Match, eof bool) {
 
-	jour, err := Open()
+	jour, err := open()
 	if err != nil {
 		h(nil, err)
 		return
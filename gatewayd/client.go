@@ -0,0 +1,544 @@
+// +build linux
+
+package gatewayd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Position of a Client relative to the entries
+type clientSeek int
+
+const (
+	// Before the first entry
+	seekHead clientSeek = iota
+	// After the last entry
+	seekTail
+	// At the entry of a cursor, which the next entry returned is
+	seekCursor
+	// At the current entry
+	seekEntry
+)
+
+// ClientConfig configures a Client
+type ClientConfig struct {
+	// URL of the systemd-journal-gatewayd service, e.g.
+	// "http://device.example.com:19531"
+	URL string
+	// Client is used for requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// PageSize is the number of entries fetched per request when moving
+	// forward. Defaults to 100.
+	PageSize int
+}
+
+// Client reads a journal served by systemd-journal-gatewayd or Handler.
+// It implements journal.Reader and journal.Follower and moves through
+// the entries like Journal does.
+type Client struct {
+	cfg     ClientConfig
+	url     string
+	matches url.Values
+
+	seek    clientSeek
+	cursor  journal.Cursor
+	current *journal.Entry
+	// Entries fetched ahead of the current entry
+	page  []*journal.Entry
+	mutex sync.Mutex
+}
+
+// NewClient creates a Client positioned before the first entry
+func NewClient(cfg ClientConfig) (*Client, error) {
+
+	if cfg.URL == "" {
+		return nil, errors.New("a gatewayd URL must be provided")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 100
+	}
+
+	return &Client{
+		cfg:     cfg,
+		url:     strings.TrimSuffix(cfg.URL, "/"),
+		matches: url.Values{},
+	}, nil
+}
+
+// AddMatch adds a match expression. Expressions using Or are not
+// supported by the gatewayd API. Matches apply from the next entry read.
+func (c *Client) AddMatch(m *journal.Match) error {
+
+	if m == nil {
+		return errors.New("no match expression to add")
+	}
+
+	fields, err := m.Fields()
+	if err != nil {
+		return fmt.Errorf("failed to add match: %w", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for name, values := range fields {
+		for _, v := range values {
+			c.matches.Add(name, v)
+		}
+	}
+
+	c.page = nil
+
+	return nil
+}
+
+// FlushMatches removes all matches
+func (c *Client) FlushMatches() {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.matches = url.Values{}
+	c.page = nil
+}
+
+// SeekHead moves before the first entry
+func (c *Client) SeekHead() error {
+	c.setSeek(seekHead, journal.Cursor{})
+	return nil
+}
+
+// SeekTail moves after the last entry
+func (c *Client) SeekTail() error {
+	c.setSeek(seekTail, journal.Cursor{})
+	return nil
+}
+
+// SeekCursor moves to the entry of a cursor, which is returned by the
+// next call to Next
+func (c *Client) SeekCursor(cursor journal.Cursor) error {
+
+	if cursor.IsZero() {
+		return errors.New("failed to seek to cursor: empty cursor")
+	}
+
+	c.setSeek(seekCursor, cursor)
+
+	return nil
+}
+
+func (c *Client) setSeek(seek clientSeek, cursor journal.Cursor) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.seek = seek
+	c.cursor = cursor
+	c.current = nil
+	c.page = nil
+}
+
+// Next moves to the next entry and returns 0 if there are none
+func (c *Client) Next() (int, error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.page) == 0 {
+		var spec string
+
+		switch c.seek {
+		case seekHead:
+			spec = fmt.Sprintf("entries=:0:%d", c.cfg.PageSize)
+		case seekCursor:
+			spec = fmt.Sprintf("entries=%s:0:%d", c.cursor, c.cfg.PageSize)
+		case seekEntry:
+			spec = fmt.Sprintf("entries=%s:1:%d", c.cursor, c.cfg.PageSize)
+		case seekTail:
+			last, err := c.last(context.Background())
+			if err != nil {
+				return 0, err
+			}
+			if last == nil {
+				// Empty journal, continue from the head
+				c.seek = seekHead
+				return 0, nil
+			}
+			c.seek = seekEntry
+			c.cursor = last.Cursor
+			spec = fmt.Sprintf("entries=%s:1:%d", c.cursor, c.cfg.PageSize)
+		}
+
+		page, err := c.fetch(context.Background(), spec)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(page) == 0 {
+			return 0, nil
+		}
+
+		c.page = page
+	}
+
+	c.current = c.page[0]
+	c.page = c.page[1:]
+	c.seek = seekEntry
+	c.cursor = c.current.Cursor
+
+	return 1, nil
+}
+
+// Previous moves to the previous entry and returns 0 if there are none
+func (c *Client) Previous() (int, error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var (
+		entry *journal.Entry
+		err   error
+	)
+
+	switch c.seek {
+	case seekHead:
+		return 0, nil
+	case seekTail:
+		entry, err = c.last(context.Background())
+	case seekCursor:
+		// The entry of the cursor itself, as with Journal
+		entry, err = c.first(context.Background(), fmt.Sprintf("entries=%s:0:1", c.cursor))
+	case seekEntry:
+		// Skipping back one entry from a cursor returns the entry before it
+		entry, err = c.first(context.Background(), fmt.Sprintf("entries=%s:-1:1", c.cursor))
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Skipping back from the first entry ends at the first entry
+	if entry == nil || (c.seek == seekEntry && entry.Cursor == c.cursor) {
+		return 0, nil
+	}
+
+	c.current = entry
+	c.page = nil
+	c.seek = seekEntry
+	c.cursor = c.current.Cursor
+
+	return 1, nil
+}
+
+// Skip moves n entries forward, or back if n is negative, and returns
+// the number of entries moved
+func (c *Client) Skip(n int64) (int64, error) {
+
+	var moved int64
+
+	for moved < n || moved < -n {
+		var (
+			ret int
+			err error
+		)
+
+		if n > 0 {
+			ret, err = c.Next()
+		} else {
+			ret, err = c.Previous()
+		}
+
+		if err != nil || ret == 0 {
+			return moved, err
+		}
+
+		moved++
+	}
+
+	return moved, nil
+}
+
+// ReadEntry returns the entry at the current position
+func (c *Client) ReadEntry() (*journal.Entry, error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current == nil {
+		return nil, fmt.Errorf("failed to read entry: %w", syscall.EADDRNOTAVAIL)
+	}
+
+	return c.current, nil
+}
+
+// Cursor returns the cursor of the current entry
+func (c *Client) Cursor() (journal.Cursor, error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.current == nil {
+		return journal.Cursor{}, fmt.Errorf("failed to get cursor: %w", syscall.EADDRNOTAVAIL)
+	}
+
+	return c.current.Cursor, nil
+}
+
+// Follow reads entries from the current entry or the cursor sought, or
+// else after the last entry, and calls h for each entry as entries are
+// written.
+// Entries are streamed using server-sent events.
+func (c *Client) Follow(h journal.FollowHandler) (journal.FollowStop, error) {
+
+	if h == nil {
+		return nil, errors.New("a follow handler must be provided")
+	}
+
+	c.mutex.Lock()
+
+	var spec string
+
+	switch c.seek {
+	case seekEntry, seekCursor:
+		spec = fmt.Sprintf("entries=%s", c.cursor)
+	default:
+		last, err := c.last(context.Background())
+		if err != nil {
+			c.mutex.Unlock()
+			return nil, err
+		}
+		// A range without a count needs both colons, "entries=CURSOR:N"
+		// means N entries from CURSOR to gatewayd
+		spec = "entries=:0:"
+		if last != nil {
+			spec = fmt.Sprintf("entries=%s:1:", last.Cursor)
+		}
+	}
+
+	// The follow parameter is sent without a value
+	query := "follow"
+	if len(c.matches) > 0 {
+		query = c.matches.Encode() + "&follow"
+	}
+
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	resp, err := c.get(ctx, "/entries", query, spec, ContentTypeEventStream)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		defer resp.Body.Close()
+
+		err := readEvents(resp.Body, func(data string) error {
+			e, err := journal.NewJSONDecoder(strings.NewReader(data)).Decode()
+			if err != nil {
+				return err
+			}
+			h(e, nil)
+			return nil
+		})
+
+		if ctx.Err() != nil {
+			h(nil, journal.ErrFollowStopped)
+			return
+		}
+
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+
+		h(nil, fmt.Errorf("failed to follow entries: %w", err))
+	}()
+
+	return func() {
+		cancel()
+	}, nil
+}
+
+// Machine returns information about the machine serving the journal
+func (c *Client) Machine() (*Machine, error) {
+
+	resp, err := c.get(context.Background(), "/machine", "", "", ContentTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	m := &Machine{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to decode machine information: %w", err)
+	}
+
+	return m, nil
+}
+
+// UniqueValues returns all unique values of a field
+func (c *Client) UniqueValues(field string) ([]string, error) {
+
+	resp, err := c.get(context.Background(), "/fields/"+url.PathEscape(field), "", "", ContentTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var values []string
+
+	dec := journal.NewJSONDecoder(resp.Body)
+	for {
+		e, err := dec.Decode()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if v, ok := e.Fields[field]; ok {
+			values = append(values, v)
+		}
+	}
+}
+
+// Close releases idle connections of the client
+func (c *Client) Close() {
+	c.cfg.Client.CloseIdleConnections()
+}
+
+// first reads the first entry of a range, or nil if there is none.
+// NOTE: The caller must hold the mutex.
+func (c *Client) first(ctx context.Context, spec string) (*journal.Entry, error) {
+
+	entries, err := c.fetch(ctx, spec)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	return entries[0], nil
+}
+
+// last reads the last entry, or nil if there is none. Skipping back one
+// entry from the tail moves to the entry before the last one, so the
+// last two entries are read.
+// NOTE: The caller must hold the mutex.
+func (c *Client) last(ctx context.Context) (*journal.Entry, error) {
+
+	entries, err := c.fetch(ctx, "entries=:-1:2")
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	return entries[len(entries)-1], nil
+}
+
+// fetch reads the entries of a range.
+// NOTE: The caller must hold the mutex.
+func (c *Client) fetch(ctx context.Context, spec string) ([]*journal.Entry, error) {
+
+	resp, err := c.get(ctx, "/entries", c.matches.Encode(), spec, ContentTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var entries []*journal.Entry
+
+	dec := journal.NewJSONDecoder(resp.Body)
+	for {
+		e, err := dec.Decode()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entries: %w", err)
+		}
+
+		entries = append(entries, e)
+	}
+}
+
+// get sends a request and returns the response if successful
+func (c *Client) get(ctx context.Context, path, query, spec, accept string) (*http.Response, error) {
+
+	u := c.url + path
+	if query != "" {
+		u += "?" + query
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", accept)
+	if spec != "" {
+		req.Header.Set("Range", spec)
+	}
+
+	resp, err := c.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request %s: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to request %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// readEvents reads server-sent events and calls fn with the data of
+// each event until r ends or fn fails
+func readEvents(r io.Reader, fn func(data string) error) error {
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 64<<20)
+
+	var data []string
+
+	for s.Scan() {
+		line := s.Text()
+
+		if line == "" {
+			if len(data) > 0 {
+				if err := fn(strings.Join(data, "\n")); err != nil {
+					return err
+				}
+				data = data[:0]
+			}
+			continue
+		}
+
+		if v := strings.TrimPrefix(line, "data:"); v != line {
+			data = append(data, strings.TrimPrefix(v, " "))
+		}
+	}
+
+	return s.Err()
+}
@@ -0,0 +1,401 @@
+// +build linux
+
+package gatewayd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// newFixtureClient returns a Client reading the fixture entries from a
+// Handler along with a function closing both
+func newFixtureClient(t testing.TB, pageSize int) (*Client, func()) {
+
+	t.Helper()
+
+	h, remove := newFixtureHandler(t)
+	s := httptest.NewServer(h)
+
+	c, err := NewClient(ClientConfig{URL: s.URL, PageSize: pageSize})
+	if err != nil {
+		s.Close()
+		remove()
+		t.Fatal(err)
+	}
+
+	done := func() {
+		c.Close()
+		s.Close()
+		remove()
+	}
+
+	if err := c.AddMatch(journal.NewMatch().Match(journal.FieldSyslogIdentifier, "fixture")); err != nil {
+		done()
+		t.Fatal(err)
+	}
+
+	return c, done
+}
+
+func TestClientMoves(t *testing.T) {
+
+	c, done := newFixtureClient(t, 2)
+	defer done()
+
+	var cursors []journal.Cursor
+	for {
+		n, err := c.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		cursor, err := c.Cursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursors = append(cursors, cursor)
+	}
+
+	if len(cursors) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(cursors))
+	}
+
+	tests := []struct {
+		name string
+		seek func() error
+		// Moves by Next (+) and Previous (-) after seeking
+		moves string
+		want  string
+	}{
+		{"head", c.SeekHead, "+++", "1 3 5"},
+		{"head previous", c.SeekHead, "-", ""},
+		{"tail next", c.SeekTail, "+", ""},
+		{"tail previous", c.SeekTail, "--", "7 5"},
+		{"cursor next", func() error { return c.SeekCursor(cursors[1]) }, "++", "3 5"},
+		{"cursor previous", func() error { return c.SeekCursor(cursors[1]) }, "--", "3 1"},
+		{"back and forth", c.SeekHead, "+++-+", "1 3 5 3 5"},
+		{"past the first", c.SeekHead, "++--", "1 3 1"},
+	}
+
+	for _, test := range tests {
+		if err := test.seek(); err != nil {
+			t.Fatal(err)
+		}
+
+		var seqs []string
+
+		for _, m := range test.moves {
+			move := c.Next
+			if m == '-' {
+				move = c.Previous
+			}
+
+			n, err := move()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n == 0 {
+				continue
+			}
+
+			e, err := c.ReadEntry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			seqs = append(seqs, e.Fields["SEQ"])
+		}
+
+		if got := strings.Join(seqs, " "); got != test.want {
+			t.Errorf("%s: expected entries [%s], got [%s]", test.name, test.want, got)
+		}
+	}
+}
+
+func TestClientFollow(t *testing.T) {
+
+	c, done := newFixtureClient(t, 100)
+	defer done()
+
+	// Following starts from the entry moved to
+	if _, err := c.Skip(3); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan string, 10)
+
+	stop, err := c.Follow(func(e *journal.Entry, err error) {
+		if err != nil {
+			if err == journal.ErrFollowStopped {
+				got <- "stopped"
+			} else {
+				got <- err.Error()
+			}
+			return
+		}
+		got <- e.Fields["SEQ"]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seqs []string
+
+	for len(seqs) < 3 {
+		if len(seqs) == 2 {
+			stop()
+		}
+
+		select {
+		case s := <-got:
+			seqs = append(seqs, s)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %v", seqs)
+		}
+	}
+
+	if s := strings.Join(seqs, " "); s != "5 7 stopped" {
+		t.Errorf("expected [5 7 stopped], got [%s]", s)
+	}
+}
+
+// replayServer serves the responses of systemd-journal-gatewayd in
+// testdata to the requests a Client sends. Range headers may refer to
+// entries by number, e.g. "entries=<2>:1:2" for the cursor of entry 2.
+func replayServer(t *testing.T, cursors map[string]string, responses map[string]string) *httptest.Server {
+
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		spec := r.Header.Get("Range")
+		for n, c := range cursors {
+			spec = strings.Replace(spec, c, "<"+n+">", 1)
+		}
+
+		key := r.Header.Get("Accept") + " " + spec
+		if r.URL.Query()["follow"] != nil {
+			key += " follow"
+		}
+
+		name, ok := responses[key]
+		if !ok {
+			t.Errorf("unexpected request %s", key)
+			http.Error(w, "Unexpected request.", http.StatusBadRequest)
+			return
+		}
+
+		var body []byte
+		if name != "" {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Error(err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			body = b
+		}
+
+		w.Header().Set("Content-Type", r.Header.Get("Accept"))
+		w.Write(body)
+
+		// gatewayd keeps following until the client disconnects
+		if strings.HasSuffix(key, " follow") {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+}
+
+// replayCursors returns the cursors of the entries in testdata by number
+func replayCursors(t *testing.T) map[string]string {
+
+	t.Helper()
+
+	cursors := map[string]string{}
+
+	for _, name := range []string{"range-head.json", "range-next.json"} {
+		f, err := os.Open(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec := journal.NewJSONDecoder(f)
+		for {
+			e, err := dec.Decode()
+			if err != nil {
+				break
+			}
+			cursors[strconv.Itoa(len(cursors)+1)] = e.Cursor.String()
+		}
+
+		f.Close()
+	}
+
+	if len(cursors) != 3 {
+		t.Fatalf("expected 3 cursors, got %d", len(cursors))
+	}
+
+	return cursors
+}
+
+func TestClientReplayRange(t *testing.T) {
+
+	s := replayServer(t, replayCursors(t), map[string]string{
+		ContentTypeJSON + " entries=:0:2":    "range-head.json",
+		ContentTypeJSON + " entries=<2>:1:2": "range-next.json",
+		ContentTypeJSON + " entries=<3>:1:2": "",
+	})
+	defer s.Close()
+
+	c, err := NewClient(ClientConfig{URL: s.URL, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var entries []*journal.Entry
+	for {
+		n, err := c.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+
+		e, err := c.ReadEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	tests := []struct {
+		entry int
+		field string
+		value string
+	}{
+		{0, journal.FieldMessage, "Listening on :8080"},
+		{0, journal.FieldUnit, "app.service"},
+		{1, journal.FieldMessage, "Request failed:\n\ttimeout"},
+		{1, "DUP", "a"},
+		{2, "BINARY", "a\x00b\xff"},
+	}
+
+	for _, test := range tests {
+		if v := entries[test.entry].Fields[test.field]; v != test.value {
+			t.Errorf("entry %d: expected %s=%q, got %q", test.entry+1, test.field, test.value, v)
+		}
+	}
+
+	e := entries[0]
+	if ts := e.Timestamp.UnixNano() / int64(time.Microsecond); ts != 1672531200123456 {
+		t.Errorf("unexpected realtime timestamp %d", ts)
+	}
+	if e.Cursor.Seqnum() != 0x1a2b0 || e.Cursor.Realtime() != e.Timestamp {
+		t.Errorf("unexpected cursor %s", e.Cursor)
+	}
+	if bootID, err := e.BootID(); err != nil || bootID != "9d1b2c3a4e5f40718293a4b5c6d7e8f9" {
+		t.Errorf("unexpected boot ID %s (%v)", bootID, err)
+	}
+}
+
+func TestClientReplayFollow(t *testing.T) {
+
+	s := replayServer(t, replayCursors(t), map[string]string{
+		ContentTypeJSON + " entries=:-1:2":                "range-last.json",
+		ContentTypeEventStream + " entries=<3>:1: follow": "follow.sse",
+	})
+	defer s.Close()
+
+	c, err := NewClient(ClientConfig{URL: s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.SeekTail(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan *journal.Entry, 10)
+	stopped := make(chan error, 1)
+
+	stop, err := c.Follow(func(e *journal.Entry, err error) {
+		if err != nil {
+			stopped <- err
+			return
+		}
+		got <- e
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for len(messages) < 2 {
+		select {
+		case e := <-got:
+			messages = append(messages, e.Fields[journal.FieldMessage])
+			if e.Cursor.IsZero() {
+				t.Errorf("entry %s without cursor", e.Fields[journal.FieldMessage])
+			}
+			if _, ok := e.Fields["LARGE"]; ok {
+				t.Error("expected field with null value to be left out")
+			}
+		case err := <-stopped:
+			t.Fatalf("follow ended early: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %v", messages)
+		}
+	}
+
+	if s := strings.Join(messages, "|"); s != "Shutting down|Stopped" {
+		t.Errorf("expected [Shutting down|Stopped], got [%s]", s)
+	}
+
+	stop()
+
+	select {
+	case err := <-stopped:
+		if err != journal.ErrFollowStopped {
+			t.Errorf("expected ErrFollowStopped, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for follow to stop")
+	}
+}
+
+func BenchmarkClientNext(b *testing.B) {
+
+	c, done := newFixtureClient(b, 100)
+	defer done()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n, err := c.Next()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n == 0 {
+			c.SeekHead()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// +build linux
+
+package gatewayd
+
+import (
+	"bufio"
+	"strings"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// newEntryWriter returns a function writing entries to w in the format
+// of a content type
+func newEntryWriter(w *bufio.Writer, contentType string) func(e *journal.Entry) error {
+
+	switch contentType {
+	case ContentTypeJSON:
+		return journal.NewJSONEncoder(w).Encode
+	case ContentTypeExport:
+		return journal.NewExportEncoder(w).Encode
+	case ContentTypeEventStream:
+		enc := journal.NewJSONEncoder(w)
+		return func(e *journal.Entry) error {
+			w.WriteString("data: ")
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			return w.WriteByte('\n')
+		}
+	default:
+		return func(e *journal.Entry) error {
+			_, err := w.WriteString(formatShort(e))
+			return err
+		}
+	}
+}
+
+// formatShort formats an entry like journalctl -o short, i.e.
+// "Jan 02 15:04:05 host identifier[pid]: message". Continuation lines of
+// the message are indented to align with the first line.
+func formatShort(e *journal.Entry) string {
+
+	var b strings.Builder
+
+	t, err := e.SourceTime()
+	if err != nil {
+		t = e.Timestamp
+	}
+
+	b.WriteString(t.Local().Format("Jan 02 15:04:05"))
+
+	if host, _ := e.Hostname(); host != "" {
+		b.WriteByte(' ')
+		b.WriteString(host)
+	}
+
+	ident, _ := e.Identifier()
+	if ident == "" {
+		ident = e.Fields[journal.FieldComm]
+	}
+
+	if ident != "" {
+		b.WriteByte(' ')
+		b.WriteString(ident)
+	}
+
+	pid := e.Fields[journal.FieldPID]
+	if pid == "" {
+		pid = e.Fields[journal.FieldSyslogPID]
+	}
+
+	if pid != "" {
+		b.WriteByte('[')
+		b.WriteString(pid)
+		b.WriteByte(']')
+	}
+
+	b.WriteString(": ")
+
+	indent := strings.Repeat(" ", b.Len())
+	lines := strings.Split(strings.TrimRight(e.Fields[journal.FieldMessage], "\n"), "\n")
+
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteByte('\n')
+			b.WriteString(indent)
+		}
+		b.WriteString(line)
+	}
+
+	b.WriteByte('\n')
+
+	return b.String()
+}
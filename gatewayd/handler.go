@@ -0,0 +1,374 @@
+// +build linux
+
+// Package gatewayd serves and reads journals over HTTP using the API of
+// systemd-journal-gatewayd.
+package gatewayd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Content types of the entry formats served by the API
+const (
+	ContentTypeText        = "text/plain"
+	ContentTypeJSON        = journal.JSONContentType
+	ContentTypeEventStream = "text/event-stream"
+	ContentTypeExport      = journal.ExportContentType
+)
+
+// Timeout waiting for new entries while following, after which the
+// request is checked for cancellation
+const followWaitTimeout = time.Second
+
+// HandlerConfig configures a Handler
+type HandlerConfig struct {
+	// Open opens the journal served. It is called for every request.
+	// Defaults to journal.Open.
+	Open func() (*journal.Journal, error)
+}
+
+// Handler is an http.Handler serving a journal using the API of
+// systemd-journal-gatewayd:
+//
+//	/entries       entries in the format negotiated using the Accept header
+//	/machine       information about the machine as JSON
+//	/fields/NAME   the unique values of field NAME
+//
+// Entries are selected using the Range header "entries=CURSOR[[:SKIP]:COUNT]",
+// where "entries=CURSOR:N" means N entries from CURSOR, and the query
+// parameters follow, discrete, boot and NAME=VALUE matches.
+type Handler struct {
+	cfg HandlerConfig
+}
+
+// NewHandler creates a Handler
+func NewHandler(cfg HandlerConfig) *Handler {
+
+	if cfg.Open == nil {
+		cfg.Open = journal.Open
+	}
+
+	return &Handler{
+		cfg: cfg,
+	}
+}
+
+// entriesRequest holds the parsed parameters of an /entries request
+type entriesRequest struct {
+	contentType string
+	cursor      journal.Cursor
+	skip        int64
+	count       uint64
+	countSet    bool
+	follow      bool
+	discrete    bool
+	matches     []*journal.Match
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Unsupported method.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/entries":
+		h.serveEntries(w, r)
+	case r.URL.Path == "/machine":
+		h.serveMachine(w, r)
+	case strings.HasPrefix(r.URL.Path, "/fields/") && len(r.URL.Path) > len("/fields/"):
+		h.serveFields(w, r, strings.TrimPrefix(r.URL.Path, "/fields/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveEntries(w http.ResponseWriter, r *http.Request) {
+
+	req, err := parseEntriesRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	j, err := h.cfg.Open()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open journal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	defer j.Close()
+
+	for _, m := range req.matches {
+		if err := j.AddMatch(m); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to add match: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	positioned, err := seekEntries(j, req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to seek in journal: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", req.contentType)
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// Any error from here on can only end the response early
+	writeEntries(w, r, j, req, positioned)
+}
+
+// seekEntries positions j at the first entry to serve and reports
+// whether there is such an entry
+func seekEntries(j *journal.Journal, req *entriesRequest) (bool, error) {
+
+	var err error
+
+	switch {
+	case !req.cursor.IsZero():
+		err = j.SeekCursor(req.cursor)
+	case req.skip >= 0:
+		err = j.SeekHead()
+	default:
+		err = j.SeekTail()
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if req.skip >= 0 {
+		// Skipping past the last entry leaves no entry to serve
+		n, err := j.Skip(req.skip + 1)
+		return n == req.skip+1, err
+	}
+
+	// As with gatewayd, moving back from a cursor first lands on the entry
+	// of the cursor and moving back from the tail on the last entry, so
+	// skipping back n entries moves back n+1 entries. Skipping back past
+	// the first entry serves from the first entry.
+	n, err := j.Skip(req.skip - 1)
+	return n > 0, err
+}
+
+// writeEntries writes the entries selected by req from the current
+// position of j, waiting for new entries if following
+func writeEntries(w http.ResponseWriter, r *http.Request, j *journal.Journal,
+	req *entriesRequest, positioned bool) {
+
+	bw := bufio.NewWriter(w)
+	enc := newEntryWriter(bw, req.contentType)
+
+	flush := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	defer flush()
+
+	remaining := req.count
+
+	for {
+		if req.countSet && remaining == 0 {
+			return
+		}
+
+		if !positioned {
+			if !req.follow {
+				return
+			}
+
+			if err := flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			default:
+			}
+
+			if _, err := j.Wait(followWaitTimeout); err != nil {
+				return
+			}
+
+			n, err := j.Next()
+			if err != nil {
+				return
+			}
+
+			positioned = n > 0
+			continue
+		}
+
+		if req.discrete {
+			ok, err := j.TestCursor(req.cursor)
+			if err != nil || !ok {
+				return
+			}
+		}
+
+		e, err := j.ReadEntry()
+		if err != nil {
+			return
+		}
+
+		if err := enc(e); err != nil {
+			return
+		}
+
+		remaining--
+
+		n, err := j.Next()
+		if err != nil {
+			return
+		}
+
+		positioned = n > 0
+	}
+}
+
+// parseEntriesRequest parses the headers and query of an /entries request
+func parseEntriesRequest(r *http.Request) (*entriesRequest, error) {
+
+	req := &entriesRequest{
+		contentType: negotiateContentType(r.Header.Get("Accept")),
+	}
+
+	if err := parseRange(r.Header.Get("Range"), req); err != nil {
+		return nil, err
+	}
+
+	query := r.URL.Query()
+
+	for name, values := range query {
+		switch name {
+		case "follow":
+			req.follow = queryBool(values)
+		case "discrete":
+			if queryBool(values) {
+				req.discrete = true
+				req.count = 1
+				req.countSet = true
+			}
+		case "boot":
+			if queryBool(values) {
+				bootID, err := journal.BootID()
+				if err != nil {
+					return nil, fmt.Errorf("Failed to get boot ID: %s", err)
+				}
+				req.matches = append(req.matches,
+					journal.NewMatch().Match(journal.FieldBootID, bootID.String()))
+			}
+		default:
+			req.matches = append(req.matches, journal.NewMatch().Match(name, values...))
+		}
+	}
+
+	if req.discrete && req.cursor.IsZero() {
+		return nil, errors.New("Discrete seeks require a cursor specification.")
+	}
+
+	return req, nil
+}
+
+// parseRange parses a Range header of the form
+// "entries=CURSOR[[:SKIP]:COUNT]" like systemd-journal-gatewayd. With a
+// single colon the number following it is the count, so skipping
+// requires both colons. Every part may be empty.
+func parseRange(header string, req *entriesRequest) error {
+
+	if header == "" {
+		return nil
+	}
+
+	spec := strings.TrimPrefix(header, "entries=")
+	if spec == header {
+		return errors.New("Failed to parse Range header.")
+	}
+
+	parts := strings.SplitN(spec, ":", 3)
+
+	if c := strings.TrimSpace(parts[0]); c != "" {
+		cursor, err := journal.ParseCursor(c)
+		if err != nil {
+			return errors.New("Failed to parse Range header.")
+		}
+		req.cursor = cursor
+	}
+
+	if len(parts) == 3 && strings.TrimSpace(parts[1]) != "" {
+		skip, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return errors.New("Failed to parse Range header.")
+		}
+		req.skip = skip
+	}
+
+	if len(parts) > 1 && strings.TrimSpace(parts[len(parts)-1]) != "" {
+		count, err := strconv.ParseUint(strings.TrimSpace(parts[len(parts)-1]), 10, 64)
+		if err != nil || count == 0 {
+			return errors.New("Failed to parse Range header.")
+		}
+		req.count = count
+		req.countSet = true
+	}
+
+	return nil
+}
+
+// negotiateContentType returns the first supported content type in an
+// Accept header, or text/plain
+func negotiateContentType(accept string) string {
+
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		switch mt {
+		case ContentTypeText, ContentTypeJSON, ContentTypeEventStream, ContentTypeExport:
+			return mt
+		}
+	}
+
+	return ContentTypeText
+}
+
+// queryBool reports whether a boolean query parameter is set. A parameter
+// without a value is true.
+func queryBool(values []string) bool {
+
+	if len(values) == 0 || values[0] == "" {
+		return true
+	}
+
+	switch strings.ToLower(values[0]) {
+	case "1", "yes", "y", "true", "t", "on":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+// +build linux
+
+package gatewayd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/testfile"
+)
+
+// Query selecting the entries written to the fixture, SEQ 1, 3, 5 and 7
+const fixtureQuery = "?SYSLOG_IDENTIFIER=fixture"
+
+// newFixtureHandler returns a Handler serving a journal file from the
+// testdata of the journal package along with a function removing it
+func newFixtureHandler(t testing.TB) (*Handler, func()) {
+
+	t.Helper()
+
+	path, remove := testfile.Gunzip(t, filepath.Join("..", "testdata", "entries.journal.gz"))
+
+	h := NewHandler(HandlerConfig{
+		Open: func() (*journal.Journal, error) {
+			return journal.OpenFiles(path)
+		},
+	})
+
+	return h, remove
+}
+
+// getEntries requests entries from h and returns them along with their
+// SEQ fields
+func getEntries(t *testing.T, h http.Handler, query, spec string) ([]*journal.Entry, string) {
+
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/entries"+query, nil)
+	req.Header.Set("Accept", ContentTypeJSON)
+	if spec != "" {
+		req.Header.Set("Range", spec)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: unexpected status %d: %s", spec, w.Code, w.Body)
+	}
+
+	var (
+		entries []*journal.Entry
+		seqs    []string
+	)
+
+	dec := journal.NewJSONDecoder(w.Body)
+	for {
+		e, err := dec.Decode()
+		if err == io.EOF {
+			return entries, strings.Join(seqs, " ")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, e)
+		seqs = append(seqs, e.Fields["SEQ"])
+	}
+}
+
+func TestHandlerRange(t *testing.T) {
+
+	h, remove := newFixtureHandler(t)
+	defer remove()
+
+	all, _ := getEntries(t, h, fixtureQuery, "")
+	if len(all) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(all))
+	}
+
+	// Cursor of the entry with SEQ 5
+	cursor := all[2].Cursor.String()
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"entries=", "1 3 5 7"},
+		{"entries=:1:2", "3 5"},
+		{"entries=:10:", ""},
+		{"entries=:-1:1", "5"},
+		{"entries=:-1:", "5 7"},
+		{"entries=:-10:2", "1 3"},
+		{"entries=" + cursor, "5 7"},
+		{"entries=" + cursor + ":1:1", "7"},
+		{"entries=" + cursor + ":-1:1", "3"},
+		{"entries=" + cursor + ":-2:", "1 3 5 7"},
+		// A single colon is followed by the count
+		{"entries=:3", "1 3 5"},
+		{"entries=" + cursor + ":5", "5 7"},
+		{"entries=" + cursor + ":1", "5"},
+		{"entries=" + cursor + ":-2:5", "1 3 5 7"},
+		{"entries=" + cursor + ":-2:2", "1 3"},
+	}
+
+	for _, test := range tests {
+		if _, got := getEntries(t, h, fixtureQuery, test.spec); got != test.want {
+			t.Errorf("%s: expected entries [%s], got [%s]", test.spec, test.want, got)
+		}
+	}
+}
+
+func BenchmarkHandlerEntries(b *testing.B) {
+
+	h, remove := newFixtureHandler(b)
+	defer remove()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/entries", nil)
+		req.Header.Set("Accept", ContentTypeJSON)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
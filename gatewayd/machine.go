@@ -0,0 +1,192 @@
+// +build linux
+
+package gatewayd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Machine describes the machine serving a journal, as returned by /machine
+type Machine struct {
+	MachineID          journal.ID128 `json:"machine_id"`
+	BootID             journal.ID128 `json:"boot_id"`
+	Hostname           string        `json:"hostname"`
+	OSPrettyName       string        `json:"os_pretty_name"`
+	Virtualization     string        `json:"virtualization"`
+	Usage              uint64        `json:"usage,string"`
+	CutoffFromRealtime uint64        `json:"cutoff_from_realtime,string"`
+	CutoffToRealtime   uint64        `json:"cutoff_to_realtime,string"`
+}
+
+// Known hypervisors by DMI vendor, named as by systemd-detect-virt
+var dmiVendors = []struct {
+	prefix string
+	name   string
+}{
+	{"KVM", "kvm"},
+	{"Amazon EC2", "amazon"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"innotek GmbH", "oracle"},
+	{"Oracle Corporation", "oracle"},
+	{"Xen", "xen"},
+	{"Bochs", "bochs"},
+	{"Parallels", "parallels"},
+	{"BHYVE", "bhyve"},
+	{"Microsoft Corporation", "microsoft"},
+}
+
+func (h *Handler) serveMachine(w http.ResponseWriter, r *http.Request) {
+
+	j, err := h.cfg.Open()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open journal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	defer j.Close()
+
+	m := Machine{
+		OSPrettyName:   osPrettyName(),
+		Virtualization: virtualization(),
+	}
+
+	if m.MachineID, err = journal.MachineID(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to determine machine ID: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if m.BootID, err = journal.BootID(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to determine boot ID: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if m.Hostname, err = os.Hostname(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to determine hostname: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if m.Usage, err = j.Usage(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to determine disk usage: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// An empty journal has no cutoff
+	if from, to, err := j.Cutoff(); err == nil {
+		m.CutoffFromRealtime = uint64(from.UnixNano() / 1000)
+		m.CutoffToRealtime = uint64(to.UnixNano() / 1000)
+	}
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	json.NewEncoder(w).Encode(m)
+}
+
+func (h *Handler) serveFields(w http.ResponseWriter, r *http.Request, field string) {
+
+	j, err := h.cfg.Open()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open journal: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	defer j.Close()
+
+	values, err := j.UniqueValues(field)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to query unique fields: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	contentType := ContentTypeText
+	if negotiateContentType(r.Header.Get("Accept")) == ContentTypeJSON {
+		contentType = ContentTypeJSON
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	enc := journal.NewJSONEncoder(bw)
+
+	for _, v := range values {
+		if contentType == ContentTypeJSON {
+			enc.Encode(&journal.Entry{Fields: journal.Fields{field: v}})
+			continue
+		}
+		bw.WriteString(v)
+		bw.WriteByte('\n')
+	}
+}
+
+// osPrettyName returns PRETTY_NAME of the os-release file
+func osPrettyName() string {
+
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if v := strings.TrimPrefix(line, "PRETTY_NAME="); v != line {
+				if s, err := strconv.Unquote(v); err == nil {
+					return s
+				}
+				return strings.Trim(v, `"'`)
+			}
+		}
+
+		return ""
+	}
+
+	return ""
+}
+
+// virtualization returns the kind of container or virtual machine the
+// process runs in, or "bare" if none is detected. Containers take
+// precedence and are detected like systemd does.
+func virtualization() string {
+
+	if data, err := ioutil.ReadFile("/run/systemd/container"); err == nil {
+		if s := strings.TrimSpace(string(data)); s != "" {
+			return s
+		}
+	}
+
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+
+	for _, path := range []string{"/sys/class/dmi/id/sys_vendor", "/sys/class/dmi/id/product_name"} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		for _, v := range dmiVendors {
+			if strings.HasPrefix(string(data), v.prefix) {
+				return v.name
+			}
+		}
+	}
+
+	if data, err := ioutil.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "flags") && strings.Contains(line+" ", " hypervisor ") {
+				return "vm-other"
+			}
+		}
+	}
+
+	return "bare"
+}
@@ -0,0 +1,110 @@
+// +build linux
+
+// Package gelf sends journal entries to Graylog in the Graylog Extended
+// Log Format.
+package gelf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Fields mapped to the standard fields of a message
+var standardFields = map[string]bool{
+	journal.FieldMessage:                 true,
+	journal.FieldPriority:                true,
+	journal.FieldHostname:                true,
+	journal.FieldSourceRealtimeTimestamp: true,
+}
+
+// Marshal encodes an entry as a GELF 1.1 message. MESSAGE is the short
+// message, PRIORITY the level and _HOSTNAME the host, or host if it has
+// none. Other fields are additional fields, named in lower case without
+// leading underscores, e.g. _systemd_unit for _SYSTEMD_UNIT.
+func Marshal(e *journal.Entry, host string) ([]byte, error) {
+
+	msg := map[string]interface{}{
+		"version": "1.1",
+		"host":    host,
+	}
+
+	if h, err := e.Hostname(); err == nil && h != "" {
+		msg["host"] = h
+	}
+
+	// The short message must not be empty
+	short := e.Fields[journal.FieldMessage]
+	if strings.TrimSpace(short) == "" {
+		short = "-"
+	}
+
+	msg["short_message"] = short
+
+	if t, err := e.SourceTime(); err == nil && !t.IsZero() {
+		// Seconds with millisecond precision as expected by Graylog
+		msg["timestamp"] = math.Round(float64(t.UnixNano())/1e6) / 1e3
+	} else if !e.Timestamp.IsZero() {
+		msg["timestamp"] = math.Round(float64(e.Timestamp.UnixNano())/1e6) / 1e3
+	}
+
+	if p, err := e.Priority(); err == nil {
+		msg["level"] = int(p)
+	}
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		if !standardFields[name] && !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := fieldName(name)
+		if key == "" {
+			continue
+		}
+
+		// Trusted fields win over user fields of the same name
+		if _, ok := msg[key]; ok && !strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		msg[key] = e.Fields[name]
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode GELF message: %w", err)
+	}
+
+	return data, nil
+}
+
+// fieldName returns the name of the additional field of a journal field,
+// or an empty string if it can't be sent. Names only consist of word
+// characters, dots and dashes, and _id is reserved.
+func fieldName(name string) string {
+
+	name = strings.ToLower(strings.TrimLeft(name, "_"))
+	if name == "" || name == "id" {
+		return ""
+	}
+
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '.', c == '-':
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return "_" + string(b)
+}
@@ -0,0 +1,351 @@
+// +build linux
+
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/conn"
+	"github.com/vargspjut/systemd-journal/internal/retry"
+)
+
+// Compression of messages sent over UDP and HTTP
+type Compression int
+
+// Compression constants
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZlib
+)
+
+// Chunked UDP messages as defined by GELF
+const (
+	maxChunks        = 128
+	defaultChunkSize = 1420
+	// Magic bytes, message ID, sequence number and count of chunks
+	chunkHeaderLen = 12
+)
+
+// SenderConfig configures a Sender
+type SenderConfig struct {
+	// Network is "udp", "tcp", "tls" or "http". Defaults to "udp".
+	Network string
+	// Address of the GELF input, e.g. "graylog:12201", or its URL for
+	// http, e.g. "http://graylog:12201/gelf"
+	Address string
+	// TLSConfig is used when Network is "tls". Defaults to verifying the
+	// server using the system roots.
+	TLSConfig *tls.Config
+	// Compression of messages sent over udp and http. Messages sent over
+	// tcp and tls aren't compressed. Defaults to CompressionNone.
+	Compression Compression
+	// ChunkSize is the maximum size of UDP datagrams. Larger messages are
+	// split into up to 128 chunks. Defaults to 1420 bytes.
+	ChunkSize int
+	// Hostname is sent for entries without _HOSTNAME. Defaults to the
+	// hostname of the machine.
+	Hostname string
+	// Client is used for http. Defaults to http.DefaultClient.
+	Client *http.Client
+	// DialTimeout is the maximum time to connect. Defaults to 10s.
+	DialTimeout time.Duration
+	// WriteTimeout is the maximum time to write a message. Defaults to 10s.
+	WriteTimeout time.Duration
+	// StateFile is where the cursor of the last sent entry is saved.
+	// Sending resumes after the saved cursor.
+	StateFile string
+	// BatchSize is the maximum number of entries per batch.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back while
+	// following. Defaults to 1s.
+	FlushInterval time.Duration
+	// Retries is the number of times sending is retried after failing.
+	// Defaults to 4. A negative value retries until the entries are sent.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for
+	// every following retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+	// OnError is called with errors while following, and with entries
+	// too large to be sent
+	OnError func(err error)
+}
+
+// Sender sends journal entries as GELF messages to Graylog over UDP,
+// TCP, TLS or HTTP
+type Sender struct {
+	cfg     SenderConfig
+	backoff retry.Backoff
+	conn    *conn.Conn
+	mutex   sync.Mutex
+}
+
+// NewSender creates a Sender. The server is connected to when entries
+// are first exported.
+func NewSender(cfg SenderConfig) (*Sender, error) {
+
+	if cfg.Address == "" {
+		return nil, errors.New("a GELF input address must be provided")
+	}
+
+	switch cfg.Network {
+	case "":
+		cfg.Network = "udp"
+	case "udp", "tcp", "tls", "http":
+	default:
+		return nil, fmt.Errorf("unsupported network '%s'", cfg.Network)
+	}
+
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultChunkSize
+	}
+	if cfg.ChunkSize <= chunkHeaderLen {
+		return nil, fmt.Errorf("chunk size %d too small", cfg.ChunkSize)
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 10 * time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	return &Sender{
+		cfg:     cfg,
+		backoff: retry.WithRetries(cfg.Retries, cfg.RetryBackoff),
+		conn: conn.New(conn.Config{
+			Network:      cfg.Network,
+			Address:      cfg.Address,
+			TLSConfig:    cfg.TLSConfig,
+			DialTimeout:  cfg.DialTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			Name:         "GELF input",
+		}),
+	}, nil
+}
+
+// Export sends entries as GELF messages. If sending fails, the remaining
+// messages are sent again, after reconnecting for tcp and tls.
+func (s *Sender) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	msgs := make([][]byte, 0, len(entries))
+
+	for _, e := range entries {
+		msg, err := Marshal(e, s.cfg.Hostname)
+		if err != nil {
+			return err
+		}
+
+		if s.cfg.Network == "udp" || s.cfg.Network == "http" {
+			if msg, err = s.compress(msg); err != nil {
+				return err
+			}
+		}
+
+		if s.cfg.Network == "udp" && len(msg) > maxChunks*(s.cfg.ChunkSize-chunkHeaderLen) {
+			s.cfg.OnError(fmt.Errorf("entry '%s' too large to be sent over UDP", e.Cursor))
+			continue
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent := 0
+
+	return s.backoff.Do(ctx, func() error {
+		for sent < len(msgs) {
+			if err := s.send(ctx, msgs[sent]); err != nil {
+				return err
+			}
+			sent++
+		}
+
+		return nil
+	})
+}
+
+// SendJournal sends the entries of j from its current position, or
+// after the cursor in the state file, until there are no more entries.
+func (s *Sender) SendJournal(ctx context.Context, j journal.Reader) error {
+	return batch.Read(ctx, j, s.batchConfig(), s.Export)
+}
+
+// Follow follows j from its current position, or after the cursor in
+// the state file, and sends entries as they are written. Errors are
+// passed to OnError. Following stops if entries fail to be sent.
+func (s *Sender) Follow(j journal.Follower) (journal.FollowStop, error) {
+	return batch.Follow(j, s.batchConfig(), s.Export)
+}
+
+// Close closes the connection to the server
+func (s *Sender) Close() error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.conn.Close()
+}
+
+func (s *Sender) batchConfig() batch.Config {
+	return batch.Config{
+		Size:      s.cfg.BatchSize,
+		Interval:  s.cfg.FlushInterval,
+		StateFile: s.cfg.StateFile,
+		OnError:   s.cfg.OnError,
+	}
+}
+
+// send sends a message.
+// NOTE: The caller must hold the mutex.
+func (s *Sender) send(ctx context.Context, msg []byte) error {
+
+	if s.cfg.Network == "http" {
+		return s.post(ctx, msg)
+	}
+
+	if s.cfg.Network == "udp" {
+		return s.writeChunked(ctx, msg)
+	}
+
+	// Messages are delimited by a NUL byte
+	return s.conn.Write(ctx, append(msg, 0))
+}
+
+// writeChunked writes a message as one datagram, or as chunks if it
+// doesn't fit in one.
+// NOTE: The caller must hold the mutex.
+func (s *Sender) writeChunked(ctx context.Context, msg []byte) error {
+
+	if len(msg) <= s.cfg.ChunkSize {
+		return s.conn.Write(ctx, msg)
+	}
+
+	size := s.cfg.ChunkSize - chunkHeaderLen
+	count := (len(msg) + size - 1) / size
+
+	chunk := make([]byte, s.cfg.ChunkSize)
+	chunk[0] = 0x1e
+	chunk[1] = 0x0f
+
+	if _, err := rand.Read(chunk[2:10]); err != nil {
+		return fmt.Errorf("failed to create message ID: %w", err)
+	}
+
+	chunk[11] = byte(count)
+
+	for i := 0; i < count; i++ {
+		data := msg[i*size:]
+		if len(data) > size {
+			data = data[:size]
+		}
+
+		chunk[10] = byte(i)
+		n := copy(chunk[chunkHeaderLen:], data)
+
+		if err := s.conn.Write(ctx, chunk[:chunkHeaderLen+n]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// post sends a message over HTTP. Server errors and rate limiting are
+// retried, other errors are not.
+func (s *Sender) post(ctx context.Context, msg []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, s.cfg.Address, bytes.NewReader(msg))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("failed to create GELF request: %w", err))
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	switch s.cfg.Compression {
+	case CompressionGzip:
+		req.Header.Set("Content-Encoding", "gzip")
+	case CompressionZlib:
+		req.Header.Set("Content-Encoding", "deflate")
+	}
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send GELF message: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("failed to send GELF message: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+
+	return retry.Permanent(err)
+}
+
+// compress compresses a message as configured
+func (s *Sender) compress(msg []byte) ([]byte, error) {
+
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+
+	switch s.cfg.Compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionZlib:
+		w = zlib.NewWriter(&buf)
+	default:
+		return msg, nil
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return nil, fmt.Errorf("failed to compress GELF message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress GELF message: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
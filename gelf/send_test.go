@@ -0,0 +1,172 @@
+// +build linux
+
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// receive starts a GELF input on network passing the short message of
+// every message received to a channel, returning its address and a
+// function stopping it
+func receive(t *testing.T, network string) (string, <-chan string, func()) {
+
+	msgs := make(chan string, 100)
+
+	decode := func(data []byte) {
+		if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Errorf("failed to decompress message: %v", err)
+				return
+			}
+			data, _ = ioutil.ReadAll(zr)
+		}
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Errorf("failed to decode message: %v", err)
+			return
+		}
+		msgs <- m["short_message"].(string)
+	}
+
+	switch network {
+	case "udp":
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			chunks := map[byte][]byte{}
+			buf := make([]byte, 64*1024)
+
+			for {
+				n, _, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+
+				if buf[0] != 0x1e || buf[1] != 0x0f {
+					decode(buf[:n])
+					continue
+				}
+
+				// Chunks of a single message sent in order
+				chunks[buf[10]] = append([]byte(nil), buf[chunkHeaderLen:n]...)
+				if len(chunks) == int(buf[11]) {
+					var data []byte
+					for i := 0; i < len(chunks); i++ {
+						data = append(data, chunks[byte(i)]...)
+					}
+					chunks = map[byte][]byte{}
+					decode(data)
+				}
+			}
+		}()
+
+		return pc.LocalAddr().String(), msgs, func() { pc.Close() }
+
+	case "tcp":
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+
+			r := bufio.NewReader(c)
+			for {
+				data, err := r.ReadBytes(0)
+				if err != nil {
+					return
+				}
+				decode(data[:len(data)-1])
+			}
+		}()
+
+		return l.Addr().String(), msgs, func() { l.Close() }
+
+	default:
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			decode(data)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		return s.URL + "/gelf", msgs, s.Close
+	}
+}
+
+func TestSenderExport(t *testing.T) {
+
+	long := strings.Repeat("long message ", 400)
+
+	entries := []*journal.Entry{
+		{Fields: journal.Fields{journal.FieldMessage: "first"}},
+		{Fields: journal.Fields{journal.FieldMessage: long}},
+	}
+
+	// The long message is chunked over udp unless compressed
+	tests := []struct {
+		network     string
+		compression Compression
+	}{
+		{"udp", CompressionNone},
+		{"udp", CompressionGzip},
+		{"tcp", CompressionNone},
+		{"http", CompressionGzip},
+	}
+
+	for _, test := range tests {
+		network := test.network
+		addr, msgs, stop := receive(t, network)
+
+		s, err := NewSender(SenderConfig{
+			Network:     network,
+			Address:     addr,
+			Compression: test.compression,
+			ChunkSize:   512,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Export(context.Background(), entries); err != nil {
+			t.Fatalf("%s: %v", network, err)
+		}
+
+		for i, want := range []string{"first", long} {
+			select {
+			case got := <-msgs:
+				if got != want {
+					t.Errorf("%s: message %d: expected %.20q, got %.20q", network, i, want, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: timed out waiting for message %d", network, i)
+			}
+		}
+
+		s.Close()
+		stop()
+	}
+}
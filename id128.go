@@ -0,0 +1,177 @@
+// +build linux
+
+package journal
+
+// #include <systemd/sd-id128.h>
+import (
+	"C"
+)
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ID128 is a 128-bit identifier such as a boot ID, machine ID or
+// MESSAGE_ID. The value is the 32 character lower-case hexadecimal
+// form used by the journal, which allows IDs to be declared as
+// constants. The zero value is the empty string.
+type ID128 string
+
+// ParseID128 parses an ID in plain hexadecimal or UUID format
+func ParseID128(s string) (ID128, error) {
+
+	h := s
+	if len(h) == 36 && h[8] == '-' && h[13] == '-' && h[18] == '-' && h[23] == '-' {
+		h = h[0:8] + h[9:13] + h[14:18] + h[19:23] + h[24:36]
+	}
+
+	if len(h) != 32 {
+		return "", fmt.Errorf("invalid 128-bit ID '%s'", s)
+	}
+
+	if _, err := hex.DecodeString(h); err != nil {
+		return "", fmt.Errorf("invalid 128-bit ID '%s': %w", s, err)
+	}
+
+	return ID128(strings.ToLower(h)), nil
+}
+
+func (id ID128) String() string {
+	return string(id)
+}
+
+// bytes returns the binary form of the ID
+func (id ID128) bytes() ([16]byte, error) {
+
+	var b [16]byte
+
+	parsed, err := ParseID128(string(id))
+	if err != nil {
+		return b, err
+	}
+
+	hex.Decode(b[:], []byte(parsed))
+
+	return b, nil
+}
+
+func (id ID128) toC() (C.sd_id128_t, error) {
+
+	var c C.sd_id128_t
+
+	b, err := id.bytes()
+	if err != nil {
+		return c, err
+	}
+
+	*(*[16]byte)(unsafe.Pointer(&c)) = b
+
+	return c, nil
+}
+
+func id128FromC(c C.sd_id128_t) ID128 {
+	b := *(*[16]byte)(unsafe.Pointer(&c))
+	return ID128(hex.EncodeToString(b[:]))
+}
+
+// Well-known MESSAGE_IDs defined by systemd
+const (
+	MessageIDJournalStart        ID128 = "f77379a8490b408bbe5f6940505a777b"
+	MessageIDJournalStop         ID128 = "d93fb3c9c24d451a97cea615ce59c00b"
+	MessageIDJournalDropped      ID128 = "a596d6fe7bfa4994828e72309e95d61e"
+	MessageIDJournalMissed       ID128 = "e9bf28e6e834481bb6f48f548ad13606"
+	MessageIDJournalUsage        ID128 = "ec387f577b844b8fa948f33cad9a75e6"
+	MessageIDCoredump            ID128 = "fc2e22bc6ee647b6b90729ab34a250b1"
+	MessageIDSessionStart        ID128 = "8d45620c1a4348dbb17410da57c60c66"
+	MessageIDSessionStop         ID128 = "3354939424b4456d9802ca8333ed424a"
+	MessageIDSeatStart           ID128 = "fcbefc5da23d428093f97c82a9290f7b"
+	MessageIDSeatStop            ID128 = "e7852bfe46784ed0accde04bc864c2d5"
+	MessageIDTimeChange          ID128 = "c7a787079b354eaaa9e77b371893cd27"
+	MessageIDTimezoneChange      ID128 = "45f82f4aef7a4bbf942ce861d1f20990"
+	MessageIDStartupFinished     ID128 = "b07a249cd024414a82dd00cd181378ff"
+	MessageIDUserStartupFinished ID128 = "eed00a68ffd84e31882105fd973abdd1"
+	MessageIDSleepStart          ID128 = "6bbd95ee977941e497c48be27c254128"
+	MessageIDSleepStop           ID128 = "8811e6df2a8e40f58a94cea26f8ebf14"
+	MessageIDShutdown            ID128 = "98268866d1d54a499c4e98921d93bc40"
+	MessageIDUnitStarting        ID128 = "7d4958e842da4a758f6c1cdc7b36dcc5"
+	MessageIDUnitStarted         ID128 = "39f53479d3a045ac8e11786248231fbf"
+	MessageIDUnitFailed          ID128 = "be02cf6855d2428ba40df7e9d022f03d"
+	MessageIDUnitStopping        ID128 = "de5b426a63be47a7b6ac3eaac82e2f6f"
+	MessageIDUnitStopped         ID128 = "9d1aaa27d60140bd96365438aad20286"
+	MessageIDUnitReloading       ID128 = "d34d037fff1847e6ae669a370e694725"
+	MessageIDUnitReloaded        ID128 = "7b05ebc668384222baa8881179cfda54"
+	MessageIDUnitProcessExit     ID128 = "98e322203f7a4ed290d09fe03c09fe15"
+	MessageIDSpawnFailed         ID128 = "641257651c1b4ec9a8624d7a40a9e1e7"
+	MessageIDForwardSyslogMissed ID128 = "0027229ca0644181a76c4e92458afa2e"
+	MessageIDConfigError         ID128 = "c772d24e9a884cbeb9ea12625c306c01"
+)
+
+// UUID returns the ID formatted as a UUID, i.e. with dashes separating
+// the groups of hexadecimal digits
+func (id ID128) UUID() string {
+
+	s := string(id)
+	if len(s) != 32 {
+		return s
+	}
+
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// Random generates a new random ID suitable as a MESSAGE_ID
+func Random() (ID128, error) {
+
+	var c C.sd_id128_t
+
+	if ret := C.sd_id128_randomize(&c); ret < 0 {
+		return "", fmt.Errorf("failed to generate random ID: %w", syscall.Errno(-ret))
+	}
+
+	return id128FromC(c), nil
+}
+
+// MachineID returns the ID of the local machine
+func MachineID() (ID128, error) {
+
+	var c C.sd_id128_t
+
+	if ret := C.sd_id128_get_machine(&c); ret < 0 {
+		return "", fmt.Errorf("failed to get machine ID: %w", syscall.Errno(-ret))
+	}
+
+	return id128FromC(c), nil
+}
+
+// BootID returns the ID of the current boot
+func BootID() (ID128, error) {
+
+	var c C.sd_id128_t
+
+	if ret := C.sd_id128_get_boot(&c); ret < 0 {
+		return "", fmt.Errorf("failed to get boot ID: %w", syscall.Errno(-ret))
+	}
+
+	return id128FromC(c), nil
+}
+
+// MachineAppSpecific returns an ID derived from the machine ID and the
+// provided application ID. Use it instead of the machine ID to avoid
+// exposing the machine ID to the outside.
+func MachineAppSpecific(appID ID128) (ID128, error) {
+
+	app, err := appID.toC()
+	if err != nil {
+		return "", err
+	}
+
+	var c C.sd_id128_t
+
+	if ret := C.sd_id128_get_machine_app_specific(app, &c); ret < 0 {
+		return "", fmt.Errorf("failed to get app specific machine ID: %w", syscall.Errno(-ret))
+	}
+
+	return id128FromC(c), nil
+}
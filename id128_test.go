@@ -0,0 +1,86 @@
+// +build linux
+
+package journal
+
+import (
+	"testing"
+)
+
+func TestParseID128(t *testing.T) {
+
+	tests := []struct {
+		s        string
+		expected ID128
+		valid    bool
+	}{
+		{"fc2e22bc6ee647b6b90729ab34a250b1", "fc2e22bc6ee647b6b90729ab34a250b1", true},
+		{"FC2E22BC6EE647B6B90729AB34A250B1", "fc2e22bc6ee647b6b90729ab34a250b1", true},
+		{"fc2e22bc-6ee6-47b6-b907-29ab34a250b1", "fc2e22bc6ee647b6b90729ab34a250b1", true},
+		{"FC2E22BC-6EE6-47B6-B907-29AB34A250B1", "fc2e22bc6ee647b6b90729ab34a250b1", true},
+		{"", "", false},
+		{"fc2e22bc6ee647b6b90729ab34a250b", "", false},
+		{"fc2e22bc6ee647b6b90729ab34a250b10", "", false},
+		{"fc2e22bc6ee647b6b90729ab34a250bx", "", false},
+		{"fc2e22bc-6ee647b6-b907-29ab34a250b1", "", false},
+		{"fc2e22bc_6ee6_47b6_b907_29ab34a250b1", "", false},
+		{"fc2e22bc-6ee6-47b6-b907-29ab34a250bz", "", false},
+	}
+
+	for _, test := range tests {
+		id, err := ParseID128(test.s)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%q: expected valid %v, got error %v", test.s, test.valid, err)
+			continue
+		}
+		if id != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.s, test.expected, id)
+		}
+	}
+}
+
+func TestID128UUID(t *testing.T) {
+
+	tests := []struct {
+		id       ID128
+		expected string
+	}{
+		{"fc2e22bc6ee647b6b90729ab34a250b1", "fc2e22bc-6ee6-47b6-b907-29ab34a250b1"},
+		{"00000000000000000000000000000000", "00000000-0000-0000-0000-000000000000"},
+		// Anything but the plain form is returned as is
+		{"", ""},
+		{"fc2e22bc", "fc2e22bc"},
+	}
+
+	for _, test := range tests {
+		s := test.id.UUID()
+		if s != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.id, test.expected, s)
+			continue
+		}
+
+		if len(test.id) != 32 {
+			continue
+		}
+
+		if id, err := ParseID128(s); err != nil || id != test.id {
+			t.Errorf("%s: expected to parse as %s, got %s (%v)", s, test.id, id, err)
+		}
+	}
+}
+
+func TestID128Bytes(t *testing.T) {
+
+	b, err := ID128("FC2E22BC-6EE6-47B6-B907-29AB34A250B1").bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [16]byte{0xfc, 0x2e, 0x22, 0xbc, 0x6e, 0xe6, 0x47, 0xb6, 0xb9, 0x07, 0x29, 0xab, 0x34, 0xa2, 0x50, 0xb1}
+	if b != expected {
+		t.Errorf("expected %x, got %x", expected, b)
+	}
+
+	if _, err := ID128("x").bytes(); err == nil {
+		t.Error("expected error")
+	}
+}
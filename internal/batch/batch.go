@@ -0,0 +1,390 @@
+// +build linux
+
+// Package batch reads and follows journal entries in batches on behalf
+// of exporters, keeping track of the last exported entry in a state file.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// ExportFunc exports a batch of entries
+type ExportFunc func(ctx context.Context, entries []*journal.Entry) error
+
+// Config configures how entries are batched. Zero values are
+// replaced by defaults.
+type Config struct {
+	// Size is the maximum number of entries per batch. Defaults to 500.
+	Size int
+	// Interval is the maximum time entries are held back while following
+	// before a partial batch is exported. Defaults to 1s.
+	Interval time.Duration
+	// StateFile is where the cursor of the last exported entry is saved.
+	// Reading resumes after the saved cursor. No state is kept if empty.
+	StateFile string
+	// OnError is called with errors while following. Following stops
+	// after an error exporting entries.
+	OnError func(err error)
+	// Checkpoint is called with the cursor of the last entry handled once
+	// the entries up to it are exported. Defaults to saving the cursor to
+	// the state file.
+	Checkpoint func(c journal.Cursor) error
+}
+
+func (cfg *Config) defaults() {
+
+	if cfg.Size <= 0 {
+		cfg.Size = 500
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+	if cfg.Checkpoint == nil {
+		stateFile := cfg.StateFile
+		cfg.Checkpoint = func(c journal.Cursor) error {
+			if stateFile == "" {
+				return nil
+			}
+			return SaveCursor(stateFile, c)
+		}
+	}
+}
+
+// Batcher collects entries into batches and exports them, checkpointing
+// the cursor of the last entry handled once exported.
+// NOTE: A Batcher must not be used concurrently.
+type Batcher struct {
+	cfg    Config
+	export ExportFunc
+	batch  []*journal.Entry
+	// Cursor of the last entry handled and of the last one checkpointed
+	last  journal.Cursor
+	saved journal.Cursor
+}
+
+// NewBatcher creates a Batcher
+func NewBatcher(cfg Config, export ExportFunc) *Batcher {
+
+	cfg.defaults()
+
+	return &Batcher{
+		cfg:    cfg,
+		export: export,
+		batch:  make([]*journal.Entry, 0, cfg.Size),
+	}
+}
+
+// Add adds an entry to the batch, exporting the batch once full
+func (b *Batcher) Add(ctx context.Context, e *journal.Entry) error {
+
+	b.batch = append(b.batch, e)
+	if !e.Cursor.IsZero() {
+		b.last = e.Cursor
+	}
+
+	if len(b.batch) < b.cfg.Size {
+		return nil
+	}
+
+	return b.Flush(ctx)
+}
+
+// Skip marks the entry at a cursor as handled without exporting it, e.g.
+// an entry left out by a filter, so it's checkpointed with the next batch
+func (b *Batcher) Skip(c journal.Cursor) {
+	if !c.IsZero() {
+		b.last = c
+	}
+}
+
+// Len returns the number of entries waiting to be exported
+func (b *Batcher) Len() int {
+	return len(b.batch)
+}
+
+// Flush exports the pending entries and checkpoints the cursor of the
+// last entry handled. The entries are kept if they fail to be exported.
+func (b *Batcher) Flush(ctx context.Context) error {
+
+	if len(b.batch) > 0 {
+		if err := b.export(ctx, b.batch); err != nil {
+			return err
+		}
+		b.batch = b.batch[:0]
+	}
+
+	if b.last.IsZero() || b.last == b.saved {
+		return nil
+	}
+
+	if err := b.cfg.Checkpoint(b.last); err != nil {
+		return err
+	}
+
+	b.saved = b.last
+
+	return nil
+}
+
+// Read exports the entries of r in batches until it has no more entries
+// or ctx is done. If a state file is configured and r supports seeking
+// to a cursor, reading resumes after the saved cursor.
+func Read(ctx context.Context, r journal.Reader, cfg Config, export ExportFunc) error {
+
+	cfg.defaults()
+
+	skip, err := resume(r, cfg.StateFile, false)
+	if err != nil {
+		return err
+	}
+
+	b := NewBatcher(cfg, export)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("failed to move to next entry: %w", err)
+		}
+
+		if n == 0 {
+			break
+		}
+
+		e, err := r.ReadEntry()
+		if err != nil {
+			return fmt.Errorf("failed to read entry: %w", err)
+		}
+
+		if !skip.IsZero() {
+			s := skip
+			skip = journal.Cursor{}
+			if e.Cursor == s {
+				continue
+			}
+		}
+
+		if err := b.Add(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return b.Flush(ctx)
+}
+
+// Follow follows f and exports its entries in batches. If a state file
+// is configured and f supports seeking to a cursor, following starts after
+// the saved cursor. Stopping exports the pending batch and waits for
+// it to be exported.
+func Follow(f journal.Follower, cfg Config, export ExportFunc) (journal.FollowStop, error) {
+
+	cfg.defaults()
+
+	skip, err := resume(f, cfg.StateFile, true)
+	if err != nil {
+		return nil, err
+	}
+
+	type event struct {
+		entry *journal.Entry
+		err   error
+	}
+
+	events := make(chan event, cfg.Size)
+
+	stop, err := f.Follow(func(e *journal.Entry, err error) {
+		events <- event{entry: e, err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		var (
+			b      = NewBatcher(cfg, export)
+			failed bool
+		)
+
+		fail := func(err error) {
+			failed = true
+			cfg.OnError(err)
+			// Keep draining events until following has stopped
+			stop()
+		}
+
+		send := func() {
+			if failed {
+				return
+			}
+
+			if err := b.Flush(context.Background()); err != nil {
+				fail(err)
+			}
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				send()
+			case ev := <-events:
+				if ev.err != nil {
+					send()
+					if !errors.Is(ev.err, journal.ErrFollowStopped) {
+						cfg.OnError(ev.err)
+					}
+					return
+				}
+
+				if !skip.IsZero() {
+					s := skip
+					skip = journal.Cursor{}
+					if ev.entry.Cursor == s {
+						continue
+					}
+				}
+
+				if failed {
+					continue
+				}
+
+				if err := b.Add(context.Background(), ev.entry); err != nil {
+					fail(err)
+				}
+			}
+		}
+	}()
+
+	once := sync.Once{}
+
+	return func() {
+		once.Do(func() {
+			stop()
+			<-done
+		})
+	}, nil
+}
+
+// LoadCursor reads the cursor saved in a state file. A zero cursor is
+// returned if the file does not exist.
+func LoadCursor(path string) (journal.Cursor, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return journal.Cursor{}, nil
+		}
+		return journal.Cursor{}, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v := strings.TrimPrefix(s.Text(), "LAST_CURSOR="); v != s.Text() {
+			c, err := journal.ParseCursor(v)
+			if err != nil {
+				return journal.Cursor{}, fmt.Errorf("failed to parse state file: %w", err)
+			}
+			return c, nil
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return journal.Cursor{}, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	return journal.Cursor{}, nil
+}
+
+// SaveCursor saves a cursor to a state file in the format used by
+// systemd-journal-upload. The file is replaced atomically.
+func SaveCursor(path string, c journal.Cursor) error {
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+
+	_, err = fmt.Fprintf(tmp, "# This is private data. Do not parse.\nLAST_CURSOR=%s\n", c)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+// resume seeks src to the cursor saved in the state file and returns
+// the cursor, as the entry at the cursor is read again after seeking.
+func resume(src interface{}, stateFile string, follow bool) (journal.Cursor, error) {
+
+	if stateFile == "" {
+		return journal.Cursor{}, nil
+	}
+
+	if _, ok := src.(interface{ SeekCursor(journal.Cursor) error }); !ok {
+		return journal.Cursor{}, nil
+	}
+
+	c, err := LoadCursor(stateFile)
+	if err != nil || c.IsZero() {
+		return journal.Cursor{}, err
+	}
+
+	return Seek(src, c, follow)
+}
+
+// Seek seeks src to a cursor, if src supports seeking, and returns the
+// cursor if the entry at the cursor is read again and must be skipped.
+// Sources about to be followed are moved onto the entry, since following
+// starts from the current entry.
+func Seek(src interface{}, c journal.Cursor, follow bool) (journal.Cursor, error) {
+
+	s, ok := src.(interface{ SeekCursor(journal.Cursor) error })
+	if !ok || c.IsZero() {
+		return journal.Cursor{}, nil
+	}
+
+	if err := s.SeekCursor(c); err != nil {
+		return journal.Cursor{}, fmt.Errorf("failed to seek to saved cursor: %w", err)
+	}
+
+	if r, ok := src.(journal.Reader); ok && follow {
+		if _, err := r.Next(); err != nil {
+			return journal.Cursor{}, fmt.Errorf("failed to move to saved cursor: %w", err)
+		}
+	}
+
+	return c, nil
+}
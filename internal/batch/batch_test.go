@@ -0,0 +1,175 @@
+// +build linux
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// recorder records the messages of the batches exported, failing the
+// export of the batch numbered fail, counting from 1, if set
+type recorder struct {
+	batches []string
+	fail    int
+}
+
+func (r *recorder) export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(r.batches)+1 == r.fail {
+		r.fail = 0
+		return errors.New("export failed")
+	}
+
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.Fields[journal.FieldMessage]
+	}
+	r.batches = append(r.batches, strings.Join(msgs, " "))
+
+	return nil
+}
+
+func (r *recorder) result() string {
+	return strings.Join(r.batches, "; ")
+}
+
+func TestBatcher(t *testing.T) {
+
+	entries := journaltest.Entries(5)
+
+	var (
+		rec         = &recorder{fail: 2}
+		checkpoints []string
+	)
+
+	b := NewBatcher(Config{
+		Size: 2,
+		Checkpoint: func(c journal.Cursor) error {
+			for _, e := range entries {
+				if e.Cursor == c {
+					checkpoints = append(checkpoints, e.Fields[journal.FieldMessage])
+				}
+			}
+			return nil
+		},
+	}, rec.export)
+
+	ctx := context.Background()
+
+	steps := []struct {
+		step func() error
+		err  bool
+	}{
+		{func() error { return b.Add(ctx, entries[0]) }, false},
+		{func() error { return b.Add(ctx, entries[1]) }, false},
+		// Skipped entries are checkpointed with the next batch
+		{func() error { b.Skip(entries[2].Cursor); return nil }, false},
+		{func() error { return b.Add(ctx, entries[3]) }, false},
+		// The second batch fails and is kept
+		{func() error { return b.Add(ctx, entries[4]) }, true},
+		{func() error { return b.Flush(ctx) }, false},
+		// Nothing to export or checkpoint
+		{func() error { return b.Flush(ctx) }, false},
+	}
+
+	for i, s := range steps {
+		if err := s.step(); (err != nil) != s.err {
+			t.Fatalf("step %d: expected error %v, got %v", i, s.err, err)
+		}
+	}
+
+	if want := "1 2; 4 5"; rec.result() != want {
+		t.Errorf("expected batches [%s], got [%s]", want, rec.result())
+	}
+	if want := "2 5"; strings.Join(checkpoints, " ") != want {
+		t.Errorf("expected checkpoints [%s], got [%s]", want, strings.Join(checkpoints, " "))
+	}
+	if b.Len() != 0 {
+		t.Errorf("expected no pending entries, got %d", b.Len())
+	}
+}
+
+func TestReadFollow(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateFile := filepath.Join(dir, "state")
+	entries := journaltest.Entries(5)
+
+	// Reading fails after the first batch, which is checkpointed
+	rec := &recorder{fail: 2}
+	cfg := Config{Size: 2, StateFile: stateFile}
+
+	if err := Read(context.Background(), &journaltest.SliceReader{Entries: entries}, cfg, rec.export); err == nil {
+		t.Fatal("expected export error")
+	}
+	if want := "1 2"; rec.result() != want {
+		t.Errorf("read: expected batches [%s], got [%s]", want, rec.result())
+	}
+
+	c, err := LoadCursor(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != entries[1].Cursor {
+		t.Errorf("expected saved cursor %s, got %s", entries[1].Cursor, c)
+	}
+
+	// Following resumes after the saved cursor
+	rec = &recorder{}
+	cfg.Interval = time.Hour
+
+	stop, err := Follow(&journaltest.Follower{SliceReader: journaltest.SliceReader{Entries: entries}}, cfg, rec.export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if c, _ := LoadCursor(stateFile); c == entries[3].Cursor || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Stopping exports the partial batch
+	stop()
+
+	if want := "3 4; 5"; rec.result() != want {
+		t.Errorf("follow: expected batches [%s], got [%s]", want, rec.result())
+	}
+	if c, _ := LoadCursor(stateFile); c != entries[4].Cursor {
+		t.Errorf("expected saved cursor %s, got %s", entries[4].Cursor, c)
+	}
+}
+
+func BenchmarkBatcher(b *testing.B) {
+
+	entries := journaltest.Entries(1000)
+
+	batcher := NewBatcher(Config{Size: 100}, func(ctx context.Context, entries []*journal.Entry) error {
+		return nil
+	})
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := batcher.Add(context.Background(), entries[i%len(entries)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
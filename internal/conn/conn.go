@@ -0,0 +1,187 @@
+// +build linux
+
+// Package conn manages the connection of exporters sending messages over
+// UDP, TCP or TLS, reconnecting when the server has closed it
+package conn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Config configures a Conn
+type Config struct {
+	// Network is "udp", "tcp" or "tls"
+	Network string
+	// Address of the server
+	Address string
+	// TLSConfig is used when Network is "tls". Defaults to verifying the
+	// server using the system roots.
+	TLSConfig *tls.Config
+	// DialTimeout is the maximum time to connect
+	DialTimeout time.Duration
+	// WriteTimeout is the maximum time to write a message
+	WriteTimeout time.Duration
+	// Name of the server in errors, e.g. "syslog server"
+	Name string
+}
+
+// Conn is a connection to a server, made when first written to and made
+// again after the server has closed it.
+// NOTE: A Conn must not be used concurrently.
+type Conn struct {
+	cfg  Config
+	conn net.Conn
+	// The TCP connection of conn, nil for udp
+	raw *net.TCPConn
+}
+
+// New creates a Conn
+func New(cfg Config) *Conn {
+	return &Conn{
+		cfg: cfg,
+	}
+}
+
+// Write writes a message, connecting to the server first if needed.
+// A plain TCP connection closed by the server is noticed before writing.
+// A closed TLS connection is only noticed when writing fails, in which
+// case the server is reconnected to once and the message written again.
+// The connection is closed if writing fails.
+func (c *Conn) Write(ctx context.Context, b []byte) error {
+
+	if c.conn != nil && c.cfg.Network == "tcp" && !c.alive() {
+		c.Close()
+	}
+
+	reused := c.conn != nil
+
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := c.write(b)
+
+	if err != nil && reused && c.cfg.Network == "tls" {
+		c.Close()
+		if err := c.connect(ctx); err != nil {
+			return err
+		}
+		err = c.write(b)
+	}
+
+	if err != nil {
+		c.Close()
+	}
+
+	return err
+}
+
+// Close closes the connection, if connected
+func (c *Conn) Close() error {
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	c.raw = nil
+
+	return err
+}
+
+// connect connects to the server
+func (c *Conn) connect(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.DialTimeout)
+	defer cancel()
+
+	d := net.Dialer{}
+
+	network := c.cfg.Network
+	if network == "tls" {
+		network = "tcp"
+	}
+
+	conn, err := d.DialContext(ctx, network, c.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", c.cfg.Name, err)
+	}
+
+	raw, _ := conn.(*net.TCPConn)
+
+	if c.cfg.Network == "tls" {
+		cfg := &tls.Config{}
+		if c.cfg.TLSConfig != nil {
+			cfg = c.cfg.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(c.cfg.Address)
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		if deadline, ok := ctx.Deadline(); ok {
+			tlsConn.SetDeadline(deadline)
+		}
+
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to connect to %s: %w", c.cfg.Name, err)
+		}
+
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+
+	c.conn = conn
+	c.raw = raw
+
+	return nil
+}
+
+// alive returns false if the server has closed a plain TCP connection.
+// The first write after the server closes a connection usually succeeds
+// while the message is lost. Servers don't send anything, so anything to
+// read, including end of file, means the connection is closed. This
+// doesn't hold for TLS, where servers send session tickets and alerts.
+func (c *Conn) alive() bool {
+
+	if c.raw == nil {
+		return true
+	}
+
+	rc, err := c.raw.SyscallConn()
+	if err != nil {
+		return true
+	}
+
+	alive := true
+
+	rc.Read(func(fd uintptr) bool {
+		var b [1]byte
+		_, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		alive = err == syscall.EAGAIN
+		return true
+	})
+
+	return alive
+}
+
+// write writes a message within the write timeout
+func (c *Conn) write(b []byte) error {
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
+
+	if _, err := c.conn.Write(b); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", c.cfg.Name, err)
+	}
+
+	return nil
+}
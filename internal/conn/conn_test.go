@@ -0,0 +1,253 @@
+// +build linux
+
+package conn
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer accepts connections and reads newline terminated messages.
+// Every connection is closed after reading closeAfter messages, if set.
+type testServer struct {
+	l          net.Listener
+	closeAfter int
+	conns      int
+	messages   []string
+	mutex      sync.Mutex
+	wg         sync.WaitGroup
+}
+
+func newTestServer(t *testing.T, network string, closeAfter int) *testServer {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if network == "tls" {
+		// Requesting a client certificate makes the server send session
+		// tickets after the handshake is complete
+		l = tls.NewListener(l, &tls.Config{
+			Certificates: []tls.Certificate{testCertificate(t)},
+			ClientAuth:   tls.RequestClientCert,
+		})
+	}
+
+	s := &testServer{l: l, closeAfter: closeAfter}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mutex.Lock()
+			s.conns++
+			s.mutex.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(c)
+			}()
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) serve(c net.Conn) {
+
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.messages = append(s.messages, strings.TrimSuffix(line, "\n"))
+		s.mutex.Unlock()
+
+		if n == s.closeAfter {
+			return
+		}
+	}
+}
+
+// wait waits until n messages have been received and returns the number
+// of connections and the messages
+func (s *testServer) wait(t *testing.T, n int) (int, string) {
+
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		s.mutex.Lock()
+		conns, messages := s.conns, strings.Join(s.messages, " ")
+		received := len(s.messages)
+		s.mutex.Unlock()
+
+		if received >= n {
+			return conns, messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d messages, got [%s]", n, messages)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *testServer) close() {
+	s.l.Close()
+	s.wg.Wait()
+}
+
+// testCertificate creates a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T) tls.Certificate {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestConnWrite(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		network    string
+		closeAfter int
+		// Messages expected to be received, a TLS connection closed by
+		// the server loses the message written first after closing
+		want  string
+		conns int
+	}{
+		{"tcp", "tcp", 0, "1 2 3", 1},
+		{"tcp closed", "tcp", 1, "1 2 3", 3},
+		// Session tickets sent by TLS 1.3 servers to clients with a
+		// session cache must not be taken for the connection being closed
+		{"tls", "tls", 0, "1 2 3", 1},
+		{"tls closed", "tls", 1, "1 3", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, test.network, test.closeAfter)
+			defer s.close()
+
+			c := New(Config{
+				Network: test.network,
+				Address: s.l.Addr().String(),
+				TLSConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					ClientSessionCache: tls.NewLRUClientSessionCache(1),
+				},
+				DialTimeout:  time.Second,
+				WriteTimeout: time.Second,
+				Name:         "test server",
+			})
+			defer c.Close()
+
+			for i, msg := range []string{"1", "2", "3"} {
+				if err := c.Write(context.Background(), []byte(msg+"\n")); err != nil {
+					t.Fatal(err)
+				}
+
+				// Let the server read the message, and close the connection
+				// if it does, before writing the next one
+				if i == 0 {
+					s.wait(t, 1)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			conns, got := s.wait(t, len(strings.Fields(test.want)))
+			if got != test.want {
+				t.Errorf("expected messages [%s], got [%s]", test.want, got)
+			}
+			if conns != test.conns {
+				t.Errorf("expected %d connections, got %d", test.conns, conns)
+			}
+		})
+	}
+}
+
+func BenchmarkConnWrite(b *testing.B) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 64*1024)
+		for {
+			if _, err := c.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := New(Config{
+		Network:      "tcp",
+		Address:      l.Addr().String(),
+		DialTimeout:  time.Second,
+		WriteTimeout: time.Second,
+		Name:         "test server",
+	})
+	defer c.Close()
+
+	msg := []byte("<14>1 2020-09-13T12:26:40.000000Z host app 42 - - message\n")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := c.Write(context.Background(), msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
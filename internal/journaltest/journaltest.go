@@ -0,0 +1,114 @@
+// +build linux
+
+// Package journaltest provides entries and readers for the tests of the
+// packages of this module
+package journaltest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// SeqnumID is the sequence number ID of the cursors of Entries
+const SeqnumID = "0f4c0a0e2b6c4d0a9a3f8c1d2e3f4a5b"
+
+// Entries returns n entries with cursors, timestamps a second apart and
+// messages numbered from 1
+func Entries(n int) []*journal.Entry {
+
+	entries := make([]*journal.Entry, n)
+
+	for i := range entries {
+		c, err := journal.ParseCursor(fmt.Sprintf("s=%s;i=%x;b=%s;m=%x;t=%x;x=%x",
+			SeqnumID, i+1, SeqnumID, i+1, 1600000000000000+i, i+1))
+		if err != nil {
+			panic(err)
+		}
+
+		entries[i] = &journal.Entry{
+			Fields:    journal.Fields{journal.FieldMessage: fmt.Sprintf("%d", i+1)},
+			Cursor:    c,
+			Timestamp: time.Unix(1600000000+int64(i), 0).UTC(),
+		}
+	}
+
+	return entries
+}
+
+// Messages returns the messages of entries separated by spaces
+func Messages(entries []*journal.Entry) string {
+
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.Fields[journal.FieldMessage]
+	}
+
+	return strings.Join(msgs, " ")
+}
+
+// SliceReader is a journal.Reader of a slice of entries
+type SliceReader struct {
+	Entries []*journal.Entry
+	pos     int
+}
+
+// Next moves to the next entry and returns 0 if there are none
+func (r *SliceReader) Next() (int, error) {
+	if r.pos >= len(r.Entries) {
+		return 0, nil
+	}
+	r.pos++
+	return 1, nil
+}
+
+// ReadEntry returns the current entry
+func (r *SliceReader) ReadEntry() (*journal.Entry, error) {
+	return r.Entries[r.pos-1], nil
+}
+
+// SeekCursor moves before the entry of a cursor
+func (r *SliceReader) SeekCursor(c journal.Cursor) error {
+	for i, e := range r.Entries {
+		if e.Cursor == c {
+			r.pos = i
+			return nil
+		}
+	}
+	return fmt.Errorf("cursor %s not found", c)
+}
+
+// Follower passes its entries to the handler and waits to be stopped.
+// Unless IgnoreStop is set, the handler is then called with
+// ErrFollowStopped.
+type Follower struct {
+	SliceReader
+	IgnoreStop bool
+}
+
+// Follow implements journal.Follower
+func (f *Follower) Follow(h journal.FollowHandler) (journal.FollowStop, error) {
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		for f.pos < len(f.Entries) {
+			f.pos++
+			h(f.Entries[f.pos-1], nil)
+		}
+
+		<-done
+		if !f.IgnoreStop {
+			h(nil, journal.ErrFollowStopped)
+		}
+		close(stopped)
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
@@ -0,0 +1,111 @@
+// +build linux
+
+// Package retry retries operations with exponential backoff
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Backoff configures how an operation is retried.
+// Zero values are replaced by defaults.
+type Backoff struct {
+	// Attempts is the maximum number of attempts. Defaults to 5.
+	// A negative value retries until the context is done.
+	Attempts int
+	// Min is the delay before the first retry. Defaults to 500ms.
+	Min time.Duration
+	// Max is the maximum delay between attempts. Defaults to 30s.
+	Max time.Duration
+}
+
+// WithRetries returns a Backoff for exporters configured with a number of
+// retries, negative to retry forever, and the delay before the first retry
+func WithRetries(retries int, delay time.Duration) Backoff {
+
+	b := Backoff{Min: delay}
+
+	switch {
+	case retries < 0:
+		b.Attempts = -1
+	case retries > 0:
+		b.Attempts = retries + 1
+	}
+
+	return b
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error that must not be retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the attempts
+// are used up or ctx is done. The delay between attempts doubles up to
+// Max, with some jitter. The last error of fn is returned, unwrapped if
+// permanent.
+func (b Backoff) Do(ctx context.Context, fn func() error) error {
+
+	if b.Attempts == 0 {
+		b.Attempts = 5
+	}
+	if b.Min <= 0 {
+		b.Min = 500 * time.Millisecond
+	}
+	if b.Max <= 0 {
+		b.Max = 30 * time.Second
+	}
+
+	delay := b.Min
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+
+		if b.Attempts > 0 && attempt >= b.Attempts {
+			return err
+		}
+
+		// Up to 25% jitter so clients do not retry in lockstep
+		wait := delay + time.Duration(rand.Int63n(int64(delay)/4+1))
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		delay *= 2
+		if delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// +build linux
+
+// Package testfile provides files from testdata for the tests of the
+// packages of this module, including those of the journal package which
+// internal/journaltest cannot serve
+package testfile
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Gunzip decompresses the gzip file src into a temporary directory and
+// returns the path of the file, named as src without its .gz extension,
+// along with a function removing it
+func Gunzip(t testing.TB, src string) (string, func()) {
+
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "testfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, strings.TrimSuffix(filepath.Base(src), ".gz"))
+	if err := gunzip(src, path); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func gunzip(src, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, zr); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
@@ -11,10 +11,12 @@ import (
 	"C"
 )
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -34,7 +36,7 @@ const (
 	FieldInvocationID            = "INVOCATION_ID"
 	FieldUserInvocationID        = "USER_INVOCATION_ID"
 	FieldSyslogFacility          = "SYSLOG_FACILITY"
-	FieldSyslogIdentifier        = "SYSLOG_INDENTIFIER"
+	FieldSyslogIdentifier        = "SYSLOG_IDENTIFIER"
 	FieldSyslogPID               = "SYSLOG_PID"
 	FieldSyslogTimestamp         = "SYSLOG_TIMESTAMP"
 	FieldSyslogRaw               = "SYSLOG_RAW"
@@ -65,6 +67,28 @@ const (
 	FieldMonotonicTimestamp      = "__MONOTONIC_TIMESTAMP"
 )
 
+// Maximum number of field names, besides the predefined ones,
+// interned by a journal instance
+const maxInternedNames = 1024
+
+// commonFieldNames holds the predefined field names for interning
+var commonFieldNames = map[string]string{}
+
+func init() {
+	for _, n := range []string{
+		FieldMessage, FieldMessageID, FieldPriority, FieldCodeFile, FieldCodeLine,
+		FieldCodeFunc, FieldErrNo, FieldInvocationID, FieldUserInvocationID,
+		FieldSyslogFacility, FieldSyslogIdentifier, FieldSyslogPID, FieldSyslogTimestamp,
+		FieldSyslogRaw, FieldDocumentation, FieldPID, FieldUID, FieldGID, FieldComm,
+		FieldExe, FieldCmdLine, FieldCapEffective, FieldAuditSession, FieldAuditLoginUID,
+		FieldCGroup, FieldSession, FieldUnit, FieldUserUnit, FieldOwnerUID, FieldSlice,
+		FieldSELinuxContext, FieldSourceRealtimeTimestamp, FieldBootID, FieldMachineID,
+		FieldHostname, FieldTransport,
+	} {
+		commonFieldNames[n] = n
+	}
+}
+
 // Priority is a type to describe log entry priority
 type Priority int
 
@@ -80,6 +104,10 @@ func (p Priority) String() string {
 		"Debug",
 	}
 
+	if p < 0 || int(p) >= len(names) {
+		return "Priority(" + strconv.Itoa(int(p)) + ")"
+	}
+
 	return names[p]
 }
 
@@ -106,6 +134,8 @@ const (
 var (
 	// ErrFollowStopped is sent to handler if following is externally stopped.
 	ErrFollowStopped = errors.New("journal: follow stopped")
+	// ErrFieldNotFound is returned when reading a field not present in an entry.
+	ErrFieldNotFound = errors.New("journal: field not found")
 )
 
 // WakeupEvent represents the outcome of a wait operation
@@ -125,6 +155,16 @@ type Journal struct {
 	sdJournal *C.struct_sd_journal
 	matches   []*Match
 	mutex     sync.Mutex
+
+	// Opens a new instance with the same source, used by Follow
+	open func() (*Journal, error)
+	// Directories or files the instance reads from
+	dirs  []string
+	files []string
+
+	// Interned field names and scratch space used when reading entries
+	names map[string]string
+	seen  map[string]struct{}
 }
 
 // Fields is a map containing fields of an entry
@@ -133,9 +173,12 @@ type Fields map[string]string
 // Entry contains all fields and meta-data for journal entry
 type Entry struct {
 	Fields    `json:"fields"`
-	Cursor    string        `json:"cursor"`
+	Cursor    Cursor        `json:"cursor"`
 	Timestamp time.Time     `json:"timestamp"`
 	Elapsed   time.Duration `json:"elapsed"`
+
+	// Boot ID as returned along with the monotonic timestamp
+	bootID ID128
 }
 
 func (e *Entry) String() string {
@@ -157,7 +200,73 @@ func Open() (*Journal, error) {
 		return nil, fmt.Errorf("failed to open journal: %w", syscall.Errno(-ret))
 	}
 
-	j := Journal{sdJournal: sdJournal}
+	j := Journal{
+		sdJournal: sdJournal,
+		open:      Open,
+		dirs:      []string{"/run/log/journal", "/var/log/journal"},
+	}
+
+	return &j, nil
+}
+
+// OpenDirectory creates a new journal instance reading the journal
+// files in the specified directory
+func OpenDirectory(path string) (*Journal, error) {
+
+	p := C.CString(path)
+	defer C.free(unsafe.Pointer(p))
+
+	var sdJournal *C.struct_sd_journal
+	ret := int(C.sd_journal_open_directory(&sdJournal, p, 0))
+	if ret != 0 {
+		return nil, fmt.Errorf("failed to open journal directory '%s': %w", path, syscall.Errno(-ret))
+	}
+
+	j := Journal{
+		sdJournal: sdJournal,
+		open: func() (*Journal, error) {
+			return OpenDirectory(path)
+		},
+		dirs: []string{path},
+	}
+
+	return &j, nil
+}
+
+// OpenFiles creates a new journal instance reading the specified
+// journal files
+func OpenFiles(paths ...string) (*Journal, error) {
+
+	if len(paths) == 0 {
+		return nil, errors.New("no journal files to open")
+	}
+
+	// NULL-terminated array of C strings
+	cpaths := make([]*C.char, len(paths)+1)
+	for i, path := range paths {
+		cpaths[i] = C.CString(path)
+		defer C.free(unsafe.Pointer(cpaths[i]))
+	}
+
+	arr := (**C.char)(C.malloc(C.size_t(len(cpaths)) * C.size_t(unsafe.Sizeof(cpaths[0]))))
+	defer C.free(unsafe.Pointer(arr))
+	copy((*[1 << 20]*C.char)(unsafe.Pointer(arr))[:len(cpaths):len(cpaths)], cpaths)
+
+	var sdJournal *C.struct_sd_journal
+	ret := int(C.sd_journal_open_files(&sdJournal, arr, 0))
+	if ret != 0 {
+		return nil, fmt.Errorf("failed to open journal files: %w", syscall.Errno(-ret))
+	}
+
+	files := append([]string(nil), paths...)
+
+	j := Journal{
+		sdJournal: sdJournal,
+		open: func() (*Journal, error) {
+			return OpenFiles(files...)
+		},
+		files: files,
+	}
 
 	return &j, nil
 }
@@ -268,9 +377,9 @@ func (j *Journal) SeekTimestamp(timestamp time.Time) error {
 // SeekCursor moves cursor to specified cursor.
 // NOTE: This call must be followed by a call to Next (or a similar call)
 // before any data can be read
-func (j *Journal) SeekCursor(cursor string) error {
+func (j *Journal) SeekCursor(cursor Cursor) error {
 
-	c := C.CString(cursor)
+	c := C.CString(cursor.String())
 	defer C.free(unsafe.Pointer(c))
 
 	j.mutex.Lock()
@@ -285,26 +394,33 @@ func (j *Journal) SeekCursor(cursor string) error {
 }
 
 // Cursor returns the current cursor position
-func (j *Journal) Cursor() (string, error) {
-	var cursor *C.char
+func (j *Journal) Cursor() (Cursor, error) {
 
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
+	return j.cursor()
+}
+
+// cursor reads the current cursor position.
+// NOTE: The caller must hold the journal mutex.
+func (j *Journal) cursor() (Cursor, error) {
+	var cursor *C.char
+
 	if ret := C.sd_journal_get_cursor(j.sdJournal, &cursor); ret < 0 {
-		return "", fmt.Errorf("failed to read cursor: %w", syscall.Errno(-ret))
+		return Cursor{}, fmt.Errorf("failed to read cursor: %w", syscall.Errno(-ret))
 	}
 
 	defer C.free(unsafe.Pointer(cursor))
 
-	return C.GoString(cursor), nil
+	return ParseCursor(C.GoString(cursor))
 }
 
 // TestCursor tests if the current position in the journal
 // matches the specified cursor
-func (j *Journal) TestCursor(cursor string) (bool, error) {
+func (j *Journal) TestCursor(cursor Cursor) (bool, error) {
 
-	c := C.CString(cursor)
+	c := C.CString(cursor.String())
 	defer C.free(unsafe.Pointer(c))
 
 	j.mutex.Lock()
@@ -360,33 +476,77 @@ func (j *Journal) ReadEntry() (*Entry, error) {
 		Fields: Fields{},
 	}
 
-	var timestampUsec C.uint64_t
-	var bootID C.sd_id128_t
+	if err := j.ReadEntryInto(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// ReadEntryInto reads a full entry from current cursor position into
+// an existing entry. The Fields map of entry is reused and field values
+// unchanged since the previous read are kept rather than copied again.
+// Use it to reduce allocations when reading large numbers of entries.
+func (j *Journal) ReadEntryInto(entry *Entry) error {
+
+	if entry.Fields == nil {
+		entry.Fields = Fields{}
+	}
 
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
-	// Timestamp
-	if ret := C.sd_journal_get_realtime_usec(j.sdJournal, &timestampUsec); ret < 0 {
-		return nil, fmt.Errorf("failed to get realtime timestamp: %w", syscall.Errno(-ret))
+	if err := j.readEntryMeta(entry); err != nil {
+		return err
 	}
 
-	entry.Timestamp = time.Unix(0, int64(timestampUsec)*int64(time.Microsecond))
-
-	// Elapsed
-	if ret := C.sd_journal_get_monotonic_usec(j.sdJournal, &timestampUsec, &bootID); ret < 0 {
-		return nil, fmt.Errorf("failed to get monotonic timestamp: %w", syscall.Errno(-ret))
+	// Names of the fields read, to remove the fields left from the
+	// previous entry. Cleared rather than reallocated for every entry.
+	if j.seen == nil {
+		j.seen = map[string]struct{}{}
+	}
+	for n := range j.seen {
+		delete(j.seen, n)
 	}
 
-	entry.Elapsed = time.Duration(int64(timestampUsec))
+	err := j.eachField(func(name, value []byte) bool {
+		n := j.internName(name)
+		if old, ok := entry.Fields[n]; !ok || old != string(value) {
+			entry.Fields[n] = string(value)
+		}
+		j.seen[n] = struct{}{}
+		return true
+	})
+	if err != nil {
+		return err
+	}
 
-	// Cursor
-	var cursor *C.char
-	if ret := C.sd_journal_get_cursor(j.sdJournal, &cursor); ret < 0 {
-		return nil, fmt.Errorf("failed to read cursor: %w", syscall.Errno(-ret))
+	if len(entry.Fields) != len(j.seen) {
+		for n := range entry.Fields {
+			if _, ok := j.seen[n]; !ok {
+				delete(entry.Fields, n)
+			}
+		}
 	}
-	entry.Cursor = C.GoString(cursor)
-	C.free(unsafe.Pointer(cursor))
+
+	return nil
+}
+
+// EachField calls fn for each field of the entry at current cursor
+// position until fn returns false. Name and value refer to memory owned
+// by the journal and are only valid until fn returns. Copy them to keep
+// them any longer.
+func (j *Journal) EachField(fn func(name, value []byte) bool) error {
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.eachField(fn)
+}
+
+// eachField enumerates the fields of the current entry.
+// NOTE: The caller must hold the journal mutex.
+func (j *Journal) eachField(fn func(name, value []byte) bool) error {
 
 	var (
 		d   unsafe.Pointer
@@ -400,21 +560,121 @@ func (j *Journal) ReadEntry() (*Entry, error) {
 		if ret = C.sd_journal_enumerate_data(j.sdJournal, &d, &l); ret == 0 {
 			break
 		} else if ret < 0 {
-			return nil, fmt.Errorf("failed to read message field: %w", syscall.Errno(-ret))
+			return fmt.Errorf("failed to read message field: %w", syscall.Errno(-ret))
+		}
+
+		data := (*[1 << 30]byte)(d)[:l:l]
+
+		idx := bytes.IndexByte(data, '=')
+		if idx < 0 {
+			return fmt.Errorf("failed to parse field")
 		}
 
-		msg := C.GoStringN((*C.char)(d), C.int(l))
-		kv := strings.SplitN(msg, "=", 2)
-		if len(kv) < 2 {
-			return nil, fmt.Errorf("failed to parse field")
+		if !fn(data[:idx], data[idx+1:]) {
+			break
 		}
+	}
+
+	return nil
+}
+
+// internName returns a shared string for a field name to avoid
+// allocating the same names for every entry read.
+// NOTE: The caller must hold the journal mutex.
+func (j *Journal) internName(name []byte) string {
+
+	if n, ok := commonFieldNames[string(name)]; ok {
+		return n
+	}
+
+	if n, ok := j.names[string(name)]; ok {
+		return n
+	}
 
-		entry.Fields[kv[0]] = kv[1]
+	n := string(name)
+
+	if j.names == nil {
+		j.names = map[string]string{}
+	}
+	if len(j.names) < maxInternedNames {
+		j.names[n] = n
+	}
+
+	return n
+}
+
+// ReadEntryFields reads an entry from current cursor position but only
+// the named fields. Fields not present in the entry are left out. This is
+// considerably cheaper than ReadEntry when only a few fields are needed.
+// NOTE: Only the first value is read of fields occurring multiple times.
+func (j *Journal) ReadEntryFields(names ...string) (*Entry, error) {
+
+	entry := &Entry{
+		Fields: make(Fields, len(names)),
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := j.readEntryMeta(entry); err != nil {
+		return nil, err
+	}
+
+	var (
+		d unsafe.Pointer
+		l C.size_t
+	)
+
+	for _, name := range names {
+		f := C.CString(name)
+		ret := C.sd_journal_get_data(j.sdJournal, f, &d, &l)
+		C.free(unsafe.Pointer(f))
+
+		if ret == -C.int(syscall.ENOENT) {
+			continue
+		} else if ret < 0 {
+			return nil, fmt.Errorf("failed to get field '%s': %w", name, syscall.Errno(-ret))
+		}
+
+		data := C.GoStringN((*C.char)(d), C.int(l))
+		entry.Fields[name] = strings.TrimPrefix(data, name+"=")
 	}
 
 	return entry, nil
 }
 
+// readEntryMeta reads timestamps, boot ID and cursor of the current entry.
+// NOTE: The caller must hold the journal mutex.
+func (j *Journal) readEntryMeta(entry *Entry) error {
+
+	var timestampUsec C.uint64_t
+	var bootID C.sd_id128_t
+
+	// Timestamp
+	if ret := C.sd_journal_get_realtime_usec(j.sdJournal, &timestampUsec); ret < 0 {
+		return fmt.Errorf("failed to get realtime timestamp: %w", syscall.Errno(-ret))
+	}
+
+	entry.Timestamp = time.Unix(0, int64(timestampUsec)*int64(time.Microsecond))
+
+	// Elapsed
+	if ret := C.sd_journal_get_monotonic_usec(j.sdJournal, &timestampUsec, &bootID); ret < 0 {
+		return fmt.Errorf("failed to get monotonic timestamp: %w", syscall.Errno(-ret))
+	}
+
+	entry.Elapsed = time.Duration(int64(timestampUsec))
+	entry.bootID = id128FromC(bootID)
+
+	// Cursor
+	cursor, err := j.cursor()
+	if err != nil {
+		return err
+	}
+	entry.Cursor = cursor
+
+	return nil
+}
+
 // Usage returns the journal disk space usage.
 func (j *Journal) Usage() (uint64, error) {
 
@@ -430,6 +690,23 @@ func (j *Journal) Usage() (uint64, error) {
 	return uint64(usage), nil
 }
 
+// Cutoff returns the realtime timestamps of the oldest and newest
+// entries of the journal.
+func (j *Journal) Cutoff() (time.Time, time.Time, error) {
+
+	var from, to C.uint64_t
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if ret := C.sd_journal_get_cutoff_realtime_usec(j.sdJournal, &from, &to); ret < 0 {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get cutoff timestamps: %w", syscall.Errno(-ret))
+	}
+
+	return time.Unix(0, int64(from)*int64(time.Microsecond)),
+		time.Unix(0, int64(to)*int64(time.Microsecond)), nil
+}
+
 // Wait will synchronously wait for the journal get changed. If
 // -1 is passed as timeout, Wait will infinitely.
 func (j *Journal) Wait(timeout time.Duration) (WakeupEvent, error) {
@@ -529,6 +806,26 @@ func (j *Journal) Catalog() (string, error) {
 	return C.GoString(c), nil
 }
 
+// CatalogForMessageID reads the message catalog entry for a MESSAGE_ID.
+// Unlike Catalog, field references in the entry are not substituted.
+func CatalogForMessageID(id ID128) (string, error) {
+
+	cid, err := id.toC()
+	if err != nil {
+		return "", err
+	}
+
+	var c *C.char
+
+	if ret := C.sd_journal_get_catalog_for_message_id(cid, &c); ret < 0 {
+		return "", fmt.Errorf("failed to read catalog entry for %s: %w", id, syscall.Errno(-ret))
+	}
+
+	defer C.free(unsafe.Pointer(c))
+
+	return C.GoString(c), nil
+}
+
 // UniqueValues returns all unique values for a given field.
 func (j *Journal) UniqueValues(field string) ([]string, error) {
 
@@ -0,0 +1,246 @@
+// +build linux
+
+package journal
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vargspjut/systemd-journal/internal/testfile"
+)
+
+// fixture decompresses a journal file from testdata into a temporary
+// directory and returns its path along with a function removing it
+func fixture(t testing.TB, name string) (string, func()) {
+
+	t.Helper()
+
+	return testfile.Gunzip(t, filepath.Join("testdata", name+".gz"))
+}
+
+// openFixture opens a journal file from testdata
+func openFixture(t testing.TB, name string) (*Journal, func()) {
+
+	t.Helper()
+
+	path, remove := fixture(t, name)
+
+	j, err := OpenFiles(path)
+	if err != nil {
+		remove()
+		t.Fatal(err)
+	}
+
+	return j, func() {
+		j.Close()
+		remove()
+	}
+}
+
+// readAll reads the entries of the journal matching the fixture entries
+// written by the tests, leaving out the ones written by journald
+func readAll(t testing.TB, j *Journal, read func() (*Entry, error)) []*Entry {
+
+	t.Helper()
+
+	if err := j.AddMatch(NewMatch().Match(FieldSyslogIdentifier, "fixture")); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []*Entry
+
+	for {
+		n, err := j.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			return entries
+		}
+
+		e, err := read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, e)
+	}
+}
+
+func TestReadEntryInto(t *testing.T) {
+
+	j, done := openFixture(t, "entries.journal")
+	defer done()
+
+	// The fields of the previous entries must not be returned as part of
+	// the next ones, even when an entry repeats a field name
+	reused := &Entry{}
+	got := readAll(t, j, func() (*Entry, error) {
+		if err := j.ReadEntryInto(reused); err != nil {
+			return nil, err
+		}
+
+		e := *reused
+		e.Fields = Fields{}
+		for k, v := range reused.Fields {
+			e.Fields[k] = v
+		}
+
+		return &e, nil
+	})
+
+	j.FlushMatches()
+	if err := j.SeekHead(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := readAll(t, j, j.ReadEntry)
+
+	if len(got) != 4 || len(got) != len(want) {
+		t.Fatalf("expected 4 entries, got %d and %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("entry %d: expected %v, got %v", i, want[i].Fields, got[i].Fields)
+		}
+	}
+
+	if _, ok := got[1].Fields["STALE"]; ok {
+		t.Error("field of the first entry returned with the second")
+	}
+	if got[1].Fields["DUP"] == "" {
+		t.Error("repeated field missing")
+	}
+}
+
+func TestReadEntryFields(t *testing.T) {
+
+	j, done := openFixture(t, "entries.journal")
+	defer done()
+
+	tests := []struct {
+		names []string
+		want  []Fields
+	}{
+		{
+			names: []string{FieldMessage, FieldPriority},
+			want: []Fields{
+				{FieldMessage: "first entry", FieldPriority: "6"},
+				{FieldMessage: "second entry", FieldPriority: "3"},
+				{FieldMessage: "third\nentry", FieldPriority: "7"},
+				{FieldMessage: "fourth entry", FieldPriority: "6"},
+			},
+		},
+		{
+			names: []string{"STALE", "BINARY"},
+			want: []Fields{
+				{"STALE": "only in the first entry"},
+				{},
+				{"BINARY": "a\x00b"},
+				{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		j.FlushMatches()
+		if err := j.SeekHead(); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := readAll(t, j, func() (*Entry, error) {
+			return j.ReadEntryFields(test.names...)
+		})
+
+		if len(entries) != len(test.want) {
+			t.Fatalf("%v: expected %d entries, got %d", test.names, len(test.want), len(entries))
+		}
+
+		for i, e := range entries {
+			if !reflect.DeepEqual(e.Fields, test.want[i]) {
+				t.Errorf("%v: entry %d: expected %v, got %v", test.names, i, test.want[i], e.Fields)
+			}
+			if e.Cursor.IsZero() || e.Timestamp.IsZero() {
+				t.Errorf("%v: entry %d: cursor or timestamp missing", test.names, i)
+			}
+		}
+	}
+}
+
+func BenchmarkReadEntry(b *testing.B) {
+
+	j, done := openFixture(b, "entries.journal")
+	defer done()
+
+	benchmarkRead(b, j, func() error {
+		_, err := j.ReadEntry()
+		return err
+	})
+}
+
+func BenchmarkReadEntryFields(b *testing.B) {
+
+	j, done := openFixture(b, "entries.journal")
+	defer done()
+
+	benchmarkRead(b, j, func() error {
+		_, err := j.ReadEntryFields(FieldMessage, FieldPriority)
+		return err
+	})
+}
+
+func BenchmarkReadEntryInto(b *testing.B) {
+
+	j, done := openFixture(b, "entries.journal")
+	defer done()
+
+	e := &Entry{}
+
+	benchmarkRead(b, j, func() error {
+		return j.ReadEntryInto(e)
+	})
+}
+
+func BenchmarkEachField(b *testing.B) {
+
+	j, done := openFixture(b, "entries.journal")
+	defer done()
+
+	benchmarkRead(b, j, func() error {
+		return j.EachField(func(name, value []byte) bool {
+			return true
+		})
+	})
+}
+
+// benchmarkRead reads the entries of j over and over, reporting the cost
+// per entry read
+func benchmarkRead(b *testing.B, j *Journal, read func() error) {
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n, err := j.Next()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if n == 0 {
+			b.StopTimer()
+			if err := j.SeekHead(); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := j.Next(); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+		}
+
+		if err := read(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,678 @@
+// +build linux
+
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signature found at the start of every journal file
+const fileSignature = "LPKSHHRH"
+
+// Size of the header of the oldest supported journal files and of the
+// largest header known. Fields beyond the header size of a file are zero.
+const (
+	fileHeaderMinSize = 208
+	fileHeaderMaxSize = 272
+)
+
+// Compatible flags of a journal file header. Files with unknown
+// compatible flags can still be read.
+const (
+	FileSealed           uint32 = 1 << 0
+	FileTailEntryBootID  uint32 = 1 << 1
+	FileSealedContinuous uint32 = 1 << 2
+)
+
+// Incompatible flags of a journal file header. Files with unknown
+// incompatible flags cannot be read.
+const (
+	FileCompressedXZ   uint32 = 1 << 0
+	FileCompressedLZ4  uint32 = 1 << 1
+	FileKeyedHash      uint32 = 1 << 2
+	FileCompressedZSTD uint32 = 1 << 3
+	FileCompact        uint32 = 1 << 4
+)
+
+var compatibleFlagNames = []string{
+	"SEALED",
+	"TAIL_ENTRY_BOOT_ID",
+	"SEALED_CONTINUOUS",
+}
+
+var incompatibleFlagNames = []string{
+	"COMPRESSED-XZ",
+	"COMPRESSED-LZ4",
+	"KEYED-HASH",
+	"COMPRESSED-ZSTD",
+	"COMPACT",
+}
+
+// Object types
+const (
+	objectUnused uint8 = iota
+	objectData
+	objectField
+	objectEntry
+	objectDataHashTable
+	objectFieldHashTable
+	objectEntryArray
+	objectTag
+)
+
+// Size of the header common to all objects and of hash table items
+const (
+	objectHeaderSize = 16
+	hashItemSize     = 16
+)
+
+// FileState is the state of a journal file
+type FileState uint8
+
+// FileState constants
+const (
+	// FileOffline indicates a file not currently written to
+	FileOffline FileState = iota
+	// FileOnline indicates a file currently open for writing
+	FileOnline
+	// FileArchived indicates a file rotated out and never written to again
+	FileArchived
+)
+
+func (s FileState) String() string {
+	switch s {
+	case FileOffline:
+		return "offline"
+	case FileOnline:
+		return "online"
+	case FileArchived:
+		return "archived"
+	default:
+		return fmt.Sprintf("FileState(%d)", s)
+	}
+}
+
+// FileKind tells whose entries a journal file holds
+type FileKind int
+
+// FileKind constants
+const (
+	// FileKindOther indicates a file such as one received from a remote host
+	FileKindOther FileKind = iota
+	// FileKindSystem indicates a system journal file
+	FileKindSystem
+	// FileKindUser indicates a user journal file
+	FileKindUser
+)
+
+func (k FileKind) String() string {
+	switch k {
+	case FileKindSystem:
+		return "system"
+	case FileKindUser:
+		return "user"
+	default:
+		return "other"
+	}
+}
+
+// FileHeader is the header of a journal file
+type FileHeader struct {
+	Signature              [8]byte
+	CompatibleFlags        uint32
+	IncompatibleFlags      uint32
+	State                  FileState
+	FileID                 ID128
+	MachineID              ID128
+	TailEntryBootID        ID128
+	SeqnumID               ID128
+	HeaderSize             uint64
+	ArenaSize              uint64
+	DataHashTableOffset    uint64
+	DataHashTableSize      uint64
+	FieldHashTableOffset   uint64
+	FieldHashTableSize     uint64
+	TailObjectOffset       uint64
+	NObjects               uint64
+	NEntries               uint64
+	TailEntrySeqnum        uint64
+	HeadEntrySeqnum        uint64
+	EntryArrayOffset       uint64
+	HeadEntryRealtime      uint64
+	TailEntryRealtime      uint64
+	TailEntryMonotonic     uint64
+	NData                  uint64
+	NFields                uint64
+	NTags                  uint64
+	NEntryArrays           uint64
+	DataHashChainDepth     uint64
+	FieldHashChainDepth    uint64
+	TailEntryArrayOffset   uint32
+	TailEntryArrayNEntries uint32
+	TailEntryOffset        uint64
+}
+
+// FileInfo describes a journal file on disk
+type FileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Kind    FileKind
+	State   FileState
+	// Corrupt is set for files renamed by journald after being found
+	// corrupt (ending in '~') and for files that cannot be parsed.
+	// Only Path, Size, ModTime and Kind are valid for files that
+	// cannot be parsed.
+	Corrupt       bool
+	MachineID     ID128
+	SeqnumID      ID128
+	HeadSeqnum    uint64
+	TailSeqnum    uint64
+	HeadTimestamp time.Time
+	TailTimestamp time.Time
+	Entries       uint64
+	// Boots the entries of the file were written in, in order of
+	// first appearance
+	BootIDs []ID128
+	// Compression algorithms the file may contain objects compressed
+	// with, i.e. "xz", "lz4" or "zstd"
+	Compression []string
+
+	// Number of entries per boot
+	bootEntries map[ID128]uint64
+}
+
+// UsageBreakdown is the disk usage of journal files grouped in
+// different ways. All sizes are in bytes.
+type UsageBreakdown struct {
+	Total  uint64
+	System uint64
+	User   uint64
+	Other  uint64
+	// Usage per machine ID
+	Machines map[ID128]uint64
+	// Usage per boot ID. The size of a file holding entries from several
+	// boots is divided between them by number of entries.
+	Boots map[ID128]uint64
+}
+
+// ReadFileInfo reads information about a journal file. Errors parsing
+// the file are not returned but reported by setting Corrupt.
+// NOTE: All objects of the file are read to find the boots of its
+// entries. Use StatFile if the boots are not needed.
+func ReadFileInfo(path string) (*FileInfo, error) {
+	return readFileInfo(path, true)
+}
+
+// StatFile reads information about a journal file from its header only,
+// leaving BootIDs empty. Only errors parsing the header are reported by
+// setting Corrupt. Unlike ReadFileInfo, the cost does not depend on the
+// size of the file.
+func StatFile(path string) (*FileInfo, error) {
+	return readFileInfo(path, false)
+}
+
+func readFileInfo(path string, walk bool) (*FileInfo, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal file: %w", err)
+	}
+
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat journal file: %w", err)
+	}
+
+	info := &FileInfo{
+		Path:    path,
+		Size:    st.Size(),
+		ModTime: st.ModTime(),
+		Kind:    fileKind(path),
+		Corrupt: strings.HasSuffix(path, "~"),
+	}
+
+	h, err := readFileHeader(f)
+	if err != nil {
+		info.Corrupt = true
+		return info, nil
+	}
+
+	info.State = h.State
+	info.MachineID = h.MachineID
+	info.SeqnumID = h.SeqnumID
+	info.HeadSeqnum = h.HeadEntrySeqnum
+	info.TailSeqnum = h.TailEntrySeqnum
+	info.HeadTimestamp = usecToTime(h.HeadEntryRealtime)
+	info.TailTimestamp = usecToTime(h.TailEntryRealtime)
+	info.Entries = h.NEntries
+
+	if h.IncompatibleFlags&FileCompressedXZ != 0 {
+		info.Compression = append(info.Compression, "xz")
+	}
+	if h.IncompatibleFlags&FileCompressedLZ4 != 0 {
+		info.Compression = append(info.Compression, "lz4")
+	}
+	if h.IncompatibleFlags&FileCompressedZSTD != 0 {
+		info.Compression = append(info.Compression, "zstd")
+	}
+
+	if !walk {
+		return info, nil
+	}
+
+	info.bootEntries = map[ID128]uint64{}
+
+	err = walkObjects(f, h, func(offset uint64, typ uint8, prefix []byte) error {
+		if typ != objectEntry || len(prefix) < 56 {
+			return nil
+		}
+
+		bootID := ID128(hex.EncodeToString(prefix[40:56]))
+		if _, ok := info.bootEntries[bootID]; !ok {
+			info.BootIDs = append(info.BootIDs, bootID)
+		}
+		info.bootEntries[bootID]++
+
+		return nil
+	})
+
+	// Online files may have objects being written at the end
+	if err != nil && h.State != FileOnline {
+		info.Corrupt = true
+	}
+
+	return info, nil
+}
+
+// ListFiles returns information about all journal files in a directory
+// and in its machine ID named sub-directories, sorted by path.
+func ListFiles(dir string) ([]*FileInfo, error) {
+
+	paths, err := journalFilePaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return readFileInfos(paths, ReadFileInfo)
+}
+
+// StatFiles returns information about all journal files in a directory
+// and in its machine ID named sub-directories like ListFiles, but read
+// from the file headers only as by StatFile.
+func StatFiles(dir string) ([]*FileInfo, error) {
+
+	paths, err := journalFilePaths(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return readFileInfos(paths, StatFile)
+}
+
+// Files returns information about the journal files of the
+// journal instance
+func (j *Journal) Files() ([]*FileInfo, error) {
+
+	paths := append([]string(nil), j.files...)
+
+	for _, dir := range j.dirs {
+		p, err := journalFilePaths(dir)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p...)
+	}
+
+	return readFileInfos(paths, ReadFileInfo)
+}
+
+// UsageBreakdown returns the disk usage of the journal files of the
+// journal instance grouped by machine, boot and kind of journal.
+func (j *Journal) UsageBreakdown() (*UsageBreakdown, error) {
+
+	files, err := j.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &UsageBreakdown{
+		Machines: map[ID128]uint64{},
+		Boots:    map[ID128]uint64{},
+	}
+
+	for _, f := range files {
+		size := uint64(f.Size)
+
+		u.Total += size
+
+		switch f.Kind {
+		case FileKindSystem:
+			u.System += size
+		case FileKindUser:
+			u.User += size
+		default:
+			u.Other += size
+		}
+
+		if f.MachineID != "" {
+			u.Machines[f.MachineID] += size
+		}
+
+		var entries uint64
+		for _, n := range f.bootEntries {
+			entries += n
+		}
+
+		for boot, n := range f.bootEntries {
+			u.Boots[boot] += uint64(float64(size) * float64(n) / float64(entries))
+		}
+	}
+
+	return u, nil
+}
+
+func readFileInfos(paths []string, read func(string) (*FileInfo, error)) ([]*FileInfo, error) {
+
+	infos := make([]*FileInfo, 0, len(paths))
+
+	for _, path := range paths {
+		info, err := read(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Removed since listed, e.g. by vacuuming
+				continue
+			}
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// journalFilePaths returns the journal files in dir and in
+// its machine ID named sub-directories
+func journalFilePaths(dir string) ([]string, error) {
+
+	var paths []string
+
+	for _, pattern := range []string{"*.journal", "*.journal~", "*/*.journal", "*/*.journal~"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list journal files: %w", err)
+		}
+
+		for _, m := range matches {
+			if sub := filepath.Dir(m); sub != filepath.Clean(dir) {
+				if _, err := ParseID128(filepath.Base(sub)); err != nil {
+					continue
+				}
+			}
+			paths = append(paths, m)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func fileKind(path string) FileKind {
+
+	name := filepath.Base(path)
+
+	switch {
+	case strings.HasPrefix(name, "system.") || strings.HasPrefix(name, "system@"):
+		return FileKindSystem
+	case strings.HasPrefix(name, "user-"):
+		return FileKindUser
+	default:
+		return FileKindOther
+	}
+}
+
+// ReadFileHeader reads the header of a journal file
+func ReadFileHeader(path string) (*FileHeader, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal file: %w", err)
+	}
+
+	defer f.Close()
+
+	return readFileHeader(f)
+}
+
+// String formats the header like journalctl --header does
+func (h *FileHeader) String() string {
+
+	var b strings.Builder
+
+	timestamp := func(usec uint64) string {
+		if usec == 0 {
+			return "n/a"
+		}
+		return fmt.Sprintf("%s (%x)", usecToTime(usec).Format("Mon 2006-01-02 15:04:05 MST"), usec)
+	}
+
+	fill := func(n, size uint64) float64 {
+		if size < hashItemSize {
+			return 0
+		}
+		return 100 * float64(n) / float64(size/hashItemSize)
+	}
+
+	fmt.Fprintf(&b, "File ID: %s\n", h.FileID)
+	fmt.Fprintf(&b, "Machine ID: %s\n", h.MachineID)
+	fmt.Fprintf(&b, "Boot ID: %s\n", h.TailEntryBootID)
+	fmt.Fprintf(&b, "Sequential number ID: %s\n", h.SeqnumID)
+	fmt.Fprintf(&b, "State: %s\n", strings.ToUpper(h.State.String()))
+	fmt.Fprintf(&b, "Compatible flags: %s\n", flagNames(h.CompatibleFlags, compatibleFlagNames))
+	fmt.Fprintf(&b, "Incompatible flags: %s\n", flagNames(h.IncompatibleFlags, incompatibleFlagNames))
+	fmt.Fprintf(&b, "Header size: %d\n", h.HeaderSize)
+	fmt.Fprintf(&b, "Arena size: %d\n", h.ArenaSize)
+	fmt.Fprintf(&b, "Data hash table size: %d\n", h.DataHashTableSize/hashItemSize)
+	fmt.Fprintf(&b, "Field hash table size: %d\n", h.FieldHashTableSize/hashItemSize)
+	fmt.Fprintf(&b, "Head sequential number: %d (%x)\n", h.HeadEntrySeqnum, h.HeadEntrySeqnum)
+	fmt.Fprintf(&b, "Tail sequential number: %d (%x)\n", h.TailEntrySeqnum, h.TailEntrySeqnum)
+	fmt.Fprintf(&b, "Head realtime timestamp: %s\n", timestamp(h.HeadEntryRealtime))
+	fmt.Fprintf(&b, "Tail realtime timestamp: %s\n", timestamp(h.TailEntryRealtime))
+	fmt.Fprintf(&b, "Tail monotonic timestamp: %s (%x)\n",
+		time.Duration(h.TailEntryMonotonic)*time.Microsecond, h.TailEntryMonotonic)
+	fmt.Fprintf(&b, "Objects: %d\n", h.NObjects)
+	fmt.Fprintf(&b, "Entry objects: %d\n", h.NEntries)
+	fmt.Fprintf(&b, "Data objects: %d\n", h.NData)
+	fmt.Fprintf(&b, "Data hash table fill: %.1f%%\n", fill(h.NData, h.DataHashTableSize))
+	fmt.Fprintf(&b, "Field objects: %d\n", h.NFields)
+	fmt.Fprintf(&b, "Field hash table fill: %.1f%%\n", fill(h.NFields, h.FieldHashTableSize))
+	fmt.Fprintf(&b, "Tag objects: %d\n", h.NTags)
+	fmt.Fprintf(&b, "Entry array objects: %d\n", h.NEntryArrays)
+	fmt.Fprintf(&b, "Deepest field hash chain: %d\n", h.FieldHashChainDepth)
+	fmt.Fprintf(&b, "Deepest data hash chain: %d\n", h.DataHashChainDepth)
+
+	return b.String()
+}
+
+func flagNames(flags uint32, names []string) string {
+
+	var parts []string
+
+	for i, name := range names {
+		if flags&(1<<uint(i)) != 0 {
+			parts = append(parts, name)
+			flags &^= 1 << uint(i)
+		}
+	}
+
+	if flags != 0 {
+		parts = append(parts, fmt.Sprintf("unknown(%x)", flags))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// readFileHeader reads and validates the header of a journal file
+func readFileHeader(r io.ReaderAt) (*FileHeader, error) {
+
+	buf := make([]byte, fileHeaderMaxSize)
+
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read journal file header: %w", err)
+	}
+
+	if n < fileHeaderMinSize {
+		return nil, errors.New("journal file header truncated")
+	}
+
+	if string(buf[0:8]) != fileSignature {
+		return nil, errors.New("invalid journal file signature")
+	}
+
+	le := binary.LittleEndian
+	id := func(off int) ID128 {
+		return ID128(hex.EncodeToString(buf[off : off+16]))
+	}
+
+	h := &FileHeader{
+		CompatibleFlags:      le.Uint32(buf[8:]),
+		IncompatibleFlags:    le.Uint32(buf[12:]),
+		State:                FileState(buf[16]),
+		FileID:               id(24),
+		MachineID:            id(40),
+		TailEntryBootID:      id(56),
+		SeqnumID:             id(72),
+		HeaderSize:           le.Uint64(buf[88:]),
+		ArenaSize:            le.Uint64(buf[96:]),
+		DataHashTableOffset:  le.Uint64(buf[104:]),
+		DataHashTableSize:    le.Uint64(buf[112:]),
+		FieldHashTableOffset: le.Uint64(buf[120:]),
+		FieldHashTableSize:   le.Uint64(buf[128:]),
+		TailObjectOffset:     le.Uint64(buf[136:]),
+		NObjects:             le.Uint64(buf[144:]),
+		NEntries:             le.Uint64(buf[152:]),
+		TailEntrySeqnum:      le.Uint64(buf[160:]),
+		HeadEntrySeqnum:      le.Uint64(buf[168:]),
+		EntryArrayOffset:     le.Uint64(buf[176:]),
+		HeadEntryRealtime:    le.Uint64(buf[184:]),
+		TailEntryRealtime:    le.Uint64(buf[192:]),
+		TailEntryMonotonic:   le.Uint64(buf[200:]),
+	}
+
+	copy(h.Signature[:], buf[0:8])
+
+	if h.HeaderSize < fileHeaderMinSize {
+		return nil, fmt.Errorf("invalid journal file header size %d", h.HeaderSize)
+	}
+
+	// Fields added in later versions, only valid if covered by header size
+	has := func(end uint64) bool {
+		return h.HeaderSize >= end && uint64(n) >= end
+	}
+
+	if has(224) {
+		h.NData = le.Uint64(buf[208:])
+		h.NFields = le.Uint64(buf[216:])
+	}
+	if has(240) {
+		h.NTags = le.Uint64(buf[224:])
+		h.NEntryArrays = le.Uint64(buf[232:])
+	}
+	if has(256) {
+		h.DataHashChainDepth = le.Uint64(buf[240:])
+		h.FieldHashChainDepth = le.Uint64(buf[248:])
+	}
+	if has(264) {
+		h.TailEntryArrayOffset = le.Uint32(buf[256:])
+		h.TailEntryArrayNEntries = le.Uint32(buf[260:])
+	}
+	if has(272) {
+		h.TailEntryOffset = le.Uint64(buf[264:])
+	}
+
+	return h, nil
+}
+
+// Number of leading bytes of each object passed to walkObjects visitors,
+// enough to hold the fixed size part of every object type
+const objectPrefixSize = 64
+
+// walkObjects calls fn for every object of a journal file in file order
+// with its offset, type and up to objectPrefixSize leading bytes,
+// object header included.
+func walkObjects(r io.ReaderAt, h *FileHeader, fn func(offset uint64, typ uint8, prefix []byte) error) error {
+
+	if h.TailObjectOffset == 0 {
+		// No objects
+		return nil
+	}
+
+	end := h.HeaderSize + h.ArenaSize
+
+	br := bufio.NewReaderSize(io.NewSectionReader(r, int64(h.HeaderSize), int64(h.ArenaSize)), 1<<16)
+	prefix := make([]byte, objectPrefixSize)
+	offset := h.HeaderSize
+
+	for offset <= h.TailObjectOffset {
+		if _, err := io.ReadFull(br, prefix[:objectHeaderSize]); err != nil {
+			return fmt.Errorf("failed to read object at offset %d: %w", offset, err)
+		}
+
+		typ := prefix[0]
+		size := binary.LittleEndian.Uint64(prefix[8:])
+
+		if size < objectHeaderSize || offset+size > end {
+			return fmt.Errorf("invalid size %d of object at offset %d", size, offset)
+		}
+
+		n := size
+		if n > objectPrefixSize {
+			n = objectPrefixSize
+		}
+
+		if _, err := io.ReadFull(br, prefix[objectHeaderSize:n]); err != nil {
+			return fmt.Errorf("failed to read object at offset %d: %w", offset, err)
+		}
+
+		if err := fn(offset, typ, prefix[:n]); err != nil {
+			return err
+		}
+
+		// Objects are 8 byte aligned
+		next := offset + (size+7)&^7
+
+		if _, err := br.Discard(int(next - offset - n)); err != nil {
+			if err == io.EOF && offset == h.TailObjectOffset {
+				break
+			}
+			return fmt.Errorf("failed to skip object at offset %d: %w", offset, err)
+		}
+
+		offset = next
+	}
+
+	return nil
+}
+
+func usecToTime(usec uint64) time.Time {
+	if usec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(usec)*int64(time.Microsecond))
+}
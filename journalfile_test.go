@@ -0,0 +1,42 @@
+// +build linux
+
+package journal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatFile(t *testing.T) {
+
+	path, remove := fixture(t, "entries.journal")
+	defer remove()
+
+	full, err := ReadFileInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := StatFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(full.BootIDs) != 1 || full.Corrupt {
+		t.Fatalf("expected one boot in uncorrupted file, got %v", full.BootIDs)
+	}
+	if info.BootIDs != nil {
+		t.Errorf("expected no boots read from header, got %v", info.BootIDs)
+	}
+
+	// Everything else is read from the header
+	full.BootIDs, full.bootEntries = nil, nil
+
+	if !reflect.DeepEqual(info, full) {
+		t.Errorf("expected %+v, got %+v", full, info)
+	}
+
+	if info.State != FileOffline || info.Entries != 7 || info.HeadSeqnum != 1 || info.TailSeqnum != 7 {
+		t.Errorf("unexpected header information %+v", info)
+	}
+}
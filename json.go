@@ -0,0 +1,195 @@
+// +build linux
+
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// JSONContentType is the MIME type of entries encoded by JSONEncoder
+const JSONContentType = "application/json"
+
+// JSONEncoder writes entries as JSON objects, one per line, as produced by
+// journalctl -o json. All values are strings except for values that are
+// not printable text, which are written as arrays of byte values.
+type JSONEncoder struct {
+	w *bufio.Writer
+}
+
+// NewJSONEncoder creates a JSONEncoder writing to w
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	return &JSONEncoder{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Encode writes an entry. The cursor, timestamps and boot ID of the entry
+// are written first, followed by its fields in name order.
+func (enc *JSONEncoder) Encode(e *Entry) error {
+
+	first := true
+
+	write := func(name, value string) {
+		if !first {
+			enc.w.WriteString(", ")
+		}
+		first = false
+
+		writeJSONString(enc.w, name)
+		enc.w.WriteString(" : ")
+
+		if exportPrintable(value) {
+			writeJSONString(enc.w, value)
+			return
+		}
+
+		enc.w.WriteByte('[')
+		for i := 0; i < len(value); i++ {
+			if i > 0 {
+				enc.w.WriteString(", ")
+			}
+			enc.w.WriteString(strconv.Itoa(int(value[i])))
+		}
+		enc.w.WriteByte(']')
+	}
+
+	enc.w.WriteString("{ ")
+
+	eachExportField(e, write)
+
+	enc.w.WriteString(" }\n")
+
+	if err := enc.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write entry: %w", err)
+	}
+
+	return nil
+}
+
+// writeJSONString writes s as a JSON string. s must be valid UTF-8.
+func writeJSONString(w *bufio.Writer, s string) {
+
+	const hex = "0123456789abcdef"
+
+	w.WriteByte('"')
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case c == '\n':
+			w.WriteString(`\n`)
+		case c == '\t':
+			w.WriteString(`\t`)
+		case c < ' ' || c == 0x7f:
+			w.WriteString(`\u00`)
+			w.WriteByte(hex[c>>4])
+			w.WriteByte(hex[c&0xf])
+		default:
+			w.WriteByte(c)
+		}
+	}
+
+	w.WriteByte('"')
+}
+
+// JSONDecoder reads entries written as JSON objects, as produced by
+// journalctl -o json and JSONEncoder
+type JSONDecoder struct {
+	dec *json.Decoder
+}
+
+// NewJSONDecoder creates a JSONDecoder reading from r
+func NewJSONDecoder(r io.Reader) *JSONDecoder {
+	return &JSONDecoder{
+		dec: json.NewDecoder(r),
+	}
+}
+
+// Decode reads the next entry. io.EOF is returned when there are no more
+// entries. Values given as arrays of byte values are decoded as binary.
+// Of fields with several values, only the first value is kept. Fields
+// with the value null, i.e. too large to be included, are left out.
+func (dec *JSONDecoder) Decode() (*Entry, error) {
+
+	var m map[string]json.RawMessage
+
+	if err := dec.dec.Decode(&m); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to decode entry: %w", err)
+	}
+
+	e := &Entry{
+		Fields: make(Fields, len(m)),
+	}
+
+	for name, raw := range m {
+		value, ok, err := decodeJSONValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode field %s: %w", name, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := e.setField(name, value); err != nil {
+			return nil, fmt.Errorf("failed to decode entry: %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+// decodeJSONValue decodes a string, an array of byte values or an array
+// of such values, in which case the first is returned. false is returned
+// for null.
+func decodeJSONValue(raw json.RawMessage) (string, bool, error) {
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", false, err
+	}
+
+	switch t := v.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return t, true, nil
+	case []interface{}:
+		if len(t) == 0 {
+			return "", true, nil
+		}
+
+		// Several values, keep the first
+		switch t[0].(type) {
+		case string, []interface{}:
+			first, err := json.Marshal(t[0])
+			if err != nil {
+				return "", false, err
+			}
+			return decodeJSONValue(first)
+		}
+
+		b := make([]byte, len(t))
+		for i, n := range t {
+			f, ok := n.(float64)
+			if !ok || f < 0 || f > 255 {
+				return "", false, fmt.Errorf("invalid byte value %v", n)
+			}
+			b[i] = byte(f)
+		}
+
+		return string(b), true, nil
+	default:
+		return "", false, fmt.Errorf("unexpected value %s", raw)
+	}
+}
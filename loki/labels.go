@@ -0,0 +1,167 @@
+// +build linux
+
+package loki
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// OverflowValue replaces label values beyond the maximum number of
+// values of a label
+const OverflowValue = "_overflow_"
+
+// DefaultLabels maps stream labels to the journal fields they're set from
+var DefaultLabels = map[string]string{
+	"unit":       journal.FieldUnit,
+	"host":       journal.FieldHostname,
+	"level":      journal.FieldPriority,
+	"identifier": journal.FieldSyslogIdentifier,
+}
+
+// labeler sets stream labels from journal fields, guarding against
+// labels with unbounded numbers of values
+type labeler struct {
+	static    map[string]string
+	labels    map[string]string
+	names     []string
+	maxValues int
+	maxLen    int
+
+	mutex sync.Mutex
+	// Values seen per label
+	seen map[string]map[string]struct{}
+}
+
+func newLabeler(static, labels map[string]string, maxValues, maxLen int) (*labeler, error) {
+
+	names := make([]string, 0, len(labels))
+
+	for name := range labels {
+		if !validLabelName(name) {
+			return nil, fmt.Errorf("invalid label name '%s'", name)
+		}
+		if _, ok := static[name]; ok {
+			return nil, fmt.Errorf("label '%s' is both static and set from a field", name)
+		}
+		names = append(names, name)
+	}
+
+	for name := range static {
+		if !validLabelName(name) {
+			return nil, fmt.Errorf("invalid label name '%s'", name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return &labeler{
+		static:    static,
+		labels:    labels,
+		names:     names,
+		maxValues: maxValues,
+		maxLen:    maxLen,
+		seen:      map[string]map[string]struct{}{},
+	}, nil
+}
+
+// Labels returns the stream labels of an entry along with the fields
+// used for labels. Fields with values beyond the maximum number of
+// values of a label aren't used, and the label is set to OverflowValue.
+func (l *labeler) Labels(e *journal.Entry) (map[string]string, map[string]bool) {
+
+	labels := make(map[string]string, len(l.static)+len(l.names))
+	used := map[string]bool{}
+
+	for k, v := range l.static {
+		labels[k] = v
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, name := range l.names {
+		field := l.labels[name]
+
+		v, ok := e.Fields[field]
+		if !ok || v == "" {
+			continue
+		}
+
+		if field == journal.FieldPriority {
+			if p, err := journal.ParsePriority(v); err == nil {
+				text, _ := p.MarshalText()
+				v = string(text)
+			}
+		}
+
+		if len(v) > l.maxLen {
+			labels[name] = OverflowValue
+			continue
+		}
+
+		seen, ok := l.seen[name]
+		if !ok {
+			seen = map[string]struct{}{}
+			l.seen[name] = seen
+		}
+
+		if _, ok := seen[v]; !ok {
+			if len(seen) >= l.maxValues {
+				labels[name] = OverflowValue
+				continue
+			}
+			seen[v] = struct{}{}
+		}
+
+		labels[name] = v
+		used[field] = true
+	}
+
+	return labels, used
+}
+
+// streamKey returns a key identifying the stream of a set of labels
+func streamKey(labels map[string]string) string {
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		b.WriteString(labels[name])
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
+
+// validLabelName returns true if name is a valid Prometheus label name
+func validLabelName(name string) bool {
+
+	if name == "" || strings.HasPrefix(name, "__") {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
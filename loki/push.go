@@ -0,0 +1,311 @@
+// +build linux
+
+// Package loki pushes journal entries to Grafana Loki.
+package loki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/retry"
+)
+
+// LineFormat is how entries are written as log lines
+type LineFormat int
+
+// LineFormat constants
+const (
+	// LineJSON writes the fields not used for labels as a JSON object
+	LineJSON LineFormat = iota
+	// LineMessage writes MESSAGE as the line and the other fields not
+	// used for labels as structured metadata, which requires Loki 3 or
+	// later
+	LineMessage
+)
+
+// PusherConfig configures a Pusher
+type PusherConfig struct {
+	// URL of Loki, e.g. "http://loki:3100". Entries are pushed to
+	// /loki/api/v1/push unless the URL has another path.
+	URL string
+	// TenantID is sent as X-Scope-OrgID if set
+	TenantID string
+	// Username and Password are used for basic authentication if set
+	Username string
+	Password string
+	// Headers are added to every request
+	Headers map[string]string
+	// Labels maps stream labels to the journal fields they're set from.
+	// PRIORITY is set by name, e.g. "err". Defaults to DefaultLabels.
+	Labels map[string]string
+	// StaticLabels are set on all streams, e.g. job
+	StaticLabels map[string]string
+	// MaxLabelValues is the maximum number of values of a label. Further
+	// values are replaced by OverflowValue and kept in the line.
+	// Defaults to 100.
+	MaxLabelValues int
+	// MaxLabelValueLength is the maximum length of a label value. Longer
+	// values are replaced by OverflowValue. Defaults to 128.
+	MaxLabelValueLength int
+	// LineFormat is how entries are written. Defaults to LineJSON.
+	LineFormat LineFormat
+	// Gzip compresses requests
+	Gzip bool
+	// Client is used for requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// StateFile is where the cursor of the last pushed entry is saved.
+	// Pushing resumes after the saved cursor.
+	StateFile string
+	// BatchSize is the maximum number of entries per request.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back while
+	// following. Defaults to 1s.
+	FlushInterval time.Duration
+	// Retries is the number of times a failed request is retried.
+	// Defaults to 4. A negative value retries until the request succeeds.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for
+	// every following retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+	// OnError is called with errors while following
+	OnError func(err error)
+}
+
+// Pusher pushes journal entries to Loki, with stream labels set from
+// journal fields
+type Pusher struct {
+	cfg     PusherConfig
+	url     string
+	labeler *labeler
+	backoff retry.Backoff
+}
+
+// The following types are the JSON encoding of a push request
+
+type pushRequest struct {
+	Streams []*stream `json:"streams"`
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are the timestamp in nanoseconds, the line and optionally
+	// structured metadata
+	Values [][]interface{} `json:"values"`
+}
+
+// NewPusher creates a Pusher
+func NewPusher(cfg PusherConfig) (*Pusher, error) {
+
+	if cfg.URL == "" {
+		return nil, errors.New("a Loki URL must be provided")
+	}
+	if cfg.Labels == nil {
+		cfg.Labels = DefaultLabels
+	}
+	if cfg.MaxLabelValues <= 0 {
+		cfg.MaxLabelValues = 100
+	}
+	if cfg.MaxLabelValueLength <= 0 {
+		cfg.MaxLabelValueLength = 128
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	l, err := newLabeler(cfg.StaticLabels, cfg.Labels, cfg.MaxLabelValues, cfg.MaxLabelValueLength)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(cfg.URL, "/")
+	if i := strings.Index(url, "://"); i < 0 || !strings.Contains(url[i+3:], "/") {
+		url += "/loki/api/v1/push"
+	}
+
+	return &Pusher{
+		cfg:     cfg,
+		url:     url,
+		labeler: l,
+		backoff: retry.WithRetries(cfg.Retries, cfg.RetryBackoff),
+	}, nil
+}
+
+// Export pushes entries in a single request, grouped by stream, retrying
+// on failure. Server errors and rate limiting are retried, other client
+// errors are not.
+func (p *Pusher) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	body, err := p.encode(entries)
+	if err != nil {
+		return err
+	}
+
+	return p.backoff.Do(ctx, func() error {
+		return p.push(ctx, body)
+	})
+}
+
+// PushJournal pushes the entries of j from its current position, or
+// after the cursor in the state file, until there are no more entries.
+func (p *Pusher) PushJournal(ctx context.Context, j journal.Reader) error {
+	return batch.Read(ctx, j, p.batchConfig(), p.Export)
+}
+
+// Follow follows j from its current position, or after the cursor in
+// the state file, and pushes entries as they are written. Errors are
+// passed to OnError. Following stops if entries fail to be pushed.
+func (p *Pusher) Follow(j journal.Follower) (journal.FollowStop, error) {
+	return batch.Follow(j, p.batchConfig(), p.Export)
+}
+
+func (p *Pusher) batchConfig() batch.Config {
+	return batch.Config{
+		Size:      p.cfg.BatchSize,
+		Interval:  p.cfg.FlushInterval,
+		StateFile: p.cfg.StateFile,
+		OnError:   p.cfg.OnError,
+	}
+}
+
+// encode encodes the push request of entries
+func (p *Pusher) encode(entries []*journal.Entry) ([]byte, error) {
+
+	req := pushRequest{}
+	streams := map[string]*stream{}
+
+	for _, e := range entries {
+		labels, used := p.labeler.Labels(e)
+
+		key := streamKey(labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &stream{Stream: labels}
+			streams[key] = s
+			req.Streams = append(req.Streams, s)
+		}
+
+		value, err := p.value(e, used)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Values = append(s.Values, value)
+	}
+
+	var buf bytes.Buffer
+
+	w := io.Writer(&buf)
+
+	var zw *gzip.Writer
+	if p.cfg.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to encode entries: %w", err)
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress entries: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// value returns the timestamp, line and structured metadata of an entry,
+// leaving out fields used for labels
+func (p *Pusher) value(e *journal.Entry, used map[string]bool) ([]interface{}, error) {
+
+	fields := make(map[string]string, len(e.Fields))
+
+	for name, v := range e.Fields {
+		if !used[name] && !strings.HasPrefix(name, "__") {
+			fields[name] = v
+		}
+	}
+
+	ts := strconv.FormatInt(e.Timestamp.UnixNano(), 10)
+
+	if p.cfg.LineFormat == LineMessage {
+		line := fields[journal.FieldMessage]
+		delete(fields, journal.FieldMessage)
+
+		if len(fields) == 0 {
+			return []interface{}{ts, line}, nil
+		}
+
+		return []interface{}{ts, line, fields}, nil
+	}
+
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	return []interface{}{ts, string(line)}, nil
+}
+
+// push sends a push request
+func (p *Pusher) push(ctx context.Context, body []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("failed to create push request: %w", err))
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if p.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.cfg.TenantID)
+	}
+	if p.cfg.Username != "" || p.cfg.Password != "" {
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push entries: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("failed to push entries: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+
+	return retry.Permanent(err)
+}
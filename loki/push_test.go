@@ -0,0 +1,341 @@
+// +build linux
+
+package loki
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// lokiServer replies to push requests with the given statuses in turn,
+// accepting requests once all have been used, and records the streams of
+// the accepted requests as "{labels} line [metadata]"
+type lokiServer struct {
+	*httptest.Server
+	statuses []int
+	requests int
+	streams  []string
+	header   http.Header
+	path     string
+	mutex    sync.Mutex
+}
+
+func newLokiServer(t *testing.T, statuses ...int) *lokiServer {
+
+	s := &lokiServer{statuses: statuses}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.header = r.Header
+		s.path = r.URL.Path
+
+		status := http.StatusNoContent
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+
+		if status != http.StatusNoContent {
+			http.Error(w, "rejected", status)
+			return
+		}
+
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("failed to decompress request: %v", err)
+				return
+			}
+			body = zr
+		}
+
+		var req struct {
+			Streams []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][]interface{}   `json:"values"`
+			} `json:"streams"`
+		}
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		for _, st := range req.Streams {
+			labels := make([]string, 0, len(st.Stream))
+			for k, v := range st.Stream {
+				labels = append(labels, k+"="+v)
+			}
+			sort.Strings(labels)
+
+			for _, v := range st.Values {
+				s.streams = append(s.streams, fmt.Sprintf("{%s} %v", strings.Join(labels, ","), v[1:]))
+			}
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	return s
+}
+
+func (s *lokiServer) result() (int, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests, strings.Join(s.streams, "; ")
+}
+
+func TestPusherExport(t *testing.T) {
+
+	entries := []*journal.Entry{
+		{Fields: journal.Fields{
+			journal.FieldMessage:  "first",
+			journal.FieldPriority: "3",
+			journal.FieldUnit:     "a.service",
+			journal.FieldPID:      "1",
+		}},
+		{Fields: journal.Fields{
+			journal.FieldMessage: "second",
+			journal.FieldUnit:    "b.service",
+		}},
+		{Fields: journal.Fields{
+			journal.FieldMessage: "third",
+			journal.FieldUnit:    "c.service",
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		cfg      PusherConfig
+		statuses []int
+		requests int
+		want     string
+		err      bool
+	}{
+		{
+			name:     "json",
+			cfg:      PusherConfig{Labels: map[string]string{"unit": journal.FieldUnit, "level": journal.FieldPriority}},
+			requests: 1,
+			want: `{level=err,unit=a.service} [{"MESSAGE":"first","_PID":"1"}]; ` +
+				`{unit=b.service} [{"MESSAGE":"second"}]; ` +
+				`{unit=c.service} [{"MESSAGE":"third"}]`,
+		},
+		{
+			name: "message",
+			cfg: PusherConfig{
+				Labels:       map[string]string{"unit": journal.FieldUnit},
+				StaticLabels: map[string]string{"job": "journal"},
+				LineFormat:   LineMessage,
+				Gzip:         true,
+			},
+			requests: 1,
+			want: `{job=journal,unit=a.service} [first map[PRIORITY:3 _PID:1]]; ` +
+				`{job=journal,unit=b.service} [second]; ` +
+				`{job=journal,unit=c.service} [third]`,
+		},
+		{
+			name: "overflow",
+			cfg: PusherConfig{
+				Labels:         map[string]string{"unit": journal.FieldUnit},
+				LineFormat:     LineMessage,
+				MaxLabelValues: 2,
+			},
+			requests: 1,
+			want: `{unit=a.service} [first map[PRIORITY:3 _PID:1]]; ` +
+				`{unit=b.service} [second]; ` +
+				`{unit=_overflow_} [third map[_SYSTEMD_UNIT:c.service]]`,
+		},
+		{
+			name:     "retried",
+			cfg:      PusherConfig{Labels: map[string]string{}, LineFormat: LineMessage},
+			statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			requests: 3,
+			want:     "{} [first map[PRIORITY:3 _PID:1 _SYSTEMD_UNIT:a.service]]; {} [second map[_SYSTEMD_UNIT:b.service]]; {} [third map[_SYSTEMD_UNIT:c.service]]",
+		},
+		{
+			name:     "bad request",
+			cfg:      PusherConfig{},
+			statuses: []int{http.StatusBadRequest},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name:     "retries used up",
+			cfg:      PusherConfig{},
+			statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			requests: 3,
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newLokiServer(t, test.statuses...)
+			defer s.Close()
+
+			cfg := test.cfg
+			cfg.URL = s.URL
+			cfg.TenantID = "tenant"
+			cfg.Username = "user"
+			cfg.Password = "secret"
+			cfg.Retries = 2
+			cfg.RetryBackoff = time.Millisecond
+
+			p, err := NewPusher(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = p.Export(context.Background(), entries)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			requests, got := s.result()
+			if requests != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, requests)
+			}
+			if got != test.want {
+				t.Errorf("expected streams\n%s\ngot\n%s", test.want, got)
+			}
+			if s.path != "/loki/api/v1/push" {
+				t.Errorf("expected path /loki/api/v1/push, got %s", s.path)
+			}
+			if h := s.header.Get("X-Scope-OrgID"); h != "tenant" {
+				t.Errorf("expected X-Scope-OrgID tenant, got %q", h)
+			}
+			if user, pass, _ := (&http.Request{Header: s.header}).BasicAuth(); user != "user" || pass != "secret" {
+				t.Errorf("expected basic authentication, got %q %q", user, pass)
+			}
+		})
+	}
+}
+
+func TestPusherPushJournal(t *testing.T) {
+
+	s := newLokiServer(t)
+	defer s.Close()
+
+	p, err := NewPusher(PusherConfig{
+		URL:        s.URL + "/custom/push",
+		Labels:     map[string]string{},
+		LineFormat: LineMessage,
+		BatchSize:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make([]*journal.Entry, 5)
+	for i := range entries {
+		entries[i] = &journal.Entry{
+			Fields: journal.Fields{journal.FieldMessage: fmt.Sprintf("%d", i+1)},
+		}
+	}
+
+	if err := p.PushJournal(context.Background(), &journaltest.SliceReader{Entries: entries}); err != nil {
+		t.Fatal(err)
+	}
+
+	requests, got := s.result()
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if want := "{} [1]; {} [2]; {} [3]; {} [4]; {} [5]"; got != want {
+		t.Errorf("expected streams %s, got %s", want, got)
+	}
+	if s.path != "/custom/push" {
+		t.Errorf("expected path /custom/push, got %s", s.path)
+	}
+}
+
+func TestNewPusherLabels(t *testing.T) {
+
+	tests := []struct {
+		labels map[string]string
+		static map[string]string
+	}{
+		{labels: map[string]string{"1unit": journal.FieldUnit}},
+		{labels: map[string]string{"unit": journal.FieldUnit}, static: map[string]string{"unit": "x"}},
+		{static: map[string]string{"job-name": "x"}},
+	}
+
+	for _, test := range tests {
+		_, err := NewPusher(PusherConfig{URL: "http://loki", Labels: test.labels, StaticLabels: test.static})
+		if err == nil {
+			t.Errorf("labels %v and static labels %v: expected error", test.labels, test.static)
+		}
+	}
+}
+
+func BenchmarkPusherExport(b *testing.B) {
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	p, err := NewPusher(PusherConfig{URL: s.URL, Gzip: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	entries := make([]*journal.Entry, 100)
+	for i := range entries {
+		entries[i] = &journal.Entry{
+			Fields: journal.Fields{
+				journal.FieldMessage:  fmt.Sprintf("message %d", i),
+				journal.FieldPriority: "6",
+				journal.FieldUnit:     fmt.Sprintf("app%d.service", i%5),
+			},
+			Timestamp: time.Now(),
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := p.Export(context.Background(), entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLabels(b *testing.B) {
+
+	l, err := newLabeler(nil, DefaultLabels, 100, 128)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	e := &journal.Entry{Fields: journal.Fields{
+		journal.FieldMessage:          "message",
+		journal.FieldPriority:         "6",
+		journal.FieldUnit:             "app.service",
+		journal.FieldHostname:         "host",
+		journal.FieldSyslogIdentifier: "app",
+	}}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		l.Labels(e)
+	}
+}
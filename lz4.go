@@ -0,0 +1,104 @@
+// +build linux
+
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errLZ4Corrupt = errors.New("corrupt LZ4 data")
+
+// decompressLZ4 decompresses the payload of a data object compressed
+// using LZ4 by journald, i.e. the uncompressed size as a little-endian
+// 64-bit integer followed by a single LZ4 block.
+func decompressLZ4(src []byte) ([]byte, error) {
+
+	if len(src) < 8 {
+		return nil, errLZ4Corrupt
+	}
+
+	size := binary.LittleEndian.Uint64(src)
+	src = src[8:]
+
+	// A byte of input expands to at most 255 bytes of output
+	if size > uint64(len(src))*255 {
+		return nil, fmt.Errorf("invalid LZ4 uncompressed size %d", size)
+	}
+
+	dst := make([]byte, 0, size)
+
+	for i := 0; ; {
+		if i >= len(src) {
+			return nil, errLZ4Corrupt
+		}
+
+		token := src[i]
+		i++
+
+		n, ok := lz4Length(src, &i, int(token>>4))
+		if !ok || n > len(src)-i || n > cap(dst)-len(dst) {
+			return nil, errLZ4Corrupt
+		}
+
+		dst = append(dst, src[i:i+n]...)
+		i += n
+
+		// The last sequence has literals only
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4Corrupt
+		}
+
+		n, ok = lz4Length(src, &i, int(token&0xf))
+		if n += 4; !ok || n > cap(dst)-len(dst) {
+			return nil, errLZ4Corrupt
+		}
+
+		// The match may overlap the bytes it appends
+		start := len(dst) - offset
+		for j := 0; j < n; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+
+	if uint64(len(dst)) != size {
+		return nil, fmt.Errorf("LZ4 data of size %d, expected %d", len(dst), size)
+	}
+
+	return dst, nil
+}
+
+// lz4Length reads the extra bytes of a literal or match length starting
+// at *i when n is 15
+func lz4Length(src []byte, i *int, n int) (int, bool) {
+
+	if n != 15 {
+		return n, true
+	}
+
+	for {
+		if *i >= len(src) {
+			return 0, false
+		}
+
+		b := src[*i]
+		*i++
+
+		n += int(b)
+		if b != 255 {
+			return n, true
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// +build linux
+
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// lz4Block prefixes an LZ4 block with the uncompressed size like journald
+func lz4Block(size int, block ...byte) []byte {
+	b := make([]byte, 8, 8+len(block))
+	binary.LittleEndian.PutUint64(b, uint64(size))
+	return append(b, block...)
+}
+
+// lz4Literals returns an LZ4 block holding b as literals only
+func lz4Literals(b []byte) []byte {
+
+	block := []byte{0}
+
+	if n := len(b); n < 15 {
+		block[0] = byte(n << 4)
+	} else {
+		block[0] = 0xf0
+		for n -= 15; n >= 255; n -= 255 {
+			block = append(block, 255)
+		}
+		block = append(block, byte(n))
+	}
+
+	return lz4Block(len(b), append(block, b...)...)
+}
+
+func TestDecompressLZ4(t *testing.T) {
+
+	long := bytes.Repeat([]byte("0123456789"), 60)
+
+	tests := []struct {
+		name     string
+		src      []byte
+		expected []byte
+	}{
+		{"literals", lz4Literals([]byte("MESSAGE=hello")), []byte("MESSAGE=hello")},
+		{"long literals", lz4Literals(long), long},
+		{"empty", lz4Block(0, 0x00), []byte{}},
+		// "MESSAGE=" followed by 16 'a' as a literal and an overlapping
+		// match of offset 1, then 5 literals
+		{"overlapping match", lz4Block(29, 0x9b, 'M', 'E', 'S', 'S', 'A', 'G', 'E', '=', 'a', 0x01, 0x00, 0x50, 'a', 'b', 'c', 'd', 'e'),
+			[]byte("MESSAGE=aaaaaaaaaaaaaaaaabcde")},
+		// A match length of 15+4+1 copying "ab"
+		{"long match", lz4Block(22, 0x2f, 'a', 'b', 0x02, 0x00, 0x01, 0x00),
+			bytes.Repeat([]byte("ab"), 11)},
+		{"short", []byte{1, 2, 3}, nil},
+		{"truncated literals", lz4Block(5, 0x50, 'a', 'b'), nil},
+		{"truncated offset", lz4Block(8, 0x10, 'a', 0x01), nil},
+		{"zero offset", lz4Block(8, 0x10, 'a', 0x00, 0x00, 0x00), nil},
+		{"offset before start", lz4Block(8, 0x10, 'a', 0x02, 0x00, 0x00), nil},
+		{"too long", lz4Block(2, 0x30, 'a', 'b', 'c'), nil},
+		{"too short", lz4Block(4, 0x30, 'a', 'b', 'c'), nil},
+		{"size too large", lz4Block(1<<40, 0x30, 'a', 'b', 'c'), nil},
+		{"truncated length", lz4Block(300, 0xf0, 0xff), nil},
+	}
+
+	for _, test := range tests {
+		b, err := decompressLZ4(test.src)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected error, got %q", test.name, b)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !bytes.Equal(b, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, b)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package journal
 
+import "errors"
+
 // Match describes a set of matches to be applied
 // to a journal instance
 type Match struct {
@@ -50,3 +52,23 @@ func (m *Match) Or() *Match {
 func NewMatch() *Match {
 	return &Match{}
 }
+
+// Fields returns the values matched for each field. Values of the same
+// field match in an OR-like fashion and different fields must all match.
+// An error is returned for expressions using Or, which cannot be
+// represented this way.
+func (m *Match) Fields() (map[string][]string, error) {
+
+	fields := map[string][]string{}
+
+	for _, expr := range m.expr {
+		switch expr.op {
+		case matchOpField:
+			fields[expr.field] = append(fields[expr.field], expr.values...)
+		case matchOpOr:
+			return nil, errors.New("match expression with disjunction not supported")
+		}
+	}
+
+	return fields, nil
+}
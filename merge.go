@@ -0,0 +1,413 @@
+// +build linux
+
+package journal
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Default time entries are held back while following a MergeReader
+const defaultReorderWindow = time.Second
+
+// Reader is implemented by sources that entries can be read from one
+// at a time, such as Journal.
+type Reader interface {
+	// Next moves to the next entry and returns 0 if there are none
+	Next() (int, error)
+	// ReadEntry reads the entry at the current position
+	ReadEntry() (*Entry, error)
+}
+
+// Follower is implemented by sources that can be followed, such as Journal.
+// Once the returned FollowStop is called, the handler must be called with
+// ErrFollowStopped, unless following already ended with another error.
+type Follower interface {
+	Follow(h FollowHandler) (FollowStop, error)
+}
+
+// MergeReader interleaves the entries of several readers, for instance
+// one journal instance per machine or namespace. Entries are returned in
+// realtime timestamp order. Entries with the same timestamp are ordered by
+// sequence number and then by the order the readers were provided.
+// Sources may be journal instances or FileReaders.
+// NOTE: Each reader must only be used through the MergeReader once added.
+type MergeReader struct {
+	sources []Reader
+	window  time.Duration
+	// Next entry of each source, read but not yet returned
+	heads []*Entry
+	// Cursor of the last entry returned from each source
+	last    []Cursor
+	current *Entry
+	mutex   sync.Mutex
+}
+
+// NewMergeReader creates a MergeReader reading from the provided sources
+func NewMergeReader(sources ...Reader) *MergeReader {
+	return &MergeReader{
+		sources: sources,
+		window:  defaultReorderWindow,
+		heads:   make([]*Entry, len(sources)),
+		last:    make([]Cursor, len(sources)),
+	}
+}
+
+// SetReorderWindow sets the time entries are held back while following,
+// to pass the entries of different sources to the handler in timestamp
+// order. Defaults to one second. A window of 0 passes entries on in the
+// order they arrive.
+func (m *MergeReader) SetReorderWindow(window time.Duration) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if window < 0 {
+		window = 0
+	}
+
+	m.window = window
+}
+
+// AddMatch adds a match expression to every source supporting matches.
+// Matches must be added before reading any entries.
+func (m *MergeReader) AddMatch(match *Match) error {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, src := range m.sources {
+		if s, ok := src.(interface{ AddMatch(*Match) error }); ok {
+			if err := s.AddMatch(match); err != nil {
+				return fmt.Errorf("failed to add match to source %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// FlushMatches removes all matches from every source supporting matches
+func (m *MergeReader) FlushMatches() {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, src := range m.sources {
+		if s, ok := src.(interface{ FlushMatches() }); ok {
+			s.FlushMatches()
+		}
+	}
+}
+
+// Next moves to the next entry across all sources. Sources that have
+// run out of entries are tried again on every call, so new entries
+// appended to them are picked up. Next returns 0 if no source has
+// any more entries.
+func (m *MergeReader) Next() (int, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.current = nil
+
+	if err := m.fill(); err != nil {
+		return 0, err
+	}
+
+	next := -1
+	for i, e := range m.heads {
+		if e == nil {
+			continue
+		}
+		if next < 0 || mergeBefore(e, m.heads[next]) {
+			next = i
+		}
+	}
+
+	if next < 0 {
+		return 0, nil
+	}
+
+	m.current = m.heads[next]
+	m.last[next] = m.current.Cursor
+	m.heads[next] = nil
+
+	return 1, nil
+}
+
+// ReadEntry returns the entry at the current position
+func (m *MergeReader) ReadEntry() (*Entry, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.current == nil {
+		return nil, fmt.Errorf("failed to read entry: %w", syscall.EADDRNOTAVAIL)
+	}
+
+	return m.current, nil
+}
+
+// Follow follows every source implementing Follower from its current
+// position and calls h for each entry, one at a time. Entries are held
+// back for the reorder window after arriving and passed to h in realtime
+// timestamp order, so entries of different sources arriving within the
+// window are interleaved like by Next. Entries arriving later than that
+// are passed on as they arrive. Entries read by Next but not yet returned
+// are included. An error from any source stops all of them. When stopped,
+// the entries held back are passed to h before ErrFollowStopped. Every
+// source must implement Follower, so a MergeReader of FileReaders cannot
+// be followed.
+func (m *MergeReader) Follow(h FollowHandler) (FollowStop, error) {
+
+	if h == nil {
+		return nil, errors.New("a follow handler must be provided")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.sources) == 0 {
+		return nil, errors.New("no source to follow")
+	}
+
+	for i, src := range m.sources {
+		if _, ok := src.(Follower); !ok {
+			return nil, fmt.Errorf("source %d of type %T cannot be followed", i, src)
+		}
+	}
+
+	var (
+		entries = make(chan *Entry)
+		errs    = make(chan error, 1)
+		done    = make(chan struct{})
+		once    sync.Once
+		stops   []FollowStop
+	)
+
+	stop := func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+
+	for i, src := range m.sources {
+		f := src.(Follower)
+
+		// A source without a buffered entry is positioned at the entry
+		// last returned, which Follow would deliver again.
+		skip := Cursor{}
+		if m.heads[i] == nil {
+			skip = m.last[i]
+		}
+
+		s, err := f.Follow(func(entry *Entry, err error) {
+			if err != nil {
+				// Stopping is reported once all sources are stopped
+				if !errors.Is(err, ErrFollowStopped) {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+				return
+			}
+
+			if !skip.IsZero() {
+				c := skip
+				skip = Cursor{}
+				if entry.Cursor == c {
+					return
+				}
+			}
+
+			select {
+			case entries <- entry:
+			case <-done:
+			}
+		})
+
+		if err != nil {
+			for _, s := range stops {
+				s()
+			}
+			return nil, fmt.Errorf("failed to follow source %d: %w", i, err)
+		}
+
+		stops = append(stops, s)
+	}
+
+	go mergeFollow(h, m.window, entries, errs, done, stops)
+
+	return stop, nil
+}
+
+// mergeFollow passes the entries of the followed sources to h in
+// timestamp order, holding each back for window after arriving, until
+// done is closed or a source fails
+func mergeFollow(h FollowHandler, window time.Duration, entries <-chan *Entry,
+	errs <-chan error, done <-chan struct{}, stops []FollowStop) {
+
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}()
+
+	var queue mergeQueue
+
+	// Passes on the entries held back for at least window, or all of them
+	release := func(all bool) {
+		now := time.Now()
+		for len(queue) > 0 && (all || now.Sub(queue[0].arrived) >= window) {
+			h(heap.Pop(&queue).(mergeItem).entry, nil)
+		}
+	}
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+
+	for {
+		var wait <-chan time.Time
+
+		if len(queue) > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(queue[0].arrived.Add(window)))
+			wait = timer.C
+		}
+
+		select {
+		case e := <-entries:
+			heap.Push(&queue, mergeItem{entry: e, arrived: time.Now()})
+			if window == 0 {
+				release(true)
+			}
+		case <-wait:
+			release(false)
+		case err := <-errs:
+			release(true)
+			h(nil, err)
+			return
+		case <-done:
+			release(true)
+			h(nil, ErrFollowStopped)
+			return
+		}
+	}
+}
+
+// Close closes every source implementing Close
+func (m *MergeReader) Close() {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, src := range m.sources {
+		if s, ok := src.(interface{ Close() }); ok {
+			s.Close()
+		}
+	}
+}
+
+// fill reads the next entry of every source without a buffered entry.
+// Sources are read in parallel when more than one needs to be read.
+// NOTE: The caller must hold the mutex.
+func (m *MergeReader) fill() error {
+
+	var empty []int
+	for i, e := range m.heads {
+		if e == nil {
+			empty = append(empty, i)
+		}
+	}
+
+	if len(empty) == 1 {
+		return m.fillOne(empty[0])
+	}
+
+	errs := make([]error, len(empty))
+	wg := sync.WaitGroup{}
+	wg.Add(len(empty))
+
+	for n, i := range empty {
+		go func(n, i int) {
+			defer wg.Done()
+			errs[n] = m.fillOne(i)
+		}(n, i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *MergeReader) fillOne(i int) error {
+
+	n, err := m.sources[i].Next()
+	if err != nil {
+		return fmt.Errorf("failed to move to next entry of source %d: %w", i, err)
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	e, err := m.sources[i].ReadEntry()
+	if err != nil {
+		return fmt.Errorf("failed to read entry of source %d: %w", i, err)
+	}
+
+	m.heads[i] = e
+
+	return nil
+}
+
+// mergeBefore reports whether a is to be returned before b
+func mergeBefore(a, b *Entry) bool {
+
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+
+	return a.Cursor.Seqnum() < b.Cursor.Seqnum()
+}
+
+// mergeItem is an entry held back while following
+type mergeItem struct {
+	entry   *Entry
+	arrived time.Time
+}
+
+// mergeQueue is a heap of entries ordered like returned by Next
+type mergeQueue []mergeItem
+
+func (q mergeQueue) Len() int           { return len(q) }
+func (q mergeQueue) Less(i, j int) bool { return mergeBefore(q[i].entry, q[j].entry) }
+func (q mergeQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *mergeQueue) Push(x interface{}) {
+	*q = append(*q, x.(mergeItem))
+}
+
+func (q *mergeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
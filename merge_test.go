@@ -0,0 +1,179 @@
+// +build linux
+
+package journal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMergeReader(t *testing.T) {
+
+	var sources []Reader
+
+	for _, name := range []string{"entries.journal", "other.journal"} {
+		path, remove := fixture(t, name)
+		defer remove()
+
+		r, err := OpenFileReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, r)
+	}
+
+	m := NewMergeReader(sources...)
+	defer m.Close()
+
+	if err := m.AddMatch(NewMatch().Match(FieldSyslogIdentifier, "fixture", "other")); err != nil {
+		t.Fatal(err)
+	}
+
+	seq := 0
+
+	for {
+		n, err := m.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+
+		e, err := m.ReadEntry()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seq++
+		if e.Fields["SEQ"] != fmt.Sprint(seq) {
+			t.Errorf("expected entry %d, got %s", seq, e.Fields["SEQ"])
+		}
+	}
+
+	if seq != 8 {
+		t.Errorf("expected 8 entries, got %d", seq)
+	}
+}
+
+// fakeFollower passes entries to the handler at the given delays
+type fakeFollower struct {
+	entries []*Entry
+	delays  []time.Duration
+}
+
+func (f *fakeFollower) Next() (int, error)         { return 0, nil }
+func (f *fakeFollower) ReadEntry() (*Entry, error) { return nil, nil }
+
+func (f *fakeFollower) Follow(h FollowHandler) (FollowStop, error) {
+
+	done := make(chan struct{})
+
+	go func() {
+		for i, e := range f.entries {
+			select {
+			case <-time.After(f.delays[i]):
+				h(e, nil)
+			case <-done:
+				h(nil, ErrFollowStopped)
+				return
+			}
+		}
+
+		<-done
+		h(nil, ErrFollowStopped)
+	}()
+
+	return func() { close(done) }, nil
+}
+
+func TestMergeReaderFollow(t *testing.T) {
+
+	base := time.Now()
+
+	entry := func(seq int) *Entry {
+		return &Entry{
+			Fields:    Fields{"SEQ": fmt.Sprint(seq)},
+			Timestamp: base.Add(time.Duration(seq) * time.Millisecond),
+		}
+	}
+
+	// The second source delivers its entries late
+	a := &fakeFollower{
+		entries: []*Entry{entry(1), entry(3), entry(5)},
+		delays:  []time.Duration{0, 0, 0},
+	}
+	b := &fakeFollower{
+		entries: []*Entry{entry(2), entry(4)},
+		delays:  []time.Duration{50 * time.Millisecond, 0},
+	}
+
+	tests := []struct {
+		window time.Duration
+		want   string
+	}{
+		{500 * time.Millisecond, "1 2 3 4 5 stopped"},
+		{0, "1 3 5 2 4 stopped"},
+	}
+
+	for _, test := range tests {
+		m := NewMergeReader(a, b)
+		m.SetReorderWindow(test.window)
+
+		got := make(chan string, 10)
+
+		stop, err := m.Follow(func(e *Entry, err error) {
+			if err == ErrFollowStopped {
+				got <- "stopped"
+				return
+			}
+			got <- e.Fields["SEQ"]
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var seqs []string
+		for len(seqs) < 5 {
+			select {
+			case s := <-got:
+				seqs = append(seqs, s)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("window %s: timed out after %v", test.window, seqs)
+			}
+		}
+
+		stop()
+		seqs = append(seqs, <-got)
+
+		if s := fmt.Sprint(seqs); s != "["+test.want+"]" {
+			t.Errorf("window %s: expected [%s], got %s", test.window, test.want, s)
+		}
+	}
+}
+
+func TestMergeReaderFollowFileReader(t *testing.T) {
+
+	path, remove := fixture(t, "entries.journal")
+	defer remove()
+
+	r, err := OpenFileReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// FileReaders cannot be followed, so neither can the MergeReader
+	m := NewMergeReader(&fakeFollower{}, r)
+
+	stop, err := m.Follow(func(e *Entry, err error) {})
+	if err == nil {
+		stop()
+		t.Fatal("expected error following a FileReader")
+	}
+
+	if _, err := NewMergeReader().Follow(func(e *Entry, err error) {}); err == nil {
+		t.Error("expected error without sources")
+	}
+}
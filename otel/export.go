@@ -0,0 +1,237 @@
+// +build linux
+
+package otel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/retry"
+)
+
+// ExporterConfig configures an Exporter
+type ExporterConfig struct {
+	// URL of the OTLP/HTTP endpoint, e.g. "http://collector:4318".
+	// Records are posted to /v1/logs unless the URL has another path.
+	URL string
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+	// Resource holds static resource attributes, e.g. service.name, set
+	// along with those from the journal fields
+	Resource map[string]string
+	// Gzip compresses requests
+	Gzip bool
+	// Client is used for requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// StateFile is where the cursor of the last exported entry is saved.
+	// Exporting resumes after the saved cursor.
+	StateFile string
+	// BatchSize is the maximum number of entries per request.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back while
+	// following. Defaults to 1s.
+	FlushInterval time.Duration
+	// Retries is the number of times a failed request is retried.
+	// Defaults to 4. A negative value retries until the request succeeds.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for
+	// every following retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+	// OnError is called with errors while following, and with log
+	// records rejected by the collector
+	OnError func(err error)
+}
+
+// Exporter exports journal entries as OpenTelemetry log records. The
+// severity is set from PRIORITY, the body from MESSAGE and the trace
+// context from TRACE_ID and SPAN_ID. _HOSTNAME, _MACHINE_ID, _BOOT_ID and
+// _SYSTEMD_UNIT are resource attributes, other fields are attributes of
+// the log records.
+type Exporter struct {
+	cfg     ExporterConfig
+	url     string
+	backoff retry.Backoff
+}
+
+// exportResponse is the response of the collector
+type exportResponse struct {
+	PartialSuccess struct {
+		RejectedLogRecords int64Value `json:"rejectedLogRecords"`
+		ErrorMessage       string     `json:"errorMessage"`
+	} `json:"partialSuccess"`
+}
+
+// int64Value is an int64 decoded from a JSON string, as encoded by the
+// OTLP JSON mapping, or from a JSON number, as sent by some collectors
+type int64Value int64
+
+func (v *int64Value) UnmarshalJSON(b []byte) error {
+
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", b)
+	}
+
+	*v = int64Value(n)
+
+	return nil
+}
+
+// NewExporter creates an Exporter
+func NewExporter(cfg ExporterConfig) (*Exporter, error) {
+
+	if cfg.URL == "" {
+		return nil, errors.New("an OTLP endpoint URL must be provided")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	url := strings.TrimSuffix(cfg.URL, "/")
+	if i := strings.Index(url, "://"); i < 0 || !strings.Contains(url[i+3:], "/") {
+		url += "/v1/logs"
+	}
+
+	return &Exporter{
+		cfg:     cfg,
+		url:     url,
+		backoff: retry.WithRetries(cfg.Retries, cfg.RetryBackoff),
+	}, nil
+}
+
+// Export exports entries in a single request, retrying on failure as
+// specified by OTLP
+func (x *Exporter) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	body, err := x.encode(entries)
+	if err != nil {
+		return err
+	}
+
+	return x.backoff.Do(ctx, func() error {
+		return x.post(ctx, body)
+	})
+}
+
+// ExportJournal exports the entries of j from its current position, or
+// after the cursor in the state file, until there are no more entries.
+func (x *Exporter) ExportJournal(ctx context.Context, j journal.Reader) error {
+	return batch.Read(ctx, j, x.batchConfig(), x.Export)
+}
+
+// Follow follows j from its current position, or after the cursor in
+// the state file, and exports entries as they are written. Errors are
+// passed to OnError. Following stops if entries fail to be exported.
+func (x *Exporter) Follow(j journal.Follower) (journal.FollowStop, error) {
+	return batch.Follow(j, x.batchConfig(), x.Export)
+}
+
+func (x *Exporter) batchConfig() batch.Config {
+	return batch.Config{
+		Size:      x.cfg.BatchSize,
+		Interval:  x.cfg.FlushInterval,
+		StateFile: x.cfg.StateFile,
+		OnError:   x.cfg.OnError,
+	}
+}
+
+// encode encodes the export request of entries
+func (x *Exporter) encode(entries []*journal.Entry) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	w := io.Writer(&buf)
+
+	var zw *gzip.Writer
+	if x.cfg.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	if err := json.NewEncoder(w).Encode(newLogsData(entries, x.cfg.Resource)); err != nil {
+		return nil, fmt.Errorf("failed to encode log records: %w", err)
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress log records: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// post sends an export request. Rate limiting and unavailable collectors
+// are retried, other errors are not.
+func (x *Exporter) post(ctx context.Context, body []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, x.url, bytes.NewReader(body))
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("failed to create export request: %w", err))
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if x.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range x.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := x.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export log records: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		var r exportResponse
+		if json.Unmarshal(msg, &r) == nil && r.PartialSuccess.RejectedLogRecords > 0 {
+			x.cfg.OnError(fmt.Errorf("collector rejected %d log records: %s",
+				r.PartialSuccess.RejectedLogRecords, r.PartialSuccess.ErrorMessage))
+		}
+		return nil
+	}
+
+	err = fmt.Errorf("failed to export log records: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return err
+	}
+
+	return retry.Permanent(err)
+}
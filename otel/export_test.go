@@ -0,0 +1,318 @@
+// +build linux
+
+package otel
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// collector replies to export requests with the given responses in turn,
+// replying with an empty success once all have been used, and records the
+// bodies of the log records of every request
+type collector struct {
+	*httptest.Server
+	responses []response
+	requests  int
+	bodies    []string
+	header    http.Header
+	path      string
+	mutex     sync.Mutex
+}
+
+type response struct {
+	status int
+	body   string
+}
+
+func newCollector(t *testing.T, responses ...response) *collector {
+
+	c := &collector{responses: responses}
+
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		c.header = r.Header
+		c.path = r.URL.Path
+
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("failed to decompress request: %v", err)
+				return
+			}
+			body = zr
+		}
+
+		var data logsData
+		if err := json.NewDecoder(body).Decode(&data); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		var bodies []string
+		for _, rl := range data.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				for _, lr := range sl.LogRecords {
+					bodies = append(bodies, *lr.Body.StringValue)
+				}
+			}
+		}
+
+		resp := response{http.StatusOK, "{}"}
+		if c.requests < len(c.responses) {
+			resp = c.responses[c.requests]
+		}
+		c.requests++
+
+		if resp.status == http.StatusOK {
+			c.bodies = append(c.bodies, bodies...)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		io.WriteString(w, resp.body)
+	}))
+
+	return c
+}
+
+func (c *collector) result() (int, string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.requests, strings.Join(c.bodies, " ")
+}
+
+func TestExporterExport(t *testing.T) {
+
+	entries := []*journal.Entry{
+		{Fields: journal.Fields{journal.FieldMessage: "first", journal.FieldUnit: "a.service"}},
+		{Fields: journal.Fields{journal.FieldMessage: "second", journal.FieldUnit: "b.service"}},
+	}
+
+	tests := []struct {
+		name      string
+		responses []response
+		gzip      bool
+		requests  int
+		want      string
+		errors    string
+		err       bool
+	}{
+		{
+			name:     "success",
+			requests: 1,
+			want:     "first second",
+		},
+		{
+			name:     "gzip",
+			gzip:     true,
+			requests: 1,
+			want:     "first second",
+		},
+		{
+			name: "partial success string",
+			responses: []response{
+				{http.StatusOK, `{"partialSuccess":{"rejectedLogRecords":"1","errorMessage":"too old"}}`},
+			},
+			requests: 1,
+			want:     "first second",
+			errors:   "collector rejected 1 log records: too old",
+		},
+		{
+			name: "partial success number",
+			responses: []response{
+				{http.StatusOK, `{"partialSuccess":{"rejectedLogRecords":2,"errorMessage":"too old"}}`},
+			},
+			requests: 1,
+			want:     "first second",
+			errors:   "collector rejected 2 log records: too old",
+		},
+		{
+			name: "partial success none",
+			responses: []response{
+				{http.StatusOK, `{"partialSuccess":{}}`},
+			},
+			requests: 1,
+			want:     "first second",
+		},
+		{
+			name: "unavailable",
+			responses: []response{
+				{http.StatusServiceUnavailable, "unavailable"},
+				{http.StatusTooManyRequests, "slow down"},
+			},
+			requests: 3,
+			want:     "first second",
+		},
+		{
+			name: "bad request",
+			responses: []response{
+				{http.StatusBadRequest, "invalid"},
+			},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name: "retries used up",
+			responses: []response{
+				{http.StatusBadGateway, ""},
+				{http.StatusBadGateway, ""},
+				{http.StatusBadGateway, ""},
+			},
+			requests: 3,
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newCollector(t, test.responses...)
+			defer c.Close()
+
+			var errs []string
+
+			x, err := NewExporter(ExporterConfig{
+				URL:          c.URL,
+				Headers:      map[string]string{"Authorization": "Bearer token"},
+				Gzip:         test.gzip,
+				Retries:      2,
+				RetryBackoff: time.Millisecond,
+				OnError:      func(err error) { errs = append(errs, err.Error()) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = x.Export(context.Background(), entries)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			requests, got := c.result()
+			if requests != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, requests)
+			}
+			if got != test.want {
+				t.Errorf("expected log records [%s], got [%s]", test.want, got)
+			}
+			if e := strings.Join(errs, "; "); e != test.errors {
+				t.Errorf("expected errors %q, got %q", test.errors, e)
+			}
+			if c.path != "/v1/logs" {
+				t.Errorf("expected path /v1/logs, got %s", c.path)
+			}
+			if h := c.header.Get("Authorization"); h != "Bearer token" {
+				t.Errorf("expected Authorization header, got %q", h)
+			}
+		})
+	}
+}
+
+func TestExporterExportJournal(t *testing.T) {
+
+	c := newCollector(t)
+	defer c.Close()
+
+	x, err := NewExporter(ExporterConfig{URL: c.URL + "/custom/logs", BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make([]*journal.Entry, 5)
+	for i := range entries {
+		entries[i] = &journal.Entry{
+			Fields: journal.Fields{journal.FieldMessage: fmt.Sprintf("%d", i+1)},
+		}
+	}
+
+	if err := x.ExportJournal(context.Background(), &journaltest.SliceReader{Entries: entries}); err != nil {
+		t.Fatal(err)
+	}
+
+	requests, got := c.result()
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if got != "1 2 3 4 5" {
+		t.Errorf("expected log records [1 2 3 4 5], got [%s]", got)
+	}
+	if c.path != "/custom/logs" {
+		t.Errorf("expected path /custom/logs, got %s", c.path)
+	}
+}
+
+func TestInt64Value(t *testing.T) {
+
+	tests := []struct {
+		json string
+		want int64
+		err  bool
+	}{
+		{`"12"`, 12, false},
+		{`12`, 12, false},
+		{`null`, 0, false},
+		{`"x"`, 0, true},
+		{`1.5`, 0, true},
+	}
+
+	for _, test := range tests {
+		var v int64Value
+		err := json.Unmarshal([]byte(test.json), &v)
+		if (err != nil) != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.json, test.err, err)
+		}
+		if int64(v) != test.want {
+			t.Errorf("%s: expected %d, got %d", test.json, test.want, v)
+		}
+	}
+}
+
+func BenchmarkExporterExport(b *testing.B) {
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		io.WriteString(w, "{}")
+	}))
+	defer s.Close()
+
+	x, err := NewExporter(ExporterConfig{URL: s.URL, Gzip: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	entries := make([]*journal.Entry, 100)
+	for i := range entries {
+		entries[i] = &journal.Entry{
+			Fields: journal.Fields{
+				journal.FieldMessage:  fmt.Sprintf("message %d", i),
+				journal.FieldPriority: "6",
+				journal.FieldUnit:     "app.service",
+			},
+			Timestamp: time.Now(),
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := x.Export(context.Background(), entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// +build linux
+
+// Package otel exports journal entries as OpenTelemetry log records
+// using OTLP/HTTP with JSON encoding.
+package otel
+
+import (
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Fields holding the W3C trace context of an entry
+const (
+	FieldTraceID = "TRACE_ID"
+	FieldSpanID  = "SPAN_ID"
+)
+
+// Resource attributes set from journal fields
+const (
+	AttributeHostName = "host.name"
+	AttributeHostID   = "host.id"
+	AttributeBootID   = "systemd.boot.id"
+	AttributeUnit     = "systemd.unit"
+)
+
+// Name of the instrumentation scope of the log records
+const scopeName = "github.com/vargspjut/systemd-journal/otel"
+
+// Severity numbers of the priorities, from emerg to debug
+var severityNumbers = []int{22, 21, 18, 17, 13, 10, 9, 5}
+
+// Journal fields mapped to resource attributes
+var resourceFields = []struct {
+	field     string
+	attribute string
+}{
+	{journal.FieldHostname, AttributeHostName},
+	{journal.FieldMachineID, AttributeHostID},
+	{journal.FieldBootID, AttributeBootID},
+	{journal.FieldUnit, AttributeUnit},
+}
+
+// The following types are the OTLP JSON encoding of an export request
+
+type logsData struct {
+	ResourceLogs []*resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource     `json:"resource"`
+	ScopeLogs []*scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	Scope      scope        `json:"scope"`
+	LogRecords []*logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano,omitempty"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 *anyValue  `json:"body,omitempty"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	TraceID              string     `json:"traceId,omitempty"`
+	SpanID               string     `json:"spanId,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	// Base64 encoded by encoding/json, as OTLP JSON expects
+	BytesValue []byte `json:"bytesValue,omitempty"`
+}
+
+func stringValue(v string) anyValue {
+
+	if !utf8.ValidString(v) {
+		return anyValue{BytesValue: []byte(v)}
+	}
+
+	return anyValue{StringValue: &v}
+}
+
+// newLogsData converts entries to log records grouped by resource, with
+// resource attributes from the journal fields and static attributes
+func newLogsData(entries []*journal.Entry, static map[string]string) *logsData {
+
+	data := &logsData{}
+	byResource := map[string]*scopeLogs{}
+
+	for _, e := range entries {
+		attrs := resourceAttributes(e, static)
+
+		key := resourceKey(attrs)
+		sl, ok := byResource[key]
+		if !ok {
+			sl = &scopeLogs{Scope: scope{Name: scopeName}}
+			byResource[key] = sl
+			data.ResourceLogs = append(data.ResourceLogs, &resourceLogs{
+				Resource:  resource{Attributes: attrs},
+				ScopeLogs: []*scopeLogs{sl},
+			})
+		}
+
+		sl.LogRecords = append(sl.LogRecords, newLogRecord(e))
+	}
+
+	return data
+}
+
+func resourceAttributes(e *journal.Entry, static map[string]string) []keyValue {
+
+	var attrs []keyValue
+
+	keys := make([]string, 0, len(static))
+	for k := range static {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		attrs = append(attrs, keyValue{Key: k, Value: stringValue(static[k])})
+	}
+
+	for _, rf := range resourceFields {
+		if v, ok := e.Fields[rf.field]; ok {
+			attrs = append(attrs, keyValue{Key: rf.attribute, Value: stringValue(v)})
+		}
+	}
+
+	return attrs
+}
+
+func resourceKey(attrs []keyValue) string {
+
+	var b strings.Builder
+
+	for _, a := range attrs {
+		b.WriteString(a.Key)
+		b.WriteByte(0)
+		if a.Value.StringValue != nil {
+			b.WriteString(*a.Value.StringValue)
+		} else {
+			b.Write(a.Value.BytesValue)
+		}
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
+
+// newLogRecord converts an entry to a log record. Fields other than
+// those mapped to the record or its resource become attributes.
+func newLogRecord(e *journal.Entry) *logRecord {
+
+	r := &logRecord{}
+
+	if t, err := e.SourceTime(); err == nil && !t.IsZero() {
+		r.TimeUnixNano = strconv.FormatInt(t.UnixNano(), 10)
+	}
+	if !e.Timestamp.IsZero() {
+		r.ObservedTimeUnixNano = strconv.FormatInt(e.Timestamp.UnixNano(), 10)
+	}
+
+	if p, err := e.Priority(); err == nil && p >= journal.PriorityEmergency && p <= journal.PriorityDebug {
+		r.SeverityNumber = severityNumbers[p]
+		text, _ := p.MarshalText()
+		r.SeverityText = string(text)
+	}
+
+	if msg, ok := e.Fields[journal.FieldMessage]; ok {
+		body := stringValue(msg)
+		r.Body = &body
+	}
+
+	skip := map[string]bool{
+		journal.FieldMessage:                 true,
+		journal.FieldPriority:                true,
+		journal.FieldSourceRealtimeTimestamp: true,
+	}
+
+	for _, rf := range resourceFields {
+		skip[rf.field] = true
+	}
+
+	if id := e.Fields[FieldTraceID]; validHexID(id, 16) {
+		r.TraceID = strings.ToLower(id)
+		skip[FieldTraceID] = true
+
+		if id := e.Fields[FieldSpanID]; validHexID(id, 8) {
+			r.SpanID = strings.ToLower(id)
+			skip[FieldSpanID] = true
+		}
+	}
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		if !skip[name] && !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.Attributes = append(r.Attributes, keyValue{Key: name, Value: stringValue(e.Fields[name])})
+	}
+
+	return r
+}
+
+// validHexID returns true if id is a hex encoded ID of size bytes that
+// isn't all zeros
+func validHexID(id string, size int) bool {
+
+	if len(id) != size*2 {
+		return false
+	}
+
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return false
+	}
+
+	for _, c := range b {
+		if c != 0 {
+			return true
+		}
+	}
+
+	return false
+}
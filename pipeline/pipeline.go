@@ -0,0 +1,567 @@
+// +build linux
+
+// Package pipeline moves journal entries from a source through
+// transforms to sinks, in batches and with cursor checkpoints.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+)
+
+// Sink exports batches of entries. The exporters of this module, such as
+// remote.Uploader, otel.Exporter and loki.Pusher, are sinks.
+type Sink interface {
+	Export(ctx context.Context, entries []*journal.Entry) error
+}
+
+// SinkFunc is a function used as a Sink
+type SinkFunc func(ctx context.Context, entries []*journal.Entry) error
+
+// Export calls f
+func (f SinkFunc) Export(ctx context.Context, entries []*journal.Entry) error {
+	return f(ctx, entries)
+}
+
+// Encoder is implemented by encoders of entries such as
+// journal.ExportEncoder and journal.JSONEncoder
+type Encoder interface {
+	Encode(e *journal.Entry) error
+}
+
+// EncoderSink exports entries by encoding them using enc
+func EncoderSink(enc Encoder) Sink {
+	return SinkFunc(func(ctx context.Context, entries []*journal.Entry) error {
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Config configures a Pipeline
+type Config struct {
+	Source Source
+	// Transforms are applied to every entry in order
+	Transforms []Transform
+	// Sinks are all passed the entries kept by the transforms. Entries
+	// are shared by the sinks and must not be modified by them.
+	Sinks []Sink
+	// BufferSize is the capacity of the channels between the stages.
+	// Defaults to 1000.
+	BufferSize int
+	// BatchSize is the maximum number of entries exported at once.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back before a
+	// partial batch is exported. Defaults to 1s.
+	FlushInterval time.Duration
+	// StateFile is where the cursor of the last entry handled is saved
+	// once exported by all sinks. Running resumes after the saved cursor,
+	// so entries are exported at least once. No state is kept if empty.
+	StateFile string
+	// DrainTimeout is the maximum time to export the pending entries
+	// once the context of Run is done. Defaults to 30s.
+	DrainTimeout time.Duration
+}
+
+// Metrics are counters of the entries passing through a pipeline
+type Metrics struct {
+	// Read is the number of entries read from the source
+	Read uint64
+	// Dropped is the number of entries dropped by transforms
+	Dropped uint64
+	// Queued is the number of entries waiting between the stages
+	Queued int
+	// Transforms are the metrics of each transform
+	Transforms []TransformMetrics
+	// Sinks are the metrics of each sink
+	Sinks []SinkMetrics
+}
+
+// TransformMetrics are counters of the entries passing through a
+// transform
+type TransformMetrics struct {
+	// Read is the number of entries passed to the transform
+	Read uint64
+	// Dropped is the number of entries dropped by the transform
+	Dropped uint64
+	// Queued is the number of entries waiting for the transform
+	Queued int
+}
+
+// SinkMetrics are counters of the entries passing through a sink
+type SinkMetrics struct {
+	// Read is the number of entries passed to the sink
+	Read uint64
+	// Dropped is the number of entries left unexported as a sink failed
+	Dropped uint64
+	// Queued is the number of entries waiting to be exported
+	Queued int
+	// Exported is the number of entries exported
+	Exported uint64
+	// Batches is the number of batches exported
+	Batches uint64
+	// Failed is the number of batches that failed to be exported
+	Failed uint64
+}
+
+// Pipeline reads entries from a source, applies transforms and exports
+// them to sinks. The stages run concurrently and are connected by
+// bounded channels, so a slow sink holds back the source.
+type Pipeline struct {
+	cfg Config
+
+	read       uint64
+	entries    chan *journal.Entry
+	transforms []*transformStage
+	// Entries kept by the transforms, passed on to the sinks
+	items chan item
+	sinks []*sinkStage
+	ckpt  *checkpointer
+}
+
+// item is an entry that passed the transforms, or nil if dropped, along
+// with the cursor of the entry read from the source
+type item struct {
+	entry  *journal.Entry
+	cursor journal.Cursor
+}
+
+type transformStage struct {
+	transform Transform
+	in        chan item
+	read      uint64
+	dropped   uint64
+}
+
+type sinkStage struct {
+	sink     Sink
+	in       chan item
+	read     uint64
+	dropped  uint64
+	pending  int64
+	exported uint64
+	batches  uint64
+	failed   uint64
+}
+
+// New creates a Pipeline
+func New(cfg Config) (*Pipeline, error) {
+
+	if cfg.Source == nil {
+		return nil, errors.New("a pipeline source must be provided")
+	}
+	if len(cfg.Sinks) == 0 {
+		return nil, errors.New("a pipeline sink must be provided")
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+
+	p := &Pipeline{
+		cfg:     cfg,
+		entries: make(chan *journal.Entry, cfg.BufferSize),
+		items:   make(chan item, cfg.BufferSize),
+	}
+
+	for _, t := range cfg.Transforms {
+		p.transforms = append(p.transforms, &transformStage{
+			transform: t,
+			in:        make(chan item, cfg.BufferSize),
+		})
+	}
+
+	for _, s := range cfg.Sinks {
+		p.sinks = append(p.sinks, &sinkStage{
+			sink: s,
+			in:   make(chan item, cfg.BufferSize),
+		})
+	}
+
+	if cfg.StateFile != "" {
+		p.ckpt = &checkpointer{
+			stateFile: cfg.StateFile,
+			handled:   make([]uint64, len(cfg.Sinks)),
+		}
+	}
+
+	return p, nil
+}
+
+// Run runs the pipeline until the source has no more entries, ctx is
+// done or a sink fails. When ctx is done, the source is stopped and the
+// entries already read are exported within the drain timeout before
+// returning. If a sink fails, the entries not exported by all sinks are
+// left for the next run and the error is returned. A pipeline can only
+// be run once.
+func (p *Pipeline) Run(ctx context.Context) error {
+
+	after, err := p.loadCursor()
+	if err != nil {
+		return err
+	}
+
+	srcCtx, cancelSrc := context.WithCancel(ctx)
+	defer cancelSrc()
+
+	// Exports are cancelled along with ctx, or if a sink fails
+	exportCtx, cancelExport := context.WithCancel(ctx)
+	defer cancelExport()
+
+	// Done if a sink fails, to stop the other stages
+	abortCtx, cancelAbort := context.WithCancel(context.Background())
+	defer cancelAbort()
+
+	var (
+		once     sync.Once
+		abortErr error
+		wg       sync.WaitGroup
+	)
+
+	abort := func(err error) {
+		once.Do(func() {
+			abortErr = err
+			cancelAbort()
+			cancelExport()
+			cancelSrc()
+		})
+	}
+
+	srcErr := make(chan error, 1)
+
+	go func() {
+		defer close(p.entries)
+		srcErr <- p.cfg.Source.Run(srcCtx, after, p.entries)
+	}()
+
+	stage := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+
+	stage(func() { p.receive(abortCtx.Done()) })
+
+	for i := range p.transforms {
+		i := i
+		stage(func() { p.transform(i, abortCtx.Done()) })
+	}
+
+	stage(func() { p.dispatch(abortCtx.Done()) })
+
+	for i := range p.sinks {
+		i := i
+		stage(func() {
+			if err := p.export(ctx, exportCtx, abortCtx, i); err != nil {
+				abort(err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	err = <-srcErr
+	if abortErr != nil {
+		return abortErr
+	}
+
+	return err
+}
+
+// Metrics returns the current counters of the pipeline
+func (p *Pipeline) Metrics() Metrics {
+
+	m := Metrics{
+		Read:   atomic.LoadUint64(&p.read),
+		Queued: len(p.entries) + len(p.items),
+	}
+
+	for _, t := range p.transforms {
+		tm := TransformMetrics{
+			Read:    atomic.LoadUint64(&t.read),
+			Dropped: atomic.LoadUint64(&t.dropped),
+			Queued:  len(t.in),
+		}
+
+		m.Dropped += tm.Dropped
+		m.Queued += tm.Queued
+		m.Transforms = append(m.Transforms, tm)
+	}
+
+	for _, s := range p.sinks {
+		sm := SinkMetrics{
+			Read:     atomic.LoadUint64(&s.read),
+			Dropped:  atomic.LoadUint64(&s.dropped),
+			Queued:   len(s.in) + int(atomic.LoadInt64(&s.pending)),
+			Exported: atomic.LoadUint64(&s.exported),
+			Batches:  atomic.LoadUint64(&s.batches),
+			Failed:   atomic.LoadUint64(&s.failed),
+		}
+
+		m.Queued += sm.Queued
+		m.Sinks = append(m.Sinks, sm)
+	}
+
+	return m
+}
+
+// next returns the channel following the transform at index i, where -1
+// is the source
+func (p *Pipeline) next(i int) chan item {
+
+	if i+1 < len(p.transforms) {
+		return p.transforms[i+1].in
+	}
+
+	return p.items
+}
+
+// receive passes the entries of the source on to the transforms until the
+// source is done
+func (p *Pipeline) receive(abort <-chan struct{}) {
+
+	out := p.next(-1)
+	defer close(out)
+
+	for e := range p.entries {
+		atomic.AddUint64(&p.read, 1)
+
+		select {
+		case out <- item{entry: e, cursor: e.Cursor}:
+		case <-abort:
+			// Drain the source without passing on entries
+		}
+	}
+}
+
+// transform applies the transform at index i to the entries passed to it
+// until the previous stage is done. Dropped entries are passed on without
+// the entry, to be checkpointed.
+func (p *Pipeline) transform(i int, abort <-chan struct{}) {
+
+	t := p.transforms[i]
+
+	out := p.next(i)
+	defer close(out)
+
+	for it := range t.in {
+		if it.entry != nil {
+			atomic.AddUint64(&t.read, 1)
+
+			if it.entry = t.transform.Apply(it.entry); it.entry == nil {
+				atomic.AddUint64(&t.dropped, 1)
+			}
+		}
+
+		select {
+		case out <- it:
+		case <-abort:
+		}
+	}
+}
+
+// dispatch passes the transformed entries on to every sink
+func (p *Pipeline) dispatch(abort <-chan struct{}) {
+
+	defer func() {
+		for _, s := range p.sinks {
+			close(s.in)
+		}
+	}()
+
+	for it := range p.items {
+		if p.ckpt != nil {
+			p.ckpt.add(it.cursor)
+		}
+
+		for _, s := range p.sinks {
+			select {
+			case s.in <- it:
+			case <-abort:
+			}
+		}
+	}
+}
+
+// export exports the entries passed to the sink at index i in batches,
+// checkpointing the last entry handled, including dropped ones. Batches
+// are exported within exportCtx until ctx is done, and then within the
+// drain timeout. Nothing more is exported once abortCtx is done.
+func (p *Pipeline) export(ctx, exportCtx, abortCtx context.Context, i int) error {
+
+	s := p.sinks[i]
+
+	var (
+		drainCtx    context.Context
+		cancelDrain = func() {}
+	)
+
+	defer func() { cancelDrain() }()
+
+	// exportContext returns the context to export within
+	exportContext := func() context.Context {
+		if ctx.Err() == nil {
+			return exportCtx
+		}
+
+		if drainCtx == nil {
+			drainCtx, cancelDrain = context.WithTimeout(abortCtx, p.cfg.DrainTimeout)
+		}
+
+		return drainCtx
+	}
+
+	cfg := batch.Config{Size: p.cfg.BatchSize}
+	if p.ckpt != nil {
+		cfg.Checkpoint = func(c journal.Cursor) error {
+			return p.ckpt.done(i, c)
+		}
+	}
+
+	b := batch.NewBatcher(cfg, func(ectx context.Context, entries []*journal.Entry) error {
+		err := s.sink.Export(ectx, entries)
+
+		// Entries being exported as ctx is done are exported again
+		// within the drain timeout
+		if err != nil && ectx == exportCtx && ctx.Err() != nil && abortCtx.Err() == nil {
+			err = s.sink.Export(exportContext(), entries)
+		}
+
+		if err != nil {
+			atomic.AddUint64(&s.failed, 1)
+			return err
+		}
+
+		atomic.AddUint64(&s.batches, 1)
+		atomic.AddUint64(&s.exported, uint64(len(entries)))
+
+		return nil
+	})
+
+	fail := func(err error) error {
+		atomic.AddUint64(&s.dropped, uint64(b.Len()))
+		atomic.StoreInt64(&s.pending, 0)
+		return err
+	}
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-abortCtx.Done():
+			return fail(nil)
+		case <-ticker.C:
+			if err := b.Flush(exportContext()); err != nil {
+				return fail(err)
+			}
+		case it, ok := <-s.in:
+			if !ok {
+				if err := b.Flush(exportContext()); err != nil {
+					return fail(err)
+				}
+				atomic.StoreInt64(&s.pending, 0)
+				return nil
+			}
+
+			if it.entry == nil {
+				b.Skip(it.cursor)
+				continue
+			}
+
+			atomic.AddUint64(&s.read, 1)
+
+			if err := b.Add(exportContext(), it.entry); err != nil {
+				return fail(err)
+			}
+		}
+
+		atomic.StoreInt64(&s.pending, int64(b.Len()))
+	}
+}
+
+func (p *Pipeline) loadCursor() (journal.Cursor, error) {
+
+	if p.cfg.StateFile == "" {
+		return journal.Cursor{}, nil
+	}
+
+	return batch.LoadCursor(p.cfg.StateFile)
+}
+
+// checkpointer saves the cursor of the last entry handled by all sinks
+type checkpointer struct {
+	stateFile string
+
+	mutex sync.Mutex
+	// Cursors of the entries passed to the sinks and not yet handled by
+	// all of them, the first one being entry number base
+	cursors []journal.Cursor
+	base    uint64
+	// Number of entries handled by each sink
+	handled []uint64
+}
+
+// add adds the cursor of an entry passed to the sinks
+func (c *checkpointer) add(cursor journal.Cursor) {
+
+	if cursor.IsZero() {
+		return
+	}
+
+	c.mutex.Lock()
+	c.cursors = append(c.cursors, cursor)
+	c.mutex.Unlock()
+}
+
+// done marks the entries up to cursor as handled by the sink at index i,
+// saving the cursor of the last entry handled by the slowest sink
+func (c *checkpointer) done(i int, cursor journal.Cursor) error {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for n := c.handled[i] - c.base; n < uint64(len(c.cursors)); n++ {
+		if c.cursors[n] == cursor {
+			c.handled[i] = c.base + n + 1
+			break
+		}
+	}
+
+	slowest := c.handled[0]
+	for _, n := range c.handled[1:] {
+		if n < slowest {
+			slowest = n
+		}
+	}
+
+	if slowest == c.base {
+		return nil
+	}
+
+	last := c.cursors[slowest-c.base-1]
+	c.cursors = c.cursors[slowest-c.base:]
+	c.base = slowest
+
+	return batch.SaveCursor(c.stateFile, last)
+}
@@ -0,0 +1,294 @@
+// +build linux
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// recordSink records the entries exported to it
+type recordSink struct {
+	entries []*journal.Entry
+	mutex   sync.Mutex
+}
+
+func (s *recordSink) Export(ctx context.Context, entries []*journal.Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+func (s *recordSink) result() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return journaltest.Messages(s.entries)
+}
+
+func tempStateFile(t *testing.T) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "state"), func() { os.RemoveAll(dir) }
+}
+
+func TestPipelineRun(t *testing.T) {
+
+	stateFile, remove := tempStateFile(t)
+	defer remove()
+
+	entries := journaltest.Entries(10)
+	odd := Filter(func(e *journal.Entry) bool {
+		n, _ := strconv.Atoi(e.Fields[journal.FieldMessage])
+		return n%2 == 1
+	})
+
+	sinks := []*recordSink{{}, {}}
+
+	p, err := New(Config{
+		Source:     ReaderSource(&journaltest.SliceReader{Entries: entries}),
+		Transforms: []Transform{odd, DropFields("X"), Sample(2, journal.PriorityWarning)},
+		Sinks:      []Sink{sinks[0], sinks[1]},
+		BatchSize:  2,
+		StateFile:  stateFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, s := range sinks {
+		if want := "1 5 9"; s.result() != want {
+			t.Errorf("sink %d: expected entries [%s], got [%s]", i, want, s.result())
+		}
+	}
+
+	// Dropped entries are checkpointed as well
+	if c, _ := batch.LoadCursor(stateFile); c != entries[9].Cursor {
+		t.Errorf("expected saved cursor %s, got %s", entries[9].Cursor, c)
+	}
+
+	m := p.Metrics()
+	if m.Read != 10 || m.Dropped != 7 || m.Queued != 0 {
+		t.Errorf("expected 10 read, 7 dropped and none queued, got %+v", m)
+	}
+
+	want := []TransformMetrics{{Read: 10, Dropped: 5}, {Read: 5}, {Read: 5, Dropped: 2}}
+	for i, tm := range m.Transforms {
+		if tm != want[i] {
+			t.Errorf("transform %d: expected %+v, got %+v", i, want[i], tm)
+		}
+	}
+
+	for i, sm := range m.Sinks {
+		if want := (SinkMetrics{Read: 3, Exported: 3, Batches: 2}); sm != want {
+			t.Errorf("sink %d: expected %+v, got %+v", i, want, sm)
+		}
+	}
+}
+
+// failSink waits for another sink to export n entries before failing to
+// export its second batch
+type failSink struct {
+	recordSink
+	other   *recordSink
+	n       int
+	batches int
+}
+
+func (s *failSink) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if s.batches++; s.batches == 1 {
+		return s.recordSink.Export(ctx, entries)
+	}
+
+	for {
+		s.other.mutex.Lock()
+		n := len(s.other.entries)
+		s.other.mutex.Unlock()
+
+		if n >= s.n {
+			return errors.New("export failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPipelineSlowestSink(t *testing.T) {
+
+	stateFile, remove := tempStateFile(t)
+	defer remove()
+
+	entries := journaltest.Entries(6)
+	fast := &recordSink{}
+	slow := &failSink{other: fast, n: 6}
+
+	p, err := New(Config{
+		Source:    ReaderSource(&journaltest.SliceReader{Entries: entries}),
+		Sinks:     []Sink{fast, slow},
+		BatchSize: 2,
+		StateFile: stateFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Run(context.Background()); err == nil {
+		t.Fatal("expected export error")
+	}
+
+	if want := "1 2 3 4 5 6"; fast.result() != want {
+		t.Errorf("expected entries [%s], got [%s]", want, fast.result())
+	}
+	if want := "1 2"; slow.result() != want {
+		t.Errorf("expected entries [%s], got [%s]", want, slow.result())
+	}
+
+	// Checkpointed at the slowest sink
+	if c, _ := batch.LoadCursor(stateFile); c != entries[1].Cursor {
+		t.Errorf("expected saved cursor %s, got %s", entries[1].Cursor, c)
+	}
+
+	m := p.Metrics()
+	if m.Sinks[0].Exported != 6 || m.Sinks[1].Exported != 2 || m.Sinks[1].Failed != 1 || m.Sinks[1].Dropped == 0 {
+		t.Errorf("unexpected sink metrics %+v", m.Sinks)
+	}
+}
+
+// drainSink fails its first export once ctx is done, signalling started
+// when called, and records the entries of the following exports if
+// exported within a context that isn't done
+type drainSink struct {
+	recordSink
+	started chan struct{}
+	calls   int
+}
+
+func (s *drainSink) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if s.calls++; s.calls == 1 {
+		close(s.started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.recordSink.Export(ctx, entries)
+}
+
+func TestPipelineDrain(t *testing.T) {
+
+	entries := journaltest.Entries(5)
+	sink := &drainSink{started: make(chan struct{})}
+
+	p, err := New(Config{
+		Source:        FollowSource(&journaltest.Follower{SliceReader: journaltest.SliceReader{Entries: entries}}),
+		Sinks:         []Sink{sink},
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		DrainTimeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.Run(ctx)
+	}()
+
+	// Stop while the first batch is being exported, within the context
+	// of Run
+	select {
+	case <-sink.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for export")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Metrics().Read < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for pipeline to stop")
+	}
+
+	// The interrupted batch and the pending entries are exported when
+	// draining
+	if want := "1 2 3 4 5"; sink.result() != want {
+		t.Errorf("expected entries [%s], got [%s]", want, sink.result())
+	}
+	if sink.calls != 3 {
+		t.Errorf("expected 3 exports, got %d", sink.calls)
+	}
+}
+
+func TestNew(t *testing.T) {
+
+	src := ReaderSource(&journaltest.SliceReader{})
+
+	if _, err := New(Config{Sinks: []Sink{&recordSink{}}}); err == nil {
+		t.Error("expected error without source")
+	}
+	if _, err := New(Config{Source: src}); err == nil {
+		t.Error("expected error without sinks")
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+
+	entries := journaltest.Entries(1000)
+	sink := SinkFunc(func(ctx context.Context, entries []*journal.Entry) error {
+		return nil
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p, err := New(Config{
+			Source:     ReaderSource(&journaltest.SliceReader{Entries: entries}),
+			Transforms: []Transform{DropFields("X"), AddFields(journal.Fields{"ENV": "test"})},
+			Sinks:      []Sink{sink, sink},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := p.Run(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
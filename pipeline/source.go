@@ -0,0 +1,202 @@
+// +build linux
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+)
+
+// Source emits the entries of a pipeline
+type Source interface {
+	// Run sends entries to out, starting after the cursor if not zero,
+	// until ctx is done or there are no more entries
+	Run(ctx context.Context, after journal.Cursor, out chan<- *journal.Entry) error
+}
+
+// Decoder is implemented by decoders of entries such as
+// journal.ExportDecoder and journal.JSONDecoder
+type Decoder interface {
+	Decode() (*journal.Entry, error)
+}
+
+// followStopTimeout is the maximum time to wait for a follower to call
+// its handler with ErrFollowStopped once stopped
+var followStopTimeout = 5 * time.Second
+
+type followSource struct {
+	f journal.Follower
+}
+
+// FollowSource follows f from its current position, or after the cursor
+// checkpointed by the pipeline if f supports seeking, until the pipeline
+// is stopped
+func FollowSource(f journal.Follower) Source {
+	return &followSource{f: f}
+}
+
+func (s *followSource) Run(ctx context.Context, after journal.Cursor, out chan<- *journal.Entry) error {
+
+	skip, err := batch.Seek(s.f, after, true)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs    = make(chan error, 1)
+		mutex   sync.Mutex
+		stopped bool
+	)
+
+	stop, err := s.f.Follow(func(e *journal.Entry, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// out is closed once Run returns
+		if stopped {
+			return
+		}
+
+		if err != nil {
+			select {
+			case errs <- err:
+			default:
+			}
+			return
+		}
+
+		if !skip.IsZero() {
+			c := skip
+			skip = journal.Cursor{}
+			if e.Cursor == c {
+				return
+			}
+		}
+
+		select {
+		case out <- e:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		stop()
+		// Wait for the handler to be done, as long as the follower
+		// keeps to calling it with ErrFollowStopped
+		select {
+		case err = <-errs:
+		case <-time.After(followStopTimeout):
+			err = nil
+		}
+	case err = <-errs:
+		stop()
+	}
+
+	mutex.Lock()
+	stopped = true
+	mutex.Unlock()
+
+	if errors.Is(err, journal.ErrFollowStopped) {
+		return nil
+	}
+
+	return err
+}
+
+type readerSource struct {
+	r journal.Reader
+}
+
+// ReaderSource reads the entries of r, e.g. a Journal, a FileReader or a
+// MergeReader, from its current position, or after the cursor
+// checkpointed by the pipeline if r supports seeking, until there are no
+// more entries
+func ReaderSource(r journal.Reader) Source {
+	return &readerSource{r: r}
+}
+
+func (s *readerSource) Run(ctx context.Context, after journal.Cursor, out chan<- *journal.Entry) error {
+
+	skip, err := batch.Seek(s.r, after, false)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := s.r.Next()
+		if err != nil {
+			return fmt.Errorf("failed to move to next entry: %w", err)
+		}
+
+		if n == 0 {
+			return nil
+		}
+
+		e, err := s.r.ReadEntry()
+		if err != nil {
+			return fmt.Errorf("failed to read entry: %w", err)
+		}
+
+		if !skip.IsZero() {
+			c := skip
+			skip = journal.Cursor{}
+			if e.Cursor == c {
+				continue
+			}
+		}
+
+		select {
+		case out <- e:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+type decoderSource struct {
+	d Decoder
+}
+
+// DecoderSource decodes entries until the end of the input, e.g. a file
+// in the Journal Export Format. Entries up to the cursor checkpointed by
+// the pipeline are skipped.
+func DecoderSource(d Decoder) Source {
+	return &decoderSource{d: d}
+}
+
+func (s *decoderSource) Run(ctx context.Context, after journal.Cursor, out chan<- *journal.Entry) error {
+
+	for {
+		e, err := s.d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		if !after.IsZero() && !e.Cursor.IsZero() {
+			if e.Cursor.Compare(after) <= 0 {
+				continue
+			}
+			after = journal.Cursor{}
+		}
+
+		select {
+		case out <- e:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// +build linux
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// collect runs src and returns the messages of the entries it sends
+// once it has sent n entries or returned
+func collect(t *testing.T, src Source, after journal.Cursor, n int) string {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan *journal.Entry, 100)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- src.Run(ctx, after, out)
+		close(out)
+	}()
+
+	var entries []*journal.Entry
+
+	for len(entries) < n {
+		select {
+		case e, ok := <-out:
+			if !ok {
+				return journaltest.Messages(entries)
+			}
+			entries = append(entries, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d entries", len(entries))
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for source to stop")
+	}
+
+	return journaltest.Messages(entries)
+}
+
+func TestSources(t *testing.T) {
+
+	entries := journaltest.Entries(4)
+
+	var export bytes.Buffer
+	enc := journal.NewExportEncoder(&export)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		src   func() Source
+		after journal.Cursor
+		n     int
+		want  string
+	}{
+		{
+			name: "follow",
+			src: func() Source {
+				return FollowSource(&journaltest.Follower{SliceReader: journaltest.SliceReader{Entries: entries}})
+			},
+			n:    4,
+			want: "1 2 3 4",
+		},
+		{
+			name: "follow after",
+			src: func() Source {
+				return FollowSource(&journaltest.Follower{SliceReader: journaltest.SliceReader{Entries: entries}})
+			},
+			after: entries[1].Cursor,
+			n:     2,
+			want:  "3 4",
+		},
+		{
+			name: "follow ignoring stop",
+			src: func() Source {
+				return FollowSource(&journaltest.Follower{SliceReader: journaltest.SliceReader{Entries: entries}, IgnoreStop: true})
+			},
+			n:    4,
+			want: "1 2 3 4",
+		},
+		{
+			name: "reader",
+			src:  func() Source { return ReaderSource(&journaltest.SliceReader{Entries: entries}) },
+			n:    5,
+			want: "1 2 3 4",
+		},
+		{
+			name:  "reader after",
+			src:   func() Source { return ReaderSource(&journaltest.SliceReader{Entries: entries}) },
+			after: entries[2].Cursor,
+			n:     5,
+			want:  "4",
+		},
+		{
+			name: "decoder",
+			src: func() Source {
+				return DecoderSource(journal.NewExportDecoder(bytes.NewReader(export.Bytes())))
+			},
+			after: entries[0].Cursor,
+			n:     5,
+			want:  "2 3 4",
+		},
+	}
+
+	timeout := followStopTimeout
+	followStopTimeout = 100 * time.Millisecond
+	defer func() { followStopTimeout = timeout }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := collect(t, test.src(), test.after, test.n); got != test.want {
+				t.Errorf("expected entries [%s], got [%s]", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// +build linux
+
+package pipeline
+
+import (
+	"regexp"
+	"sort"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Transform modifies entries between the source and the sinks of a
+// pipeline. Each transform is applied from a goroutine of its own.
+// Entries are owned by the pipeline and may be modified in place.
+type Transform interface {
+	// Apply returns the modified entry, or nil to drop it
+	Apply(e *journal.Entry) *journal.Entry
+}
+
+// TransformFunc is a function used as a Transform
+type TransformFunc func(e *journal.Entry) *journal.Entry
+
+// Apply calls f
+func (f TransformFunc) Apply(e *journal.Entry) *journal.Entry {
+	return f(e)
+}
+
+// Filter keeps the entries keep returns true for and drops the others
+func Filter(keep func(e *journal.Entry) bool) Transform {
+	return TransformFunc(func(e *journal.Entry) *journal.Entry {
+		if !keep(e) {
+			return nil
+		}
+		return e
+	})
+}
+
+// DropFields removes fields from entries
+func DropFields(names ...string) Transform {
+	return TransformFunc(func(e *journal.Entry) *journal.Entry {
+		for _, name := range names {
+			delete(e.Fields, name)
+		}
+		return e
+	})
+}
+
+// RenameFields renames fields of entries, mapping old names to new ones.
+// All fields are renamed at once, so names may be swapped. Existing
+// fields with the new names are replaced. If several fields are renamed
+// to the same name, the one whose old name sorts last is kept.
+func RenameFields(names map[string]string) Transform {
+
+	from := make([]string, 0, len(names))
+	for name := range names {
+		from = append(from, name)
+	}
+	sort.Strings(from)
+
+	return TransformFunc(func(e *journal.Entry) *journal.Entry {
+		var renamed []string
+
+		for _, name := range from {
+			if v, ok := e.Fields[name]; ok {
+				renamed = append(renamed, name, v)
+				delete(e.Fields, name)
+			}
+		}
+
+		for i := 0; i < len(renamed); i += 2 {
+			e.Fields[names[renamed[i]]] = renamed[i+1]
+		}
+
+		return e
+	})
+}
+
+// Redact replaces the matches of re in fields, or in MESSAGE if no
+// fields are given, with replacement. Submatches can be referred to in
+// replacement as with regexp.ReplaceAllString.
+func Redact(re *regexp.Regexp, replacement string, fields ...string) Transform {
+
+	if len(fields) == 0 {
+		fields = []string{journal.FieldMessage}
+	}
+
+	return TransformFunc(func(e *journal.Entry) *journal.Entry {
+		for _, name := range fields {
+			if v, ok := e.Fields[name]; ok {
+				e.Fields[name] = re.ReplaceAllString(v, replacement)
+			}
+		}
+		return e
+	})
+}
+
+// AddFields sets static fields on entries, replacing existing ones
+func AddFields(fields journal.Fields) Transform {
+	return TransformFunc(func(e *journal.Entry) *journal.Entry {
+		if e.Fields == nil {
+			e.Fields = journal.Fields{}
+		}
+		for k, v := range fields {
+			e.Fields[k] = v
+		}
+		return e
+	})
+}
+
+// Sample keeps every nth entry and drops the others. Entries with a
+// priority of at least keep, e.g. journal.PriorityWarning, are always
+// kept.
+func Sample(n int, keep journal.Priority) Transform {
+
+	i := 0
+
+	return TransformFunc(func(e *journal.Entry) *journal.Entry {
+		if p, err := e.Priority(); err == nil && p <= keep {
+			return e
+		}
+
+		i++
+		if n > 1 && i%n != 1 {
+			return nil
+		}
+
+		return e
+	})
+}
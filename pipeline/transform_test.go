@@ -0,0 +1,119 @@
+// +build linux
+
+package pipeline
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+func TestTransforms(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		transform Transform
+		fields    journal.Fields
+		want      journal.Fields
+	}{
+		{
+			name:      "drop fields",
+			transform: DropFields("A", "B"),
+			fields:    journal.Fields{"A": "1", "C": "3"},
+			want:      journal.Fields{"C": "3"},
+		},
+		{
+			name:      "rename fields",
+			transform: RenameFields(map[string]string{"A": "B"}),
+			fields:    journal.Fields{"A": "1", "B": "2"},
+			want:      journal.Fields{"B": "1"},
+		},
+		{
+			name:      "swap fields",
+			transform: RenameFields(map[string]string{"A": "B", "B": "A"}),
+			fields:    journal.Fields{"A": "1", "B": "2", "C": "3"},
+			want:      journal.Fields{"A": "2", "B": "1", "C": "3"},
+		},
+		{
+			name:      "rename chain",
+			transform: RenameFields(map[string]string{"A": "B", "B": "C"}),
+			fields:    journal.Fields{"A": "1", "B": "2"},
+			want:      journal.Fields{"B": "1", "C": "2"},
+		},
+		{
+			name:      "rename collision",
+			transform: RenameFields(map[string]string{"A": "C", "B": "C"}),
+			fields:    journal.Fields{"A": "1", "B": "2"},
+			want:      journal.Fields{"C": "2"},
+		},
+		{
+			name:      "rename missing",
+			transform: RenameFields(map[string]string{"A": "B", "C": "D"}),
+			fields:    journal.Fields{"C": "3"},
+			want:      journal.Fields{"D": "3"},
+		},
+		{
+			name:      "redact message",
+			transform: Redact(regexp.MustCompile(`password=(\S+)`), "password=***"),
+			fields:    journal.Fields{journal.FieldMessage: "login password=secret ok", "A": "password=x"},
+			want:      journal.Fields{journal.FieldMessage: "login password=*** ok", "A": "password=x"},
+		},
+		{
+			name:      "redact fields",
+			transform: Redact(regexp.MustCompile(`(\d+)\.\d+\.\d+\.\d+`), "$1.x.x.x", "ADDR"),
+			fields:    journal.Fields{"ADDR": "10.1.2.3"},
+			want:      journal.Fields{"ADDR": "10.x.x.x"},
+		},
+		{
+			name:      "add fields",
+			transform: AddFields(journal.Fields{"ENV": "prod"}),
+			fields:    journal.Fields{"ENV": "dev", "A": "1"},
+			want:      journal.Fields{"ENV": "prod", "A": "1"},
+		},
+		{
+			name:      "filter",
+			transform: Filter(func(e *journal.Entry) bool { return e.Fields["A"] == "1" }),
+			fields:    journal.Fields{"A": "2"},
+		},
+	}
+
+	for _, test := range tests {
+		e := test.transform.Apply(&journal.Entry{Fields: test.fields})
+
+		if test.want == nil {
+			if e != nil {
+				t.Errorf("%s: expected entry to be dropped, got %v", test.name, e.Fields)
+			}
+			continue
+		}
+
+		if e == nil || !reflect.DeepEqual(e.Fields, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, e)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+
+	s := Sample(3, journal.PriorityWarning)
+
+	var kept []int
+
+	for i := 1; i <= 9; i++ {
+		fields := journal.Fields{}
+		if i == 5 {
+			fields[journal.FieldPriority] = "3"
+		}
+
+		if s.Apply(&journal.Entry{Fields: fields}) != nil {
+			kept = append(kept, i)
+		}
+	}
+
+	// Every third entry along with the error
+	if want := []int{1, 4, 5, 8}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("expected entries %v to be kept, got %v", want, kept)
+	}
+}
@@ -0,0 +1,194 @@
+// +build linux
+
+package journal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Names as used by syslog and journalctl
+var priorityNames = []string{
+	"emerg",
+	"alert",
+	"crit",
+	"err",
+	"warning",
+	"notice",
+	"info",
+	"debug",
+}
+
+var priorityAliases = map[string]Priority{
+	"emergency":     PriorityEmergency,
+	"panic":         PriorityEmergency,
+	"critical":      PriorityCritical,
+	"error":         PriorityError,
+	"warn":          PriorityWarning,
+	"informational": PriorityInfo,
+}
+
+// ParsePriority parses a priority given as a number or a name. Names are
+// case-insensitive and may be given as used by syslog and journalctl
+// ("err", "warning") or spelled out ("error", "Warning").
+func ParsePriority(s string) (Priority, error) {
+
+	name := strings.ToLower(strings.TrimSpace(s))
+
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < int(PriorityEmergency) || n > int(PriorityDebug) {
+			return 0, fmt.Errorf("priority %d out of range", n)
+		}
+		return Priority(n), nil
+	}
+
+	for i, n := range priorityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+
+	if p, ok := priorityAliases[name]; ok {
+		return p, nil
+	}
+
+	return 0, fmt.Errorf("unknown priority '%s'", s)
+}
+
+// MarshalText implements encoding.TextMarshaler. Priorities are
+// marshaled by their syslog name ("err") rather than by String
+// ("Error"). UnmarshalText accepts both.
+func (p Priority) MarshalText() ([]byte, error) {
+
+	if p < PriorityEmergency || p > PriorityDebug {
+		return nil, fmt.Errorf("priority %d out of range", int(p))
+	}
+
+	return []byte(priorityNames[p]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (p *Priority) UnmarshalText(text []byte) error {
+
+	v, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+
+	*p = v
+
+	return nil
+}
+
+// Facility is a type to describe the syslog facility of a log entry
+type Facility int
+
+// Facility constants
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityNTP
+	FacilitySecurity
+	FacilityConsole
+	FacilitySolarisCron
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+var facilityNames = []string{
+	"kern",
+	"user",
+	"mail",
+	"daemon",
+	"auth",
+	"syslog",
+	"lpr",
+	"news",
+	"uucp",
+	"cron",
+	"authpriv",
+	"ftp",
+	"ntp",
+	"security",
+	"console",
+	"solaris-cron",
+	"local0",
+	"local1",
+	"local2",
+	"local3",
+	"local4",
+	"local5",
+	"local6",
+	"local7",
+}
+
+func (f Facility) String() string {
+
+	if f < FacilityKern || f > FacilityLocal7 {
+		return "Facility(" + strconv.Itoa(int(f)) + ")"
+	}
+
+	return facilityNames[f]
+}
+
+// ParseFacility parses a facility given as a number or a
+// case-insensitive name such as "daemon" or "local3"
+func ParseFacility(s string) (Facility, error) {
+
+	name := strings.ToLower(strings.TrimSpace(s))
+
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < int(FacilityKern) || n > int(FacilityLocal7) {
+			return 0, fmt.Errorf("facility %d out of range", n)
+		}
+		return Facility(n), nil
+	}
+
+	for i, n := range facilityNames {
+		if n == name {
+			return Facility(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown facility '%s'", s)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (f Facility) MarshalText() ([]byte, error) {
+
+	if f < FacilityKern || f > FacilityLocal7 {
+		return nil, fmt.Errorf("facility %d out of range", int(f))
+	}
+
+	return []byte(facilityNames[f]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (f *Facility) UnmarshalText(text []byte) error {
+
+	v, err := ParseFacility(string(text))
+	if err != nil {
+		return err
+	}
+
+	*f = v
+
+	return nil
+}
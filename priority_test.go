@@ -0,0 +1,160 @@
+// +build linux
+
+package journal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePriority(t *testing.T) {
+
+	tests := []struct {
+		s        string
+		expected Priority
+		valid    bool
+	}{
+		{"0", PriorityEmergency, true},
+		{"7", PriorityDebug, true},
+		{" 3 ", PriorityError, true},
+		{"emerg", PriorityEmergency, true},
+		{"err", PriorityError, true},
+		{"ERR", PriorityError, true},
+		{"warning", PriorityWarning, true},
+		{"warn", PriorityWarning, true},
+		{"panic", PriorityEmergency, true},
+		{"informational", PriorityInfo, true},
+		{"-1", 0, false},
+		{"8", 0, false},
+		{"", 0, false},
+		{"verbose", 0, false},
+	}
+
+	for _, test := range tests {
+		p, err := ParsePriority(test.s)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%q: expected valid %v, got error %v", test.s, test.valid, err)
+			continue
+		}
+		if p != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.s, test.expected, p)
+		}
+	}
+
+	// Every String and MarshalText form parses back
+	for p := PriorityEmergency; p <= PriorityDebug; p++ {
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range []string{p.String(), string(text)} {
+			if v, err := ParsePriority(s); err != nil || v != p {
+				t.Errorf("%q: expected %v, got %v (%v)", s, p, v, err)
+			}
+		}
+	}
+}
+
+func TestPriorityText(t *testing.T) {
+
+	tests := []struct {
+		p     Priority
+		text  string
+		str   string
+		valid bool
+	}{
+		{PriorityEmergency, "emerg", "Emergency", true},
+		{PriorityCritical, "crit", "Critical", true},
+		{PriorityError, "err", "Error", true},
+		{PriorityDebug, "debug", "Debug", true},
+		{Priority(8), "", "Priority(8)", false},
+		{Priority(-1), "", "Priority(-1)", false},
+	}
+
+	for _, test := range tests {
+		if s := test.p.String(); s != test.str {
+			t.Errorf("%d: expected String %s, got %s", int(test.p), test.str, s)
+		}
+
+		text, err := test.p.MarshalText()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%d: expected valid %v, got error %v", int(test.p), test.valid, err)
+			continue
+		}
+		if string(text) != test.text {
+			t.Errorf("%d: expected text %s, got %s", int(test.p), test.text, text)
+		}
+	}
+
+	var v struct {
+		Priority Priority
+	}
+
+	if err := json.Unmarshal([]byte(`{"Priority":"Error"}`), &v); err != nil || v.Priority != PriorityError {
+		t.Errorf("expected %v, got %v (%v)", PriorityError, v.Priority, err)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"Priority":"err"}`; string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
+
+func TestParseFacility(t *testing.T) {
+
+	tests := []struct {
+		s        string
+		expected Facility
+		valid    bool
+	}{
+		{"0", FacilityKern, true},
+		{"23", FacilityLocal7, true},
+		{"daemon", FacilityDaemon, true},
+		{"LOCAL3", FacilityLocal3, true},
+		{"solaris-cron", FacilitySolarisCron, true},
+		{"24", 0, false},
+		{"-1", 0, false},
+		{"local8", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		f, err := ParseFacility(test.s)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%q: expected valid %v, got error %v", test.s, test.valid, err)
+			continue
+		}
+		if f != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.s, test.expected, f)
+		}
+	}
+}
+
+func TestFacilityText(t *testing.T) {
+
+	for f := FacilityKern; f <= FacilityLocal7; f++ {
+		text, err := f.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(text) != f.String() {
+			t.Errorf("%d: expected text %s, got %s", int(f), f.String(), text)
+		}
+
+		var v Facility
+		if err := v.UnmarshalText(text); err != nil || v != f {
+			t.Errorf("%s: expected %v, got %v (%v)", text, f, v, err)
+		}
+	}
+
+	if _, err := Facility(24).MarshalText(); err == nil {
+		t.Error("expected error")
+	}
+	if s := Facility(24).String(); s != "Facility(24)" {
+		t.Errorf("expected Facility(24), got %s", s)
+	}
+}
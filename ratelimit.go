@@ -0,0 +1,250 @@
+// +build linux
+
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MessageIDSuppressed is the MESSAGE_ID of summary entries written by a
+// RateLimiter for messages it suppressed.
+const MessageIDSuppressed ID128 = "a6cee396c40746ee994a274336caced5"
+
+var (
+	// ErrRateLimited is returned when an entry is suppressed by a RateLimiter.
+	ErrRateLimited = errors.New("journal: entry suppressed by rate limit")
+)
+
+// KeyFunc returns the key used to group entries when rate limiting
+type KeyFunc func(p Priority, m string, f Fields) string
+
+// KeyByIdentifier groups entries by SYSLOG_IDENTIFIER
+func KeyByIdentifier(p Priority, m string, f Fields) string {
+	return f[FieldSyslogIdentifier]
+}
+
+// KeyByMessageID groups entries by MESSAGE_ID
+func KeyByMessageID(p Priority, m string, f Fields) string {
+	return f[FieldMessageID]
+}
+
+// RateLimitConfig configures a RateLimiter
+type RateLimitConfig struct {
+	// Rate is the number of entries per second allowed for each key.
+	// Zero disables rate limiting.
+	Rate float64
+	// Burst is the number of entries allowed for a key at once.
+	// Defaults to 1.
+	Burst int
+	// Key groups entries for rate limiting. Defaults to KeyByIdentifier.
+	Key KeyFunc
+	// DuplicateWindow collapses entries with the same key, priority and
+	// message submitted within this duration of the first one.
+	// Zero disables duplicate suppression.
+	DuplicateWindow time.Duration
+	// Submitter receives entries that are not suppressed.
+	// Defaults to the journal.
+	Submitter Submitter
+}
+
+type rateBucket struct {
+	tokens     float64
+	refilled   time.Time
+	suppressed uint64
+
+	message    string
+	priority   Priority
+	firstSeen  time.Time
+	duplicates uint64
+}
+
+// RateLimiter suppresses entries on the sender side before they reach
+// the journal. Entries are grouped by key and limited using a token
+// bucket per key. Identical entries may also be collapsed. Whenever
+// entries have been suppressed for a key, a summary entry with
+// MESSAGE_ID set to MessageIDSuppressed is submitted before the next
+// entry for that key, or when Flush is called. Suppressed entries stay
+// accounted for until their summary is submitted.
+type RateLimiter struct {
+	cfg     RateLimitConfig
+	buckets map[string]*rateBucket
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+// NewRateLimiter creates a new RateLimiter
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	if cfg.Key == nil {
+		cfg.Key = KeyByIdentifier
+	}
+	if cfg.Submitter == nil {
+		cfg.Submitter = journalSubmitter{}
+	}
+
+	return &RateLimiter{
+		cfg:     cfg,
+		buckets: map[string]*rateBucket{},
+		now:     time.Now,
+	}
+}
+
+// Submit submits a new entry unless it is suppressed
+func (r *RateLimiter) Submit(p Priority, m string) error {
+	return r.SubmitWithFields(p, m, Fields{})
+}
+
+// SubmitWithFields submits a new entry with optional fields unless it
+// is suppressed. ErrRateLimited is returned for suppressed entries. If a
+// pending summary fails to be submitted, its error is returned and the
+// entry is not submitted.
+func (r *RateLimiter) SubmitWithFields(p Priority, m string, f Fields) error {
+
+	if f == nil {
+		f = Fields{}
+	}
+
+	key := r.cfg.Key(p, m, f)
+
+	r.mutex.Lock()
+	ok, err := r.admit(key, p, m, r.now())
+	r.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrRateLimited
+	}
+
+	return r.cfg.Submitter.SubmitWithFields(p, m, f)
+}
+
+// Flush submits summaries for all keys with suppressed entries and
+// forgets keys that are idle. Call Flush periodically and before exiting
+// so suppressed entries are accounted for.
+func (r *RateLimiter) Flush() error {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+
+	for key, b := range r.buckets {
+		if err := r.submitSummaries(key, b); err != nil {
+			return err
+		}
+
+		r.refill(b, now)
+		if b.tokens >= float64(r.cfg.Burst) &&
+			(r.cfg.DuplicateWindow == 0 || now.Sub(b.firstSeen) >= r.cfg.DuplicateWindow) {
+			delete(r.buckets, key)
+		}
+	}
+
+	return nil
+}
+
+// admit decides if an entry may be submitted, submitting the pending
+// summaries of its key first. No token is used if they fail to be
+// submitted. The mutex must be held.
+func (r *RateLimiter) admit(key string, p Priority, m string, now time.Time) (bool, error) {
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &rateBucket{
+			tokens:   float64(r.cfg.Burst),
+			refilled: now,
+		}
+		r.buckets[key] = b
+	}
+
+	if r.cfg.DuplicateWindow > 0 {
+		if b.message == m && b.priority == p && now.Sub(b.firstSeen) < r.cfg.DuplicateWindow {
+			b.duplicates++
+			return false, nil
+		}
+	}
+
+	if r.cfg.Rate > 0 {
+		r.refill(b, now)
+		if b.tokens < 1 {
+			b.suppressed++
+			return false, nil
+		}
+	}
+
+	if err := r.submitSummaries(key, b); err != nil {
+		return false, err
+	}
+
+	if r.cfg.Rate > 0 {
+		b.tokens--
+	}
+
+	b.message = m
+	b.priority = p
+	b.firstSeen = now
+
+	return true, nil
+}
+
+func (r *RateLimiter) refill(b *rateBucket, now time.Time) {
+
+	if r.cfg.Rate <= 0 {
+		b.tokens = float64(r.cfg.Burst)
+		return
+	}
+
+	b.tokens += now.Sub(b.refilled).Seconds() * r.cfg.Rate
+	if b.tokens > float64(r.cfg.Burst) {
+		b.tokens = float64(r.cfg.Burst)
+	}
+	b.refilled = now
+}
+
+// submitSummaries submits summaries of the entries suppressed for key,
+// resetting each counter once its summary is submitted. The mutex must
+// be held.
+func (r *RateLimiter) submitSummaries(key string, b *rateBucket) error {
+
+	if b.duplicates > 0 {
+		msg := fmt.Sprintf("Suppressed %d repetitions of message: %s", b.duplicates, b.message)
+		if err := r.submitSummary(key, b.duplicates, msg); err != nil {
+			return err
+		}
+		b.duplicates = 0
+	}
+
+	if b.suppressed > 0 {
+		msg := fmt.Sprintf("Suppressed %d similar messages", b.suppressed)
+		if err := r.submitSummary(key, b.suppressed, msg); err != nil {
+			return err
+		}
+		b.suppressed = 0
+	}
+
+	return nil
+}
+
+func (r *RateLimiter) submitSummary(key string, count uint64, msg string) error {
+
+	err := r.cfg.Submitter.SubmitWithFields(PriorityWarning, msg, Fields{
+		FieldMessageID:   MessageIDSuppressed.String(),
+		"N_SUPPRESSED":   strconv.FormatUint(count, 10),
+		"SUPPRESSED_KEY": key,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to submit suppression summary: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+// +build linux
+
+package journal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type submitted struct {
+	p Priority
+	m string
+	f Fields
+}
+
+// recordSubmitter records submitted entries, failing while err is set
+type recordSubmitter struct {
+	entries []submitted
+	err     error
+}
+
+func (r *recordSubmitter) Submit(p Priority, m string) error {
+	return r.SubmitWithFields(p, m, nil)
+}
+
+func (r *recordSubmitter) SubmitWithFields(p Priority, m string, f Fields) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.entries = append(r.entries, submitted{p, m, f})
+	return nil
+}
+
+func (r *recordSubmitter) messages() string {
+	var m []string
+	for _, e := range r.entries {
+		m = append(m, e.m)
+	}
+	return strings.Join(m, "|")
+}
+
+type nopSubmitter struct{}
+
+func (nopSubmitter) Submit(p Priority, m string) error { return nil }
+
+func (nopSubmitter) SubmitWithFields(p Priority, m string, f Fields) error { return nil }
+
+// testRateLimiter returns a RateLimiter using a clock that is advanced
+// by calling the returned function
+func testRateLimiter(cfg RateLimitConfig) (*RateLimiter, func(d time.Duration)) {
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := NewRateLimiter(cfg)
+	r.now = func() time.Time { return now }
+
+	return r, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		steps    []time.Duration
+		expected []bool
+	}{
+		{"burst", 1, 3, []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}},
+		{"refill", 2, 1, []time.Duration{0, 0, 250 * time.Millisecond, 250 * time.Millisecond}, []bool{true, false, false, true}},
+		{"capped", 1, 2, []time.Duration{0, time.Hour, 0, 0, 0}, []bool{true, true, true, false, false}},
+		{"unlimited", 0, 1, []time.Duration{0, 0, 0}, []bool{true, true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &recordSubmitter{}
+			r, advance := testRateLimiter(RateLimitConfig{
+				Rate:      test.rate,
+				Burst:     test.burst,
+				Submitter: s,
+			})
+
+			for i, d := range test.steps {
+				advance(d)
+
+				err := r.Submit(PriorityInfo, "message "+string(rune('a'+i)))
+				if ok := err == nil; ok != test.expected[i] {
+					t.Fatalf("entry %d: expected admitted %v, got error %v", i, test.expected[i], err)
+				}
+				if err != nil && err != ErrRateLimited {
+					t.Fatalf("entry %d: unexpected error %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterDuplicates(t *testing.T) {
+
+	s := &recordSubmitter{}
+	r, advance := testRateLimiter(RateLimitConfig{
+		DuplicateWindow: time.Second,
+		Submitter:       s,
+	})
+
+	r.Submit(PriorityInfo, "a")
+	for i := 0; i < 3; i++ {
+		if err := r.Submit(PriorityInfo, "a"); err != ErrRateLimited {
+			t.Fatalf("expected duplicate to be suppressed, got %v", err)
+		}
+	}
+
+	// A different priority isn't a duplicate
+	r.Submit(PriorityError, "a")
+
+	advance(time.Second)
+	r.Submit(PriorityError, "a")
+
+	expected := "a|Suppressed 3 repetitions of message: a|a|a"
+	if s.messages() != expected {
+		t.Errorf("expected %q, got %q", expected, s.messages())
+	}
+}
+
+func TestRateLimiterSummary(t *testing.T) {
+
+	s := &recordSubmitter{}
+	r, advance := testRateLimiter(RateLimitConfig{
+		Rate:            1,
+		DuplicateWindow: time.Minute,
+		Submitter:       s,
+	})
+
+	f := Fields{FieldSyslogIdentifier: "app"}
+
+	r.SubmitWithFields(PriorityInfo, "a", f)
+	r.SubmitWithFields(PriorityInfo, "a", f)
+	r.SubmitWithFields(PriorityInfo, "a", f)
+	r.SubmitWithFields(PriorityInfo, "b", f)
+
+	advance(time.Second)
+	if err := r.SubmitWithFields(PriorityInfo, "c", f); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []submitted{
+		{PriorityInfo, "a", f},
+		{PriorityWarning, "Suppressed 2 repetitions of message: a", Fields{
+			FieldMessageID:   MessageIDSuppressed.String(),
+			"N_SUPPRESSED":   "2",
+			"SUPPRESSED_KEY": "app",
+		}},
+		{PriorityWarning, "Suppressed 1 similar messages", Fields{
+			FieldMessageID:   MessageIDSuppressed.String(),
+			"N_SUPPRESSED":   "1",
+			"SUPPRESSED_KEY": "app",
+		}},
+		{PriorityInfo, "c", f},
+	}
+
+	if len(s.entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %q", len(expected), s.messages())
+	}
+
+	for i, e := range expected {
+		got := s.entries[i]
+		if got.p != e.p || got.m != e.m || len(got.f) != len(e.f) {
+			t.Errorf("entry %d: expected %+v, got %+v", i, e, got)
+			continue
+		}
+		for k, v := range e.f {
+			if got.f[k] != v {
+				t.Errorf("entry %d: expected %s=%s, got %s", i, k, v, got.f[k])
+			}
+		}
+	}
+}
+
+func TestRateLimiterFlush(t *testing.T) {
+
+	s := &recordSubmitter{}
+	r, advance := testRateLimiter(RateLimitConfig{
+		Rate:      1,
+		Submitter: s,
+	})
+
+	r.Submit(PriorityInfo, "a")
+	r.Submit(PriorityInfo, "b")
+	r.Submit(PriorityInfo, "c")
+
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "a|Suppressed 2 similar messages"
+	if s.messages() != expected {
+		t.Errorf("expected %q, got %q", expected, s.messages())
+	}
+
+	// Nothing left to summarize
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.messages() != expected {
+		t.Errorf("expected %q, got %q", expected, s.messages())
+	}
+
+	// Idle keys are forgotten once their bucket is full
+	if len(r.buckets) != 1 {
+		t.Errorf("expected 1 bucket, got %d", len(r.buckets))
+	}
+	advance(time.Second)
+	r.Flush()
+	if len(r.buckets) != 0 {
+		t.Errorf("expected no buckets, got %d", len(r.buckets))
+	}
+}
+
+func TestRateLimiterSummaryError(t *testing.T) {
+
+	s := &recordSubmitter{}
+	r, advance := testRateLimiter(RateLimitConfig{
+		Rate:      1,
+		Submitter: s,
+	})
+
+	r.Submit(PriorityInfo, "a")
+	r.Submit(PriorityInfo, "b")
+
+	advance(time.Second)
+	failed := errors.New("failed")
+	s.err = failed
+
+	if err := r.Submit(PriorityInfo, "c"); !errors.Is(err, failed) {
+		t.Fatalf("expected summary error, got %v", err)
+	}
+	if err := r.Flush(); !errors.Is(err, failed) {
+		t.Fatalf("expected summary error, got %v", err)
+	}
+
+	// Neither the token nor the suppressed count were lost
+	s.err = nil
+	if err := r.Submit(PriorityInfo, "d"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "a|Suppressed 1 similar messages|d"
+	if s.messages() != expected {
+		t.Errorf("expected %q, got %q", expected, s.messages())
+	}
+}
+
+func BenchmarkRateLimiter(b *testing.B) {
+
+	r := NewRateLimiter(RateLimitConfig{
+		Rate:            1000,
+		Burst:           100,
+		DuplicateWindow: time.Second,
+		Submitter:       nopSubmitter{},
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r.Submit(PriorityInfo, "message")
+	}
+}
@@ -0,0 +1,316 @@
+// +build linux
+
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Number of entries passed to the sink at once
+const receiveBatchSize = 100
+
+var (
+	errUploadTooLarge = errors.New("upload too large")
+	errQuotaExceeded  = errors.New("source quota exceeded")
+)
+
+// Sink receives the entries uploaded to a Receiver
+type Sink interface {
+	// Write writes entries uploaded by source, in the order uploaded
+	Write(source string, entries []*journal.Entry) error
+}
+
+// ReceiverConfig configures a Receiver
+type ReceiverConfig struct {
+	// Sink receives the uploaded entries
+	Sink Sink
+	// MaxUploadSize is the maximum size in bytes of the body of a single
+	// upload request. It applies per request, see SourceQuota for the
+	// total uploaded by a source over several requests. Zero means no
+	// limit.
+	MaxUploadSize int64
+	// MaxEntrySize is the maximum size in bytes of an uploaded entry.
+	// Defaults to 64 MiB. Uploads exceeding either limit are rejected
+	// with 413 Request Entity Too Large.
+	MaxEntrySize int64
+	// SourceQuota is the number of bytes each source may upload in total
+	// over all its requests. Once used up, uploads from the source are
+	// rejected with 413 Request Entity Too Large. Zero means no limit.
+	SourceQuota int64
+	// SourceQuotaInterval is the interval at which the quota of each
+	// source is renewed. Zero means never.
+	SourceQuotaInterval time.Duration
+	// Source returns the name of the source of an upload, which must
+	// be usable in a file name. Defaults to the common name of the client
+	// certificate or else the address of the client.
+	Source func(r *http.Request) string
+}
+
+// Receiver is an http.Handler accepting uploads in the Journal Export
+// Format on /upload, as sent by systemd-journal-upload and Uploader.
+// Each source may only upload once at a time, so its entries are
+// written to the sink in order.
+type Receiver struct {
+	cfg       ReceiverConfig
+	uploading map[string]bool
+	usage     map[string]*sourceUsage
+	mutex     sync.Mutex
+}
+
+// sourceUsage is the number of bytes uploaded by a source since the
+// quota was last renewed
+type sourceUsage struct {
+	bytes   int64
+	renewed time.Time
+}
+
+// NewReceiver creates a Receiver
+func NewReceiver(cfg ReceiverConfig) (*Receiver, error) {
+
+	if cfg.Sink == nil {
+		return nil, errors.New("a sink must be provided")
+	}
+	if cfg.Source == nil {
+		cfg.Source = requestSource
+	}
+
+	return &Receiver{
+		cfg:       cfg,
+		uploading: map[string]bool{},
+		usage:     map[string]*sourceUsage{},
+	}, nil
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Path != "/upload" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != journal.ExportContentType {
+		http.Error(w, fmt.Sprintf("Content-Type: %s is required.", journal.ExportContentType),
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	source := rc.cfg.Source(r)
+	if source == "" {
+		http.Error(w, "Unknown source.", http.StatusForbidden)
+		return
+	}
+
+	quota, ok := rc.begin(source)
+	if !ok {
+		http.Error(w, "Upload from this source already in progress.", http.StatusConflict)
+		return
+	}
+
+	counter := &countReader{r: r.Body}
+	defer func() {
+		rc.end(source, counter.n)
+	}()
+
+	var body io.Reader = counter
+	if rc.cfg.MaxUploadSize > 0 {
+		if r.ContentLength > rc.cfg.MaxUploadSize {
+			http.Error(w, "Upload too large.", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = &limitReader{r: body, n: rc.cfg.MaxUploadSize, err: errUploadTooLarge}
+	}
+	if rc.cfg.SourceQuota > 0 {
+		if quota <= 0 || r.ContentLength > quota {
+			http.Error(w, "Source quota exceeded.", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = &limitReader{r: body, n: quota, err: errQuotaExceeded}
+	}
+
+	status, err := rc.receive(source, body)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "OK.\n")
+}
+
+// receive decodes an upload and writes its entries to the sink. The
+// status to reply with is returned along with any error.
+func (rc *Receiver) receive(source string, body io.Reader) (int, error) {
+
+	dec := journal.NewExportDecoder(body)
+	if rc.cfg.MaxEntrySize > 0 {
+		dec.SetMaxEntrySize(rc.cfg.MaxEntrySize)
+	}
+
+	batch := make([]*journal.Entry, 0, receiveBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := rc.cfg.Sink.Write(source, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		e, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Keep what was received in good order
+			if ferr := flush(); ferr != nil {
+				return http.StatusInternalServerError, ferr
+			}
+			if errors.Is(err, errUploadTooLarge) {
+				return http.StatusRequestEntityTooLarge, errUploadTooLarge
+			}
+			if errors.Is(err, errQuotaExceeded) {
+				return http.StatusRequestEntityTooLarge, errQuotaExceeded
+			}
+			var serr *journal.ExportSizeError
+			if errors.As(err, &serr) {
+				return http.StatusRequestEntityTooLarge, err
+			}
+			return http.StatusBadRequest, err
+		}
+
+		if len(e.Fields) == 0 {
+			if err := flush(); err != nil {
+				return http.StatusInternalServerError, err
+			}
+			return http.StatusBadRequest, fmt.Errorf("%w: entry without fields", journal.ErrInvalidExport)
+		}
+
+		batch = append(batch, e)
+		if len(batch) >= receiveBatchSize {
+			if err := flush(); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusAccepted, nil
+}
+
+// begin marks source as uploading and returns the number of bytes left
+// of its quota, unless it is already uploading
+func (rc *Receiver) begin(source string) (int64, bool) {
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if rc.uploading[source] {
+		return 0, false
+	}
+
+	rc.uploading[source] = true
+
+	if rc.cfg.SourceQuota <= 0 {
+		return 0, true
+	}
+
+	u, ok := rc.usage[source]
+	if !ok || rc.cfg.SourceQuotaInterval > 0 && time.Since(u.renewed) >= rc.cfg.SourceQuotaInterval {
+		u = &sourceUsage{renewed: time.Now()}
+		rc.usage[source] = u
+	}
+
+	return rc.cfg.SourceQuota - u.bytes, true
+}
+
+// end marks source as no longer uploading and charges its quota the
+// number of bytes read
+func (rc *Receiver) end(source string, n int64) {
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	delete(rc.uploading, source)
+
+	if u, ok := rc.usage[source]; ok {
+		u.bytes += n
+	}
+}
+
+// requestSource returns the common name of the client certificate or
+// else the host of the client address
+func requestSource(r *http.Request) string {
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if cn := r.TLS.PeerCertificates[0].Subject.CommonName; cn != "" {
+			return sanitizeSource(cn)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return sanitizeSource(host)
+}
+
+// limitReader fails with err once more than n bytes are read
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+
+	if l.n < 0 {
+		return 0, l.err
+	}
+
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+
+	if l.n < 0 {
+		return n, l.err
+	}
+
+	return n, err
+}
+
+// countReader counts the bytes read
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,276 @@
+// +build linux
+
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// memSink is a Sink keeping the messages written per source
+type memSink struct {
+	messages map[string][]string
+	mutex    sync.Mutex
+}
+
+func (s *memSink) Write(source string, entries []*journal.Entry) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range entries {
+		s.messages[source] = append(s.messages[source], e.Fields[journal.FieldMessage])
+	}
+
+	return nil
+}
+
+// discardSink is a Sink dropping all entries
+type discardSink struct{}
+
+func (discardSink) Write(string, []*journal.Entry) error { return nil }
+
+// binaryField returns a field in the binary form of the export format
+func binaryField(name string, size int) string {
+
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], uint64(size))
+
+	return name + "\n" + string(n[:]) + strings.Repeat("x", size) + "\n"
+}
+
+func TestReceiver(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		// Send the body without a Content-Length
+		chunked bool
+		// Maximum entry size, defaults to 1000
+		maxEntry int64
+		status   int
+		messages []string
+	}{
+		{
+			name:     "accepted",
+			body:     "MESSAGE=one\n\nMESSAGE=two\n\n",
+			status:   http.StatusAccepted,
+			messages: []string{"one", "two"},
+		},
+		{
+			name:   "method",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "content type",
+			contentType: "application/json",
+			body:        "MESSAGE=one\n\n",
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "malformed",
+			body:     "MESSAGE=one\n\n=two\n\n",
+			status:   http.StatusBadRequest,
+			messages: []string{"one"},
+		},
+		{
+			name:   "content length too large",
+			body:   "MESSAGE=" + strings.Repeat("x", 300) + "\n\n",
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "upload too large",
+			body:     "MESSAGE=one\n\nMESSAGE=" + strings.Repeat("x", 300) + "\n\n",
+			chunked:  true,
+			status:   http.StatusRequestEntityTooLarge,
+			messages: []string{"one"},
+		},
+		{
+			name:     "upload too large in binary field",
+			body:     "MESSAGE=one\n\n" + binaryField("DATA", 300) + "\n",
+			chunked:  true,
+			status:   http.StatusRequestEntityTooLarge,
+			messages: []string{"one"},
+		},
+		{
+			name:     "entry too large",
+			body:     "MESSAGE=one\n\n" + binaryField("DATA", 50) + binaryField("MORE", 50) + "\n",
+			maxEntry: 100,
+			status:   http.StatusRequestEntityTooLarge,
+			messages: []string{"one"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &memSink{messages: map[string][]string{}}
+
+			maxEntry := test.maxEntry
+			if maxEntry == 0 {
+				maxEntry = 1000
+			}
+
+			rc, err := NewReceiver(ReceiverConfig{
+				Sink:          sink,
+				MaxUploadSize: 256,
+				MaxEntrySize:  maxEntry,
+				Source:        func(*http.Request) string { return "test" },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			method := test.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			var body io.Reader = strings.NewReader(test.body)
+			if test.chunked {
+				body = struct{ io.Reader }{body}
+			}
+
+			req := httptest.NewRequest(method, "/upload", body)
+			if test.chunked {
+				req.ContentLength = -1
+			}
+
+			contentType := test.contentType
+			if contentType == "" {
+				contentType = journal.ExportContentType
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			w := httptest.NewRecorder()
+			rc.ServeHTTP(w, req)
+
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+
+			if got := fmt.Sprint(sink.messages["test"]); got != fmt.Sprint(test.messages) {
+				t.Errorf("expected messages %v written, got %s", test.messages, got)
+			}
+		})
+	}
+}
+
+func BenchmarkReceiver(b *testing.B) {
+
+	var buf bytes.Buffer
+
+	enc := journal.NewExportEncoder(&buf)
+	for _, e := range journaltest.Entries(100) {
+		if err := enc.Encode(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	rc, err := NewReceiver(ReceiverConfig{
+		Sink:   discardSink{},
+		Source: func(*http.Request) string { return "test" },
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(buf.Bytes()))
+		req.Header.Set("Content-Type", journal.ExportContentType)
+
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, req)
+
+		if w.Code != http.StatusAccepted {
+			b.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
+
+func TestReceiverSourceQuota(t *testing.T) {
+
+	sink := &memSink{messages: map[string][]string{}}
+
+	rc, err := NewReceiver(ReceiverConfig{
+		Sink:        sink,
+		SourceQuota: 40,
+		Source: func(r *http.Request) string {
+			return r.Header.Get("X-Source")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(source, body string, chunked bool) int {
+		var r io.Reader = strings.NewReader(body)
+		if chunked {
+			r = struct{ io.Reader }{r}
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/upload", r)
+		if chunked {
+			req.ContentLength = -1
+		}
+		req.Header.Set("Content-Type", journal.ExportContentType)
+		req.Header.Set("X-Source", source)
+
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	tests := []struct {
+		source  string
+		body    string
+		chunked bool
+		status  int
+	}{
+		// 15 bytes each
+		{"a", "MESSAGE=one\n\n\n\n", false, http.StatusAccepted},
+		{"a", "MESSAGE=two\n\n\n\n", true, http.StatusAccepted},
+		// 10 bytes left of the quota
+		{"a", "MESSAGE=three\n\n", false, http.StatusRequestEntityTooLarge},
+		{"a", "MESSAGE=four\n\n", true, http.StatusRequestEntityTooLarge},
+		// Other sources have their own quota
+		{"b", "MESSAGE=five\n\n", false, http.StatusAccepted},
+		// The quota is used up
+		{"a", "", false, http.StatusRequestEntityTooLarge},
+	}
+
+	for i, test := range tests {
+		if status := upload(test.source, test.body, test.chunked); status != test.status {
+			t.Errorf("upload %d: expected status %d, got %d", i, test.status, status)
+		}
+	}
+
+	if got := fmt.Sprint(sink.messages); got != "map[a:[one two] b:[five]]" {
+		t.Errorf("unexpected messages written %s", got)
+	}
+
+	// The quota is renewed after the interval
+	rc.cfg.SourceQuotaInterval = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+
+	if status := upload("a", "MESSAGE=six\n\n", false); status != http.StatusAccepted {
+		t.Errorf("expected status %d after renewal, got %d", http.StatusAccepted, status)
+	}
+}
@@ -0,0 +1,147 @@
+// +build linux
+
+package remote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// FileFormat is the format entries are written to files in
+type FileFormat int
+
+// FileFormat constants
+const (
+	// FormatExport writes entries in the Journal Export Format
+	FormatExport FileFormat = iota
+	// FormatJSON writes entries as JSON, one entry per line
+	FormatJSON
+)
+
+type entryEncoder interface {
+	Encode(e *journal.Entry) error
+}
+
+type sinkFile struct {
+	f   *os.File
+	enc entryEncoder
+}
+
+// FileSink is a Sink appending the entries of each source to a file of
+// its own in a directory, named remote-SOURCE.export or remote-SOURCE.json.
+// Files in the Journal Export Format can be imported into journal files
+// using systemd-journal-remote.
+type FileSink struct {
+	dir    string
+	format FileFormat
+	files  map[string]*sinkFile
+	mutex  sync.Mutex
+}
+
+// NewFileSink creates a FileSink writing files to dir, which is created
+// if missing
+func NewFileSink(dir string, format FileFormat) (*FileSink, error) {
+
+	if format != FormatExport && format != FormatJSON {
+		return nil, fmt.Errorf("unsupported file format %d", format)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sink directory: %w", err)
+	}
+
+	return &FileSink{
+		dir:    dir,
+		format: format,
+		files:  map[string]*sinkFile{},
+	}, nil
+}
+
+// Write appends entries to the file of source
+func (s *FileSink) Write(source string, entries []*journal.Entry) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sf, err := s.file(source)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := sf.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes all files
+func (s *FileSink) Close() error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var first error
+
+	for source, sf := range s.files {
+		if err := sf.f.Close(); err != nil && first == nil {
+			first = fmt.Errorf("failed to close sink file: %w", err)
+		}
+		delete(s.files, source)
+	}
+
+	return first
+}
+
+// file returns the open file of source, opening it if needed.
+// NOTE: The caller must hold the mutex.
+func (s *FileSink) file(source string) (*sinkFile, error) {
+
+	if sf, ok := s.files[source]; ok {
+		return sf, nil
+	}
+
+	ext := ".export"
+	if s.format == FormatJSON {
+		ext = ".json"
+	}
+
+	path := filepath.Join(s.dir, "remote-"+sanitizeSource(source)+ext)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sink file: %w", err)
+	}
+
+	sf := &sinkFile{f: f}
+	if s.format == FormatJSON {
+		sf.enc = journal.NewJSONEncoder(f)
+	} else {
+		sf.enc = journal.NewExportEncoder(f)
+	}
+
+	s.files[source] = sf
+
+	return sf, nil
+}
+
+// sanitizeSource makes a source name safe to use in a file name
+func sanitizeSource(source string) string {
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, source)
+}
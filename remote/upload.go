@@ -0,0 +1,231 @@
+// +build linux
+
+// Package remote uploads journal entries to, and receives them from,
+// systemd-journal-remote compatible services.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/retry"
+)
+
+// UploaderConfig configures an Uploader
+type UploaderConfig struct {
+	// URL of the systemd-journal-remote service, e.g.
+	// "https://logs.example.com:19532". Entries are posted to
+	// /upload unless the URL has another path.
+	URL string
+	// CertFile and KeyFile are the PEM encoded client certificate and
+	// key presented to the server. Both must be set to use a client
+	// certificate.
+	CertFile string
+	KeyFile  string
+	// TrustFile is the PEM encoded CA certificate used to verify the
+	// server. Defaults to the system roots. "all" disables verification.
+	TrustFile string
+	// Client is used for uploads instead of one created from the
+	// TLS settings above.
+	Client *http.Client
+	// StateFile is where the cursor of the last uploaded entry is saved.
+	// Uploading resumes after the saved cursor.
+	StateFile string
+	// BatchSize is the maximum number of entries per upload.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back while
+	// following. Defaults to 1s.
+	FlushInterval time.Duration
+	// Retries is the number of times a failed upload is retried.
+	// Defaults to 4. A negative value retries until the upload succeeds.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for
+	// every following retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+	// OnError is called with errors while following
+	OnError func(err error)
+}
+
+// Uploader uploads journal entries in the Journal Export Format to a
+// systemd-journal-remote compatible service, like systemd-journal-upload.
+type Uploader struct {
+	cfg     UploaderConfig
+	url     string
+	client  *http.Client
+	backoff retry.Backoff
+}
+
+// NewUploader creates an Uploader
+func NewUploader(cfg UploaderConfig) (*Uploader, error) {
+
+	if cfg.URL == "" {
+		return nil, errors.New("an upload URL must be provided")
+	}
+
+	url := strings.TrimSuffix(cfg.URL, "/")
+	if i := strings.Index(url, "://"); i < 0 || !strings.Contains(url[i+3:], "/") {
+		url += "/upload"
+	}
+
+	client := cfg.Client
+	if client == nil {
+		tlsConfig, err := clientTLSConfig(cfg.CertFile, cfg.KeyFile, cfg.TrustFile)
+		if err != nil {
+			return nil, err
+		}
+
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		}
+	}
+
+	return &Uploader{
+		cfg:     cfg,
+		url:     url,
+		client:  client,
+		backoff: retry.WithRetries(cfg.Retries, cfg.RetryBackoff),
+	}, nil
+}
+
+// Export uploads entries in a single request, retrying on failure.
+// Server errors and rate limiting are retried, other client errors are not.
+func (u *Uploader) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return u.backoff.Do(ctx, func() error {
+		return u.upload(ctx, entries)
+	})
+}
+
+// UploadJournal uploads the entries of j from its current position, or
+// after the cursor in the state file, until there are no more entries.
+func (u *Uploader) UploadJournal(ctx context.Context, j journal.Reader) error {
+	return batch.Read(ctx, j, u.batchConfig(), u.Export)
+}
+
+// Follow follows j from its current position, or after the cursor in
+// the state file, and uploads entries as they are written. Errors are
+// passed to OnError. Following stops if entries fail to be uploaded.
+func (u *Uploader) Follow(j journal.Follower) (journal.FollowStop, error) {
+	return batch.Follow(j, u.batchConfig(), u.Export)
+}
+
+func (u *Uploader) batchConfig() batch.Config {
+	return batch.Config{
+		Size:      u.cfg.BatchSize,
+		Interval:  u.cfg.FlushInterval,
+		StateFile: u.cfg.StateFile,
+		OnError:   u.cfg.OnError,
+	}
+}
+
+// upload posts entries with a chunked body encoded while sending
+func (u *Uploader) upload(ctx context.Context, entries []*journal.Entry) error {
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		enc := journal.NewExportEncoder(pw)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, u.url, pr)
+	if err != nil {
+		pr.Close()
+		return retry.Permanent(fmt.Errorf("failed to create upload request: %w", err))
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", journal.ExportContentType)
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		pr.Close()
+		return fmt.Errorf("failed to upload entries: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("failed to upload entries: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout {
+		return err
+	}
+
+	return retry.Permanent(err)
+}
+
+// clientTLSConfig creates the TLS configuration of the client
+func clientTLSConfig(certFile, keyFile, trustFile string) (*tls.Config, error) {
+
+	cfg := &tls.Config{}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch trustFile {
+	case "":
+	case "all":
+		cfg.InsecureSkipVerify = true
+	default:
+		pool, err := loadCertPool(trustFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// loadCertPool loads the PEM encoded certificates of a file
+func loadCertPool(path string) (*x509.CertPool, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in trust file '%s'", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,222 @@
+// +build linux
+
+package remote
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/journaltest"
+)
+
+// uploadServer replies to uploads with the given statuses in turn,
+// accepting uploads once all have been used, and records the messages
+// of the accepted uploads
+type uploadServer struct {
+	*httptest.Server
+	statuses []int
+	requests int
+	uploads  [][]string
+	mutex    sync.Mutex
+}
+
+func newUploadServer(t *testing.T, statuses ...int) *uploadServer {
+
+	s := &uploadServer{statuses: statuses}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upload" || r.Header.Get("Content-Type") != journal.ExportContentType {
+			t.Errorf("unexpected upload to %s of %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		// The messages of the test entries are text fields
+		var messages []string
+
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			if m := strings.TrimPrefix(sc.Text(), "MESSAGE="); m != sc.Text() {
+				messages = append(messages, m)
+			}
+		}
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		status := http.StatusAccepted
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+
+		if status == http.StatusAccepted {
+			s.uploads = append(s.uploads, messages)
+		}
+
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+
+	return s
+}
+
+// result returns the number of requests and the accepted uploads
+func (s *uploadServer) result() (int, string) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests, fmt.Sprint(s.uploads)
+}
+
+func TestUploaderExport(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		fails    bool
+	}{
+		{"accepted", nil, 1, false},
+		{"server errors retried", []int{500, 503}, 3, false},
+		{"rate limited", []int{429}, 2, false},
+		{"client error", []int{400}, 1, true},
+		{"retries used up", []int{500, 500, 500}, 3, true},
+	}
+
+	entries := journaltest.Entries(3)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newUploadServer(t, test.statuses...)
+			defer s.Close()
+
+			u, err := NewUploader(UploaderConfig{
+				URL:          s.URL,
+				Retries:      2,
+				RetryBackoff: time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = u.Export(context.Background(), entries)
+			if (err != nil) != test.fails {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+
+			requests, uploads := s.result()
+			if requests != test.requests {
+				t.Errorf("expected %d requests, got %d", test.requests, requests)
+			}
+
+			if !test.fails && uploads != "[[1 2 3]]" {
+				t.Errorf("unexpected uploads %s", uploads)
+			}
+		})
+	}
+}
+
+func TestUploaderUploadJournal(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newUploadServer(t)
+	defer s.Close()
+
+	state := filepath.Join(dir, "state")
+
+	u, err := NewUploader(UploaderConfig{
+		URL:       s.URL,
+		StateFile: state,
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := journaltest.Entries(7)
+
+	// Uploading again resumes after the last uploaded entry
+	for _, n := range []int{5, 7} {
+		if err := u.UploadJournal(context.Background(), &journaltest.SliceReader{Entries: entries[:n]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "[[1 2] [3 4] [5] [6 7]]"
+	if _, got := s.result(); got != want {
+		t.Errorf("expected uploads %s, got %s", want, got)
+	}
+
+	c, err := batch.LoadCursor(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != entries[6].Cursor {
+		t.Errorf("expected cursor %s saved, got %s", entries[6].Cursor, c)
+	}
+}
+
+func TestNewUploaderURL(t *testing.T) {
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://logs.example.com:19532", "http://logs.example.com:19532/upload"},
+		{"http://logs.example.com:19532/", "http://logs.example.com:19532/upload"},
+		{"http://logs.example.com/journal/upload", "http://logs.example.com/journal/upload"},
+	}
+
+	for _, test := range tests {
+		u, err := NewUploader(UploaderConfig{URL: test.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.url != test.want {
+			t.Errorf("%s: expected %s, got %s", test.url, test.want, u.url)
+		}
+	}
+}
+
+func BenchmarkUploaderExport(b *testing.B) {
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer s.Close()
+
+	u, err := NewUploader(UploaderConfig{URL: s.URL})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	entries := journaltest.Entries(100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := u.Export(context.Background(), entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
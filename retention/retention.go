@@ -0,0 +1,166 @@
+// +build linux
+
+// Package retention removes archived journal files from a journal
+// directory, like the --vacuum-size, --vacuum-time and --vacuum-files
+// options of journalctl do.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Reason tells why a journal file was removed
+type Reason int
+
+// Reason constants
+const (
+	// ReasonAge indicates a file holding entries older than MaxAge only
+	ReasonAge Reason = iota
+	// ReasonFiles indicates a file beyond MaxFiles archived files
+	ReasonFiles
+	// ReasonSize indicates a file removed to get below MaxSize
+	ReasonSize
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonAge:
+		return "age"
+	case ReasonFiles:
+		return "files"
+	case ReasonSize:
+		return "size"
+	default:
+		return fmt.Sprintf("Reason(%d)", r)
+	}
+}
+
+// Policy tells which archived journal files to remove.
+// Zero values disable the respective limit.
+type Policy struct {
+	// MaxSize is the maximum disk usage in bytes of all journal files
+	// in the directory, including online files which are never removed.
+	MaxSize int64
+	// MaxAge is the maximum age of the newest entry of archived files
+	MaxAge time.Duration
+	// MaxFiles is the maximum number of archived files to keep
+	MaxFiles int
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+}
+
+// Removed describes a journal file removed by Vacuum
+type Removed struct {
+	Path   string
+	Size   int64
+	Reason Reason
+}
+
+// Vacuum removes archived journal files in dir and in its machine ID
+// named sub-directories until the policy is met, oldest files first.
+// Files that journald renamed after finding them corrupt are treated as
+// archived. Online and active offline files are never removed. The files
+// removed are returned, along with the first error removing a file.
+// Only the headers of the files are read.
+func Vacuum(dir string, p Policy) ([]Removed, error) {
+
+	files, err := journal.StatFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		total    int64
+		archived []*journal.FileInfo
+	)
+
+	for _, f := range files {
+		total += f.Size
+		if isArchived(f) {
+			archived = append(archived, f)
+		}
+	}
+
+	sort.SliceStable(archived, func(i, k int) bool {
+		return fileTime(archived[i]).Before(fileTime(archived[k]))
+	})
+
+	var removed []Removed
+
+	remove := func(f *journal.FileInfo, reason Reason) error {
+		if !p.DryRun {
+			if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove journal file: %w", err)
+			}
+		}
+
+		total -= f.Size
+		removed = append(removed, Removed{
+			Path:   f.Path,
+			Size:   f.Size,
+			Reason: reason,
+		})
+
+		return nil
+	}
+
+	cutoff := time.Now().Add(-p.MaxAge)
+
+	for i, f := range archived {
+		var (
+			reason Reason
+			ok     bool
+		)
+
+		switch {
+		case p.MaxAge > 0 && lastTime(f).Before(cutoff):
+			reason, ok = ReasonAge, true
+		case p.MaxFiles > 0 && len(archived)-i > p.MaxFiles:
+			reason, ok = ReasonFiles, true
+		case p.MaxSize > 0 && total > p.MaxSize:
+			reason, ok = ReasonSize, true
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := remove(f, reason); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// isArchived reports whether a file is rotated out and safe to remove
+func isArchived(f *journal.FileInfo) bool {
+	return strings.HasSuffix(f.Path, "~") || f.State == journal.FileArchived
+}
+
+// fileTime returns the time of the oldest entry of a file
+func fileTime(f *journal.FileInfo) time.Time {
+
+	if f.Corrupt || f.HeadTimestamp.IsZero() {
+		return f.ModTime
+	}
+
+	return f.HeadTimestamp
+}
+
+// lastTime returns the time of the newest entry of a file
+func lastTime(f *journal.FileInfo) time.Time {
+
+	if f.Corrupt || f.TailTimestamp.IsZero() {
+		return f.ModTime
+	}
+
+	return f.TailTimestamp
+}
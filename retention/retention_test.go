@@ -0,0 +1,177 @@
+// +build linux
+
+package retention
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+const machineID = "fed6b2924c424cf1b9a322f606b4de6d"
+
+const mb = 1 << 20
+
+// testFile is a journal file made of a header only, padded to its size
+type testFile struct {
+	name  string
+	state journal.FileState
+	size  int64
+	// Age of the first and last entry, or of the file if corrupt
+	head, tail time.Duration
+	corrupt    bool
+}
+
+var testFiles = []testFile{
+	{name: "system.journal", state: journal.FileOnline, size: 4 * mb, head: time.Hour},
+	{name: "system@1-1-1.journal", state: journal.FileArchived, size: 2 * mb, head: 240 * time.Hour, tail: 216 * time.Hour},
+	{name: "system@1-2-2.journal", state: journal.FileArchived, size: 2 * mb, head: 120 * time.Hour, tail: 96 * time.Hour},
+	{name: "user-1000@1-3-3.journal~", size: mb, head: 72 * time.Hour, corrupt: true},
+	{name: "system@1-4-4.journal", state: journal.FileArchived, size: 2 * mb, head: 48 * time.Hour, tail: 24 * time.Hour},
+}
+
+func writeTestFiles(t *testing.T) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(dir, machineID)
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	for _, f := range testFiles {
+		path := filepath.Join(sub, f.name)
+
+		data := []byte("not a journal file")
+		if !f.corrupt {
+			data = header(f.state, now.Add(-f.head), now.Add(-f.tail))
+		}
+
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(path, f.size); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-f.head), now.Add(-f.head)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// header returns the header of a journal file holding entries written
+// between head and tail
+func header(state journal.FileState, head, tail time.Time) []byte {
+
+	buf := make([]byte, 272)
+	le := binary.LittleEndian
+
+	copy(buf, "LPKSHHRH")
+	buf[16] = byte(state)
+	le.PutUint64(buf[88:], uint64(len(buf)))
+	le.PutUint64(buf[184:], uint64(head.UnixNano()/1000))
+	le.PutUint64(buf[192:], uint64(tail.UnixNano()/1000))
+
+	return buf
+}
+
+func TestVacuum(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		removed []string
+		reason  Reason
+	}{
+		{
+			name:    "age",
+			policy:  Policy{MaxAge: 7 * 24 * time.Hour},
+			removed: []string{"system@1-1-1.journal"},
+			reason:  ReasonAge,
+		},
+		{
+			name:    "files",
+			policy:  Policy{MaxFiles: 2},
+			removed: []string{"system@1-1-1.journal", "system@1-2-2.journal"},
+			reason:  ReasonFiles,
+		},
+		{
+			name:    "size",
+			policy:  Policy{MaxSize: 8 * mb},
+			removed: []string{"system@1-1-1.journal", "system@1-2-2.journal"},
+			reason:  ReasonSize,
+		},
+		{
+			// The online file is kept even if above the limit
+			name:   "online",
+			policy: Policy{MaxSize: 1},
+			removed: []string{"system@1-1-1.journal", "system@1-2-2.journal",
+				"user-1000@1-3-3.journal~", "system@1-4-4.journal"},
+			reason: ReasonSize,
+		},
+		{
+			name:    "dry run",
+			policy:  Policy{MaxFiles: 3, DryRun: true},
+			removed: []string{"system@1-1-1.journal"},
+			reason:  ReasonFiles,
+		},
+		{
+			name:   "none",
+			policy: Policy{MaxAge: 30 * 24 * time.Hour, MaxFiles: 4, MaxSize: 100 * mb},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, remove := writeTestFiles(t)
+			defer remove()
+
+			removed, err := Vacuum(dir, test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, r := range removed {
+				names = append(names, filepath.Base(r.Path))
+				if r.Reason != test.reason {
+					t.Errorf("%s: expected reason %s, got %s", r.Path, test.reason, r.Reason)
+				}
+			}
+
+			if !reflect.DeepEqual(names, test.removed) {
+				t.Fatalf("expected %v removed, got %v", test.removed, names)
+			}
+
+			for _, f := range testFiles {
+				_, err := os.Stat(filepath.Join(dir, machineID, f.name))
+				gone := contains(test.removed, f.name) && !test.policy.DryRun
+				if gone != os.IsNotExist(err) {
+					t.Errorf("%s: expected removed %v, got %v", f.name, gone, err)
+				}
+			}
+		})
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
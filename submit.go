@@ -39,35 +39,87 @@ func SubmitWithFields(p Priority, m string, f Fields) error {
 		f[FieldMessage] = m
 	}
 
-	iov := make([]C.struct_iovec, len(f))
-
-	i := 0
+	fields := make([]Field, 0, len(f))
 	for k, v := range f {
+		fields = append(fields, Field{Name: k, Value: []byte(v)})
+	}
 
-		if k == "" {
-			return errors.New("Field name must not be empty")
-		}
-		if k[0] == '_' {
-			return errors.New("Field name must not begin with the character '_'")
-		}
-		fnv := strings.ToUpper(k)
-		if fnv != k {
-			return errors.New("Field name must be upper-case")
+	return SubmitEntry(fields)
+}
+
+// Field is a single field of an entry to be submitted. The value
+// may contain binary data including NUL bytes.
+type Field struct {
+	Name  string
+	Value []byte
+}
+
+// SubmitEntry submits a new entry made of the provided fields in
+// the given order. The same field name may occur multiple times.
+// Unlike SubmitWithFields, no priority or message field is added.
+func SubmitEntry(fields []Field) error {
+
+	if len(fields) == 0 {
+		return errors.New("Entry must contain at least one field")
+	}
+
+	iov := make([]C.struct_iovec, len(fields))
+
+	for i, f := range fields {
+		if err := validateFieldName(f.Name); err != nil {
+			return err
 		}
 
-		fnv = fnv + "=" + v
+		data := make([]byte, 0, len(f.Name)+1+len(f.Value))
+		data = append(data, f.Name...)
+		data = append(data, '=')
+		data = append(data, f.Value...)
 
-		f := C.CString(fnv)
-		defer C.free(unsafe.Pointer(f))
+		// C.CBytes copies the full length, embedded NUL bytes included
+		b := C.CBytes(data)
+		defer C.free(b)
 
-		iov[i].iov_len = C.ulong(len(fnv))
-		iov[i].iov_base = unsafe.Pointer(f)
-		i++
+		iov[i].iov_len = C.size_t(len(data))
+		iov[i].iov_base = b
 	}
 
-	if ret := C.sd_journal_sendv((*C.struct_iovec)(unsafe.Pointer(&iov[0])), C.int(i)); ret < 0 {
+	if ret := C.sd_journal_sendv((*C.struct_iovec)(unsafe.Pointer(&iov[0])), C.int(len(iov))); ret < 0 {
 		return fmt.Errorf("failed to get send entry to journal: %w", syscall.Errno(-ret))
 	}
 
 	return nil
 }
+
+func validateFieldName(name string) error {
+
+	if name == "" {
+		return errors.New("Field name must not be empty")
+	}
+	if name[0] == '_' {
+		return errors.New("Field name must not begin with the character '_'")
+	}
+	if strings.ToUpper(name) != name {
+		return errors.New("Field name must be upper-case")
+	}
+
+	return nil
+}
+
+// Submitter is implemented by types that write entries to the journal.
+// The package-level functions Submit and SubmitWithFields are used
+// wherever a Submitter is optional and not provided.
+type Submitter interface {
+	Submit(p Priority, m string) error
+	SubmitWithFields(p Priority, m string, f Fields) error
+}
+
+// journalSubmitter submits entries directly to the journal
+type journalSubmitter struct{}
+
+func (journalSubmitter) Submit(p Priority, m string) error {
+	return Submit(p, m)
+}
+
+func (journalSubmitter) SubmitWithFields(p Priority, m string, f Fields) error {
+	return SubmitWithFields(p, m, f)
+}
@@ -0,0 +1,51 @@
+// +build linux
+
+package journal
+
+import (
+	"testing"
+)
+
+func TestValidateFieldName(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"MESSAGE", true},
+		{"MY_FIELD", true},
+		{"FIELD_2", true},
+		{"", false},
+		{"_PID", false},
+		{"__CURSOR", false},
+		{"message", false},
+		{"My_Field", false},
+	}
+
+	for _, test := range tests {
+		err := validateFieldName(test.name)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%q: expected valid %v, got error %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestSubmitEntryInvalid(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		fields []Field
+	}{
+		{"no fields", nil},
+		{"empty name", []Field{{Name: "MESSAGE", Value: []byte("a")}, {Value: []byte("b")}}},
+		{"trusted field", []Field{{Name: "_PID", Value: []byte("1")}}},
+		{"lower-case", []Field{{Name: "MESSAGE", Value: []byte("a")}, {Name: "field", Value: []byte("b")}}},
+	}
+
+	// Invalid entries are rejected before anything is sent
+	for _, test := range tests {
+		if err := SubmitEntry(test.fields); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
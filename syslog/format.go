@@ -0,0 +1,279 @@
+// +build linux
+
+// Package syslog forwards journal entries to syslog servers and receives
+// syslog messages into the journal.
+package syslog
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Format is a syslog message format
+type Format int
+
+// Format constants
+const (
+	// FormatRFC5424 formats messages as described in RFC 5424
+	FormatRFC5424 Format = iota
+	// FormatRFC3164 formats messages in the BSD syslog format of RFC 3164
+	FormatRFC3164
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatRFC5424:
+		return "rfc5424"
+	case FormatRFC3164:
+		return "rfc3164"
+	default:
+		return "Format(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// DefaultStructuredDataID is the SD-ID of the structured data element
+// holding journal fields, using the private enterprise number reserved
+// for documentation
+const DefaultStructuredDataID = "journal@32473"
+
+// Maximum lengths of header fields of RFC 5424
+const (
+	maxHostnameLen = 255
+	maxAppNameLen  = 48
+	maxProcIDLen   = 128
+	maxMsgIDLen    = 32
+	maxSDNameLen   = 32
+	// RFC 3164 limits the tag to 32 characters
+	maxTagLen = 32
+)
+
+// formatter formats entries as syslog messages
+type formatter struct {
+	format   Format
+	hostname string
+	sdID     string
+	fields   []string
+}
+
+// newFormatter creates a formatter. Entries without a hostname are sent
+// with hostname, or else the hostname of the machine.
+func newFormatter(format Format, hostname, sdID string, fields []string) *formatter {
+
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if sdID == "" {
+		sdID = DefaultStructuredDataID
+	}
+
+	return &formatter{
+		format:   format,
+		hostname: hostname,
+		sdID:     sdID,
+		fields:   fields,
+	}
+}
+
+// Format returns the syslog message of an entry, without framing
+func (f *formatter) Format(e *journal.Entry) string {
+
+	if f.format == FormatRFC3164 {
+		return f.format3164(e)
+	}
+
+	return f.format5424(e)
+}
+
+func (f *formatter) format5424(e *journal.Entry) string {
+
+	var b strings.Builder
+
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(pri(e)))
+	b.WriteString(">1 ")
+
+	t := entryTime(e)
+	if t.IsZero() {
+		b.WriteByte('-')
+	} else {
+		b.WriteString(t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(headerField(f.entryHostname(e), maxHostnameLen))
+	b.WriteByte(' ')
+	b.WriteString(headerField(identifier(e), maxAppNameLen))
+	b.WriteByte(' ')
+	b.WriteString(headerField(pid(e), maxProcIDLen))
+	b.WriteByte(' ')
+	b.WriteString(headerField(e.Fields[journal.FieldMessageID], maxMsgIDLen))
+	b.WriteByte(' ')
+	f.writeStructuredData(&b, e)
+
+	if msg := e.Fields[journal.FieldMessage]; msg != "" {
+		b.WriteByte(' ')
+		b.WriteString(msg)
+	}
+
+	return b.String()
+}
+
+func (f *formatter) format3164(e *journal.Entry) string {
+
+	var b strings.Builder
+
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(pri(e)))
+	b.WriteByte('>')
+
+	t := entryTime(e)
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	b.WriteString(t.Local().Format(time.Stamp))
+	b.WriteByte(' ')
+	b.WriteString(headerField(f.entryHostname(e), maxHostnameLen))
+	b.WriteByte(' ')
+
+	tag := identifier(e)
+	if tag == "" {
+		tag = "journal"
+	}
+
+	b.WriteString(headerField(tag, maxTagLen))
+
+	if p := pid(e); p != "" {
+		b.WriteByte('[')
+		b.WriteString(p)
+		b.WriteByte(']')
+	}
+
+	b.WriteString(": ")
+	b.WriteString(e.Fields[journal.FieldMessage])
+
+	return b.String()
+}
+
+// writeStructuredData writes the configured fields of an entry as a
+// single structured data element, or "-" if it has none of them
+func (f *formatter) writeStructuredData(b *strings.Builder, e *journal.Entry) {
+
+	written := false
+
+	for _, name := range f.fields {
+		v, ok := e.Fields[name]
+		if !ok || len(name) > maxSDNameLen {
+			continue
+		}
+
+		if !written {
+			b.WriteByte('[')
+			b.WriteString(f.sdID)
+			written = true
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(sdParamEscaper.Replace(v))
+		b.WriteByte('"')
+	}
+
+	if !written {
+		b.WriteByte('-')
+		return
+	}
+
+	b.WriteByte(']')
+}
+
+// Characters escaped in structured data parameter values
+var sdParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+func (f *formatter) entryHostname(e *journal.Entry) string {
+
+	if h, err := e.Hostname(); err == nil && h != "" {
+		return h
+	}
+
+	return f.hostname
+}
+
+// entryTime returns the time an entry was created at the source, or else
+// when it was received by the journal
+func entryTime(e *journal.Entry) time.Time {
+
+	if t, err := e.SourceTime(); err == nil {
+		return t
+	}
+
+	return e.Timestamp
+}
+
+// pri returns the PRI value of an entry. Entries without a facility are
+// from the kernel if read from the kernel and else user-level.
+func pri(e *journal.Entry) int {
+
+	p, err := e.Priority()
+	if err != nil {
+		p = journal.PriorityInfo
+	}
+
+	fac, err := e.Facility()
+	if err != nil {
+		fac = journal.FacilityUser
+		if t, err := e.Transport(); err == nil && t == journal.TransportKernel {
+			fac = journal.FacilityKern
+		}
+	}
+
+	return int(fac)*8 + int(p)
+}
+
+// identifier returns SYSLOG_IDENTIFIER or else _COMM of an entry
+func identifier(e *journal.Entry) string {
+
+	if id, err := e.Identifier(); err == nil && id != "" {
+		return id
+	}
+
+	return e.Fields[journal.FieldComm]
+}
+
+// pid returns _PID or else SYSLOG_PID of an entry
+func pid(e *journal.Entry) string {
+
+	if p := e.Fields[journal.FieldPID]; p != "" {
+		return p
+	}
+
+	return e.Fields[journal.FieldSyslogPID]
+}
+
+// headerField makes a value valid as a header field, i.e. printable
+// US-ASCII without spaces, of at most max characters. Empty values are
+// replaced by the nil value "-".
+func headerField(v string, max int) string {
+
+	if v == "" {
+		return "-"
+	}
+
+	b := []byte(v)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+
+	if len(b) > max {
+		b = b[:max]
+	}
+
+	return string(b)
+}
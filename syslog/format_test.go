@@ -0,0 +1,183 @@
+// +build linux
+
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+func TestFormatParse(t *testing.T) {
+
+	ts := time.Date(2020, 9, 13, 12, 26, 40, 123456000, time.UTC)
+
+	tests := []struct {
+		name   string
+		format Format
+		fields []string
+		entry  journal.Fields
+		want   Message
+	}{
+		{
+			name:   "rfc5424",
+			format: FormatRFC5424,
+			fields: []string{journal.FieldUnit},
+			entry: journal.Fields{
+				journal.FieldMessage:          "started",
+				journal.FieldPriority:         "3",
+				journal.FieldSyslogFacility:   "4",
+				journal.FieldSyslogIdentifier: "app",
+				journal.FieldPID:              "42",
+				journal.FieldHostname:         "host",
+				journal.FieldMessageID:        "39f53479d3a045ac8e11786248231fbf",
+				journal.FieldUnit:             `app "x"].service`,
+			},
+			want: Message{
+				Format:         FormatRFC5424,
+				Priority:       journal.PriorityError,
+				Facility:       journal.FacilityAuth,
+				Timestamp:      ts,
+				Hostname:       "host",
+				AppName:        "app",
+				ProcID:         "42",
+				MsgID:          "39f53479d3a045ac8e11786248231fbf",
+				StructuredData: `[journal@32473 _SYSTEMD_UNIT="app \"x\"\].service"]`,
+				Message:        "started",
+			},
+		},
+		{
+			name:   "rfc5424 nil values",
+			format: FormatRFC5424,
+			entry: journal.Fields{
+				journal.FieldMessage: "no identifier",
+			},
+			want: Message{
+				Format:    FormatRFC5424,
+				Priority:  journal.PriorityInfo,
+				Facility:  journal.FacilityUser,
+				Timestamp: ts,
+				Hostname:  "default",
+				Message:   "no identifier",
+			},
+		},
+		{
+			name:   "rfc5424 header fields",
+			format: FormatRFC5424,
+			entry: journal.Fields{
+				journal.FieldMessage:          "spaces",
+				journal.FieldSyslogIdentifier: "my app",
+				journal.FieldSyslogPID:        "7",
+			},
+			want: Message{
+				Format:    FormatRFC5424,
+				Priority:  journal.PriorityInfo,
+				Facility:  journal.FacilityUser,
+				Timestamp: ts,
+				Hostname:  "default",
+				AppName:   "my_app",
+				ProcID:    "7",
+				Message:   "spaces",
+			},
+		},
+		{
+			name:   "rfc3164",
+			format: FormatRFC3164,
+			entry: journal.Fields{
+				journal.FieldMessage:          "started: ok",
+				journal.FieldPriority:         "5",
+				journal.FieldSyslogIdentifier: "app",
+				journal.FieldPID:              "42",
+				journal.FieldHostname:         "host",
+			},
+			want: Message{
+				Format:   FormatRFC3164,
+				Priority: journal.PriorityNotice,
+				Facility: journal.FacilityUser,
+				Hostname: "host",
+				AppName:  "app",
+				ProcID:   "42",
+				Message:  "started: ok",
+			},
+		},
+		{
+			name:   "rfc3164 kernel",
+			format: FormatRFC3164,
+			entry: journal.Fields{
+				journal.FieldMessage:   "usb 1-1: new device",
+				journal.FieldTransport: "kernel",
+			},
+			want: Message{
+				Format:   FormatRFC3164,
+				Priority: journal.PriorityInfo,
+				Facility: journal.FacilityKern,
+				Hostname: "default",
+				AppName:  "journal",
+				Message:  "usb 1-1: new device",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		f := newFormatter(test.format, "default", "", test.fields)
+
+		msg := f.Format(&journal.Entry{Fields: test.entry, Timestamp: ts})
+
+		got, err := Parse([]byte(msg))
+		if err != nil {
+			t.Fatalf("%s: failed to parse %q: %v", test.name, msg, err)
+		}
+
+		// RFC 3164 timestamps have second precision and no year
+		if test.format == FormatRFC3164 {
+			if want := ts.Local().Format(time.Stamp); got.Timestamp.Format(time.Stamp) != want {
+				t.Errorf("%s: expected timestamp %s, got %s", test.name, want, got.Timestamp)
+			}
+			got.Timestamp = time.Time{}
+			got.TimestampText = ""
+		} else {
+			got.Timestamp = got.Timestamp.UTC()
+			got.TimestampText = ""
+		}
+
+		if *got != test.want {
+			t.Errorf("%s: %q parsed as %+v, expected %+v", test.name, msg, *got, test.want)
+		}
+	}
+}
+
+func BenchmarkFormat(b *testing.B) {
+
+	f := newFormatter(FormatRFC5424, "default", "", []string{journal.FieldUnit})
+
+	e := &journal.Entry{
+		Fields: journal.Fields{
+			journal.FieldMessage:          "started",
+			journal.FieldPriority:         "6",
+			journal.FieldSyslogIdentifier: "app",
+			journal.FieldPID:              "42",
+			journal.FieldUnit:             "app.service",
+		},
+		Timestamp: time.Now(),
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		f.Format(e)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+
+	msg := []byte(`<14>1 2020-09-13T12:26:40.123456Z host app 42 - [journal@32473 _SYSTEMD_UNIT="app.service"] started`)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
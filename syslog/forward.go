@@ -0,0 +1,231 @@
+// +build linux
+
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	journal "github.com/vargspjut/systemd-journal"
+	"github.com/vargspjut/systemd-journal/internal/batch"
+	"github.com/vargspjut/systemd-journal/internal/conn"
+	"github.com/vargspjut/systemd-journal/internal/retry"
+)
+
+// Framing is how messages are delimited on stream transports
+type Framing int
+
+// Framing constants
+const (
+	// FramingOctetCounting prefixes each message with its length as
+	// described in RFC 6587
+	FramingOctetCounting Framing = iota
+	// FramingNewline terminates each message with a newline. Newlines
+	// within messages are replaced by spaces.
+	FramingNewline
+)
+
+// ForwarderConfig configures a Forwarder
+type ForwarderConfig struct {
+	// Network is "udp", "tcp" or "tls". Defaults to "udp".
+	Network string
+	// Address of the syslog server, e.g. "logs.example.com:514"
+	Address string
+	// TLSConfig is used when Network is "tls". Defaults to verifying the
+	// server using the system roots.
+	TLSConfig *tls.Config
+	// Format of the messages. Defaults to FormatRFC5424.
+	Format Format
+	// Framing of messages on tcp and tls. Defaults to FramingOctetCounting.
+	Framing Framing
+	// Hostname is sent for entries without _HOSTNAME. Defaults to the
+	// hostname of the machine.
+	Hostname string
+	// StructuredDataID is the SD-ID of the structured data element
+	// holding Fields. Defaults to DefaultStructuredDataID.
+	StructuredDataID string
+	// Fields are the journal fields sent as structured data parameters
+	// with RFC 5424, e.g. _SYSTEMD_UNIT. Fields with names longer than
+	// 32 characters are left out.
+	Fields []string
+	// MaxMessageSize is the size longer messages are truncated to.
+	// Defaults to 2048 bytes for udp and 8192 bytes otherwise.
+	MaxMessageSize int
+	// DialTimeout is the maximum time to connect. Defaults to 10s.
+	DialTimeout time.Duration
+	// WriteTimeout is the maximum time to write a message. Defaults to 10s.
+	WriteTimeout time.Duration
+	// StateFile is where the cursor of the last forwarded entry is saved.
+	// Forwarding resumes after the saved cursor.
+	StateFile string
+	// BatchSize is the maximum number of entries per batch.
+	// Defaults to 500.
+	BatchSize int
+	// FlushInterval is the maximum time entries are held back while
+	// following. Defaults to 1s.
+	FlushInterval time.Duration
+	// Retries is the number of times the server is reconnected to after
+	// failing to send a batch. Defaults to 4. A negative value retries
+	// until the batch is sent.
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for
+	// every following retry up to 30s. Defaults to 500ms.
+	RetryBackoff time.Duration
+	// OnError is called with errors while following
+	OnError func(err error)
+}
+
+// Forwarder forwards journal entries to a syslog server, like
+// systemd-journald with ForwardToSyslog but over the network.
+type Forwarder struct {
+	cfg       ForwarderConfig
+	formatter *formatter
+	backoff   retry.Backoff
+	conn      *conn.Conn
+	mutex     sync.Mutex
+}
+
+// NewForwarder creates a Forwarder. The server is connected to when
+// entries are first exported.
+func NewForwarder(cfg ForwarderConfig) (*Forwarder, error) {
+
+	if cfg.Address == "" {
+		return nil, errors.New("a syslog server address must be provided")
+	}
+
+	switch cfg.Network {
+	case "":
+		cfg.Network = "udp"
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported network '%s'", cfg.Network)
+	}
+
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = 8192
+		if cfg.Network == "udp" {
+			cfg.MaxMessageSize = 2048
+		}
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 10 * time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+
+	return &Forwarder{
+		cfg:       cfg,
+		formatter: newFormatter(cfg.Format, cfg.Hostname, cfg.StructuredDataID, cfg.Fields),
+		backoff:   retry.WithRetries(cfg.Retries, cfg.RetryBackoff),
+		conn: conn.New(conn.Config{
+			Network:      cfg.Network,
+			Address:      cfg.Address,
+			TLSConfig:    cfg.TLSConfig,
+			DialTimeout:  cfg.DialTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			Name:         "syslog server",
+		}),
+	}, nil
+}
+
+// Export sends entries as syslog messages. If sending fails, the server
+// is reconnected to and the remaining messages are sent again.
+func (f *Forwarder) Export(ctx context.Context, entries []*journal.Entry) error {
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	msgs := make([][]byte, len(entries))
+	for i, e := range entries {
+		msgs[i] = f.frame(f.formatter.Format(e))
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	sent := 0
+
+	return f.backoff.Do(ctx, func() error {
+		for sent < len(msgs) {
+			if err := f.conn.Write(ctx, msgs[sent]); err != nil {
+				return err
+			}
+			sent++
+		}
+
+		return nil
+	})
+}
+
+// Follow follows j from its current position, or after the cursor in
+// the state file, and forwards entries as they are written. Errors are
+// passed to OnError. Following stops if entries fail to be forwarded.
+func (f *Forwarder) Follow(j journal.Follower) (journal.FollowStop, error) {
+	return batch.Follow(j, f.batchConfig(), f.Export)
+}
+
+// ForwardJournal forwards the entries of j from its current position, or
+// after the cursor in the state file, until there are no more entries.
+func (f *Forwarder) ForwardJournal(ctx context.Context, j journal.Reader) error {
+	return batch.Read(ctx, j, f.batchConfig(), f.Export)
+}
+
+// Close closes the connection to the server
+func (f *Forwarder) Close() error {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.conn.Close()
+}
+
+func (f *Forwarder) batchConfig() batch.Config {
+	return batch.Config{
+		Size:      f.cfg.BatchSize,
+		Interval:  f.cfg.FlushInterval,
+		StateFile: f.cfg.StateFile,
+		OnError:   f.cfg.OnError,
+	}
+}
+
+// frame truncates a message to the maximum size and frames it for the
+// transport
+func (f *Forwarder) frame(msg string) []byte {
+
+	if len(msg) > f.cfg.MaxMessageSize {
+		n := f.cfg.MaxMessageSize
+		// Don't split a multibyte character
+		for n > 0 && !utf8.RuneStart(msg[n]) {
+			n--
+		}
+		msg = msg[:n]
+	}
+
+	if f.cfg.Network == "udp" {
+		return []byte(msg)
+	}
+
+	if f.cfg.Framing == FramingNewline {
+		b := []byte(msg)
+		for i, c := range b {
+			if c == '\n' {
+				b[i] = ' '
+			}
+		}
+		return append(b, '\n')
+	}
+
+	b := make([]byte, 0, len(msg)+6)
+	b = strconv.AppendInt(b, int64(len(msg)), 10)
+	b = append(b, ' ')
+
+	return append(b, msg...)
+}
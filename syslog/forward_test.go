@@ -0,0 +1,190 @@
+// +build linux
+
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// listen starts a server on network reading the messages forwarded to it
+// into a channel, returning its address and a function stopping it
+func listen(t *testing.T, network string, framing Framing) (string, <-chan string, func()) {
+
+	msgs := make(chan string, 100)
+
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			buf := make([]byte, 64*1024)
+			for {
+				n, _, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				msgs <- string(buf[:n])
+			}
+		}()
+
+		return pc.LocalAddr().String(), msgs, func() { pc.Close() }
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		r := bufio.NewReader(c)
+		for {
+			msg, err := readTestFrame(r, framing)
+			if err != nil {
+				return
+			}
+			msgs <- msg
+		}
+	}()
+
+	return l.Addr().String(), msgs, func() { l.Close() }
+}
+
+func readTestFrame(r *bufio.Reader, framing Framing) (string, error) {
+
+	if framing == FramingNewline {
+		line, err := r.ReadString('\n')
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+
+	return string(msg), err
+}
+
+func TestForwarderExport(t *testing.T) {
+
+	entries := []*journal.Entry{
+		{Fields: journal.Fields{journal.FieldMessage: "first"}},
+		{Fields: journal.Fields{journal.FieldMessage: "multi\nline"}},
+		{Fields: journal.Fields{journal.FieldMessage: strings.Repeat("ä", 100)}},
+	}
+
+	tests := []struct {
+		network string
+		framing Framing
+		want    []string
+	}{
+		{"udp", FramingOctetCounting, []string{"first", "multi\nline", strings.Repeat("ä", 23)}},
+		{"tcp", FramingOctetCounting, []string{"first", "multi\nline", strings.Repeat("ä", 23)}},
+		{"tcp", FramingNewline, []string{"first", "multi line", strings.Repeat("ä", 23)}},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("%s framing %d", test.network, test.framing)
+
+		addr, msgs, stop := listen(t, test.network, test.framing)
+
+		f, err := NewForwarder(ForwarderConfig{
+			Network:        test.network,
+			Address:        addr,
+			Format:         FormatRFC3164,
+			Framing:        test.framing,
+			Hostname:       "host",
+			MaxMessageSize: 80,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := f.Export(context.Background(), entries); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		for i, want := range test.want {
+			select {
+			case msg := <-msgs:
+				// Messages are "<14>Jan _2 15:04:05 host journal: MESSAGE"
+				got := msg[strings.Index(msg, "journal: ")+len("journal: "):]
+				if got != want {
+					t.Errorf("%s: message %d: expected %q, got %q", name, i, want, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: timed out waiting for message %d", name, i)
+			}
+		}
+
+		f.Close()
+		stop()
+	}
+}
+
+func BenchmarkForwarderExport(b *testing.B) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(ioutil.Discard, c)
+	}()
+
+	f, err := NewForwarder(ForwarderConfig{Network: "tcp", Address: l.Addr().String()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	entries := make([]*journal.Entry, 100)
+	for i := range entries {
+		entries[i] = &journal.Entry{
+			Fields:    journal.Fields{journal.FieldMessage: fmt.Sprintf("message %d", i)},
+			Timestamp: time.Now(),
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := f.Export(context.Background(), entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// +build linux
+
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Message is a parsed syslog message
+type Message struct {
+	// Format the message was parsed as
+	Format   Format
+	Priority journal.Priority
+	Facility journal.Facility
+	// Timestamp is zero if the message has none
+	Timestamp time.Time
+	// TimestampText is the timestamp as written in the message
+	TimestampText string
+	// Hostname, AppName, ProcID and MsgID are empty if not present.
+	// AppName and ProcID are the tag and PID of RFC 3164 messages.
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+	// StructuredData holds the structured data elements as written in
+	// RFC 5424 messages
+	StructuredData string
+	Message        string
+}
+
+// Messages without PRI are user-level notices as per RFC 3164
+const defaultPRI = int(journal.FacilityUser)*8 + int(journal.PriorityNotice)
+
+// The highest PRI value, local7.debug
+const maxPRI = 191
+
+// Parse parses an RFC 5424 or RFC 3164 message, without framing. Parsing
+// RFC 3164 messages is lenient as the format varies between senders.
+func Parse(b []byte) (*Message, error) {
+
+	s := string(trimMessage(b))
+	if s == "" {
+		return nil, errors.New("empty syslog message")
+	}
+
+	pri, s, err := parsePRI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Message{
+		Priority: journal.Priority(pri % 8),
+		Facility: journal.Facility(pri / 8),
+	}
+
+	if strings.HasPrefix(s, "1 ") {
+		m.Format = FormatRFC5424
+		if err := m.parse5424(s[2:]); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	m.Format = FormatRFC3164
+	m.parse3164(s)
+
+	return m, nil
+}
+
+// trimMessage trims trailing newlines and NUL bytes left by senders
+func trimMessage(b []byte) []byte {
+	return bytes.TrimRight(b, "\r\n\x00")
+}
+
+// parsePRI parses the PRI part of a message, if any, and returns it
+// along with the rest of the message
+func parsePRI(s string) (int, string, error) {
+
+	if s[0] != '<' {
+		return defaultPRI, s, nil
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, "", fmt.Errorf("invalid syslog PRI '%.5s'", s)
+	}
+
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > maxPRI {
+		return 0, "", fmt.Errorf("invalid syslog PRI '%s'", s[:end+1])
+	}
+
+	return pri, s[end+1:], nil
+}
+
+func (m *Message) parse5424(s string) error {
+
+	var header [5]string
+
+	for i := range header {
+		end := strings.IndexByte(s, ' ')
+		if end < 0 {
+			return fmt.Errorf("invalid RFC 5424 message: missing header fields")
+		}
+
+		if v := s[:end]; v != "-" {
+			header[i] = v
+		}
+
+		s = s[end+1:]
+	}
+
+	if header[0] != "" {
+		t, err := time.Parse(time.RFC3339Nano, header[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp '%s'", header[0])
+		}
+		m.Timestamp = t
+		m.TimestampText = header[0]
+	}
+
+	m.Hostname = header[1]
+	m.AppName = header[2]
+	m.ProcID = header[3]
+	m.MsgID = header[4]
+
+	sd, msg, err := splitStructuredData(s)
+	if err != nil {
+		return err
+	}
+
+	if sd != "-" {
+		m.StructuredData = sd
+	}
+
+	// Messages in UTF-8 start with a byte order mark
+	m.Message = strings.TrimPrefix(msg, "\xef\xbb\xbf")
+
+	return nil
+}
+
+// splitStructuredData splits the structured data from the message that
+// follows it
+func splitStructuredData(s string) (string, string, error) {
+
+	if strings.HasPrefix(s, "-") {
+		return "-", strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	i := 0
+
+	for i < len(s) && s[i] == '[' {
+		quoted := false
+
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if quoted && c == '\\' {
+				i++
+				continue
+			}
+			if c == '"' {
+				quoted = !quoted
+			}
+			if c == ']' && !quoted {
+				break
+			}
+		}
+
+		if i == len(s) {
+			return "", "", errors.New("invalid RFC 5424 message: unterminated structured data")
+		}
+
+		i++
+	}
+
+	if i == 0 {
+		return "", "", errors.New("invalid RFC 5424 message: missing structured data")
+	}
+
+	return s[:i], strings.TrimPrefix(s[i:], " "), nil
+}
+
+// parse3164 parses what follows PRI in an RFC 3164 message. A hostname
+// follows the timestamp, but is left out by local senders, so the first
+// word after the timestamp is the tag if it looks like one. Messages
+// without a timestamp have no hostname either.
+func (m *Message) parse3164(s string) {
+
+	s = m.parse3164Timestamp(s)
+
+	if i := strings.IndexByte(s, ' '); i > 0 && m.TimestampText != "" && !isTag(s[:i]) {
+		m.Hostname = s[:i]
+		s = s[i+1:]
+	}
+
+	m.Message = m.parseTag(s)
+}
+
+// parse3164Timestamp parses a leading timestamp, either as in RFC 3164
+// or as RFC 3339 as sent by some senders, and returns the rest of s
+func (m *Message) parse3164Timestamp(s string) string {
+
+	if len(s) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local); err == nil {
+			m.Timestamp = withYear(t, time.Now())
+			m.TimestampText = s[:len(time.Stamp)]
+			return strings.TrimPrefix(s[len(time.Stamp):], " ")
+		}
+	}
+
+	word := s
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		word = s[:i]
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, word); err == nil {
+		m.Timestamp = t
+		m.TimestampText = word
+		return strings.TrimPrefix(s[len(word):], " ")
+	}
+
+	return s
+}
+
+// withYear sets the year of a timestamp without one. Timestamps more
+// than a day ahead of now are from the previous year.
+func withYear(t, now time.Time) time.Time {
+
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+
+	return t
+}
+
+// parseTag parses a tag, with an optional PID, followed by a colon and
+// returns the rest of s. s is returned as is if it has no tag.
+func (m *Message) parseTag(s string) string {
+
+	end := strings.IndexAny(s, "[: ")
+	if end <= 0 {
+		return s
+	}
+
+	tag := s[:end]
+	rest := s[end:]
+
+	var pid string
+
+	if rest[0] == '[' {
+		bracket := strings.IndexByte(rest, ']')
+		if bracket < 0 {
+			return s
+		}
+		pid = rest[1:bracket]
+		rest = rest[bracket+1:]
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return s
+	}
+
+	m.AppName = tag
+	m.ProcID = pid
+
+	return strings.TrimPrefix(rest[1:], " ")
+}
+
+// isTag returns true if a word is a tag, i.e. ends with a colon or has
+// a PID
+func isTag(word string) bool {
+	return strings.HasSuffix(word, ":") || strings.Contains(word, "[")
+}
@@ -0,0 +1,367 @@
+// +build linux
+
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+// Fields set on entries received by a Server, besides the SYSLOG_*
+// fields predefined by the journal package
+const (
+	// FieldHostname is the hostname given in a message
+	FieldHostname = "SYSLOG_HOSTNAME"
+	// FieldSourceHost is the address a message was received from. It
+	// isn't set for messages received on unix sockets.
+	FieldSourceHost = "SYSLOG_SOURCE_HOST"
+)
+
+// ErrServerClosed is returned by the Serve methods of a closed Server
+var ErrServerClosed = errors.New("syslog: server closed")
+
+// ServerConfig configures a Server
+type ServerConfig struct {
+	// Submitter receives the entries. Defaults to the journal.
+	Submitter journal.Submitter
+	// MaxMessageSize is the size longer messages are truncated to.
+	// Defaults to 64 KiB.
+	MaxMessageSize int
+	// OnError is called with messages that fail to be parsed or
+	// submitted, and with failing connections
+	OnError func(err error)
+}
+
+// Server receives syslog messages over UDP, TCP and unix sockets and
+// submits them to the journal, like systemd-journald does with messages
+// written to /dev/log. Both RFC 5424 and RFC 3164 messages are accepted.
+// Messages on stream sockets are either octet counted or terminated by
+// a newline or NUL.
+type Server struct {
+	cfg    ServerConfig
+	submit func(p journal.Priority, m string, f journal.Fields) error
+
+	mutex   sync.Mutex
+	closed  bool
+	closers map[io.Closer]struct{}
+	wg      sync.WaitGroup
+}
+
+// NewServer creates a Server
+func NewServer(cfg ServerConfig) *Server {
+
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = 64 << 10
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	submit := journal.SubmitWithFields
+	if cfg.Submitter != nil {
+		submit = cfg.Submitter.SubmitWithFields
+	}
+
+	return &Server{
+		cfg:     cfg,
+		submit:  submit,
+		closers: map[io.Closer]struct{}{},
+	}
+}
+
+// ListenAndServe listens on a "udp", "tcp", "unix" or "unixgram" address
+// and serves it until the server is closed
+func (s *Server) ListenAndServe(network, address string) error {
+
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		conn, err := net.ListenPacket(network, address)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		return s.ServePacket(conn)
+	case "tcp", "tcp4", "tcp6", "unix":
+		l, err := net.Listen(network, address)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		return s.Serve(l)
+	default:
+		return fmt.Errorf("unsupported network '%s'", network)
+	}
+}
+
+// ServePacket receives a message per datagram on conn until the server
+// is closed. conn is closed when done.
+func (s *Server) ServePacket(conn net.PacketConn) error {
+
+	if !s.track(conn) {
+		conn.Close()
+		return ErrServerClosed
+	}
+
+	defer s.untrack(conn)
+
+	buf := make([]byte, s.cfg.MaxMessageSize)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return fmt.Errorf("failed to receive message: %w", err)
+		}
+
+		s.handle(buf[:n], sourceHost(addr))
+	}
+}
+
+// Serve accepts connections on l and receives messages on them until the
+// server is closed. l and the connections are closed when done.
+func (s *Server) Serve(l net.Listener) error {
+
+	if !s.track(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+
+	defer s.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+
+			if err := s.serveConn(conn); err != nil && !s.isClosed() {
+				s.cfg.OnError(err)
+			}
+		}()
+	}
+}
+
+// Close stops the server, closing all listeners and connections, and
+// waits for connections being served to finish
+func (s *Server) Close() error {
+
+	s.mutex.Lock()
+
+	s.closed = true
+
+	for c := range s.closers {
+		c.Close()
+	}
+
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+
+	return nil
+}
+
+// serveConn reads messages from a stream connection until it's closed
+func (s *Server) serveConn(conn net.Conn) error {
+
+	source := sourceHost(conn.RemoteAddr())
+	r := bufio.NewReader(conn)
+
+	for {
+		msg, err := s.readFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive message from '%s': %w", conn.RemoteAddr(), err)
+		}
+
+		if len(msg) > 0 {
+			s.handle(msg, source)
+		}
+	}
+}
+
+// readFrame reads a message that is either octet counted, i.e. starts
+// with its length, or terminated by a newline or NUL
+func (s *Server) readFrame(r *bufio.Reader) ([]byte, error) {
+
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if c < '1' || c > '9' {
+		r.UnreadByte()
+		return s.readLine(r)
+	}
+
+	n := int(c - '0')
+
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if c == ' ' {
+			break
+		}
+		if c < '0' || c > '9' || n > (1<<31)/10 {
+			return nil, errors.New("invalid message length")
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	size := n
+	if size > s.cfg.MaxMessageSize {
+		size = s.cfg.MaxMessageSize
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	// Skip what's truncated
+	if _, err := r.Discard(n - size); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return msg, nil
+}
+
+// readLine reads a message terminated by a newline or NUL, truncated to
+// the maximum size
+func (s *Server) readLine(r *bufio.Reader) ([]byte, error) {
+
+	var msg []byte
+
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && len(msg) > 0 {
+			return msg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if c == '\n' || c == 0 {
+			return msg, nil
+		}
+
+		if len(msg) < s.cfg.MaxMessageSize {
+			msg = append(msg, c)
+		}
+	}
+}
+
+// handle parses a message and submits it to the journal
+func (s *Server) handle(raw []byte, source string) {
+
+	m, err := Parse(raw)
+	if err != nil {
+		s.cfg.OnError(fmt.Errorf("failed to parse message from '%s': %w", source, err))
+		return
+	}
+
+	f := journal.Fields{
+		journal.FieldSyslogFacility: strconv.Itoa(int(m.Facility)),
+		journal.FieldSyslogRaw:      string(trimMessage(raw)),
+	}
+
+	if m.AppName != "" {
+		f[journal.FieldSyslogIdentifier] = m.AppName
+	}
+	if m.ProcID != "" {
+		f[journal.FieldSyslogPID] = m.ProcID
+	}
+	if m.TimestampText != "" {
+		f[journal.FieldSyslogTimestamp] = m.TimestampText
+	}
+	if m.Hostname != "" {
+		f[FieldHostname] = m.Hostname
+	}
+	if source != "" {
+		f[FieldSourceHost] = source
+	}
+
+	if err := s.submit(m.Priority, m.Message, f); err != nil {
+		s.cfg.OnError(fmt.Errorf("failed to submit message from '%s': %w", source, err))
+	}
+}
+
+// track adds a listener or connection to be closed by Close and returns
+// false if the server is already closed
+func (s *Server) track(c io.Closer) bool {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.closers[c] = struct{}{}
+
+	return true
+}
+
+func (s *Server) untrack(c io.Closer) {
+
+	s.mutex.Lock()
+	delete(s.closers, c)
+	s.mutex.Unlock()
+
+	c.Close()
+}
+
+func (s *Server) isClosed() bool {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+// sourceHost returns the IP address of a network address, or an empty
+// string for unix socket addresses
+func sourceHost(addr net.Addr) string {
+
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	default:
+		return ""
+	}
+}
+
+func unexpectedEOF(err error) error {
+
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,376 @@
+// +build linux
+
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	journal "github.com/vargspjut/systemd-journal"
+)
+
+type submitted struct {
+	p journal.Priority
+	m string
+	f journal.Fields
+}
+
+// chanSubmitter passes the entries submitted to a channel
+type chanSubmitter chan submitted
+
+func (c chanSubmitter) Submit(p journal.Priority, m string) error {
+	return c.SubmitWithFields(p, m, nil)
+}
+
+func (c chanSubmitter) SubmitWithFields(p journal.Priority, m string, f journal.Fields) error {
+	c <- submitted{p, m, f}
+	return nil
+}
+
+func (c chanSubmitter) next(t *testing.T) submitted {
+
+	t.Helper()
+
+	select {
+	case s := <-c:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return submitted{}
+	}
+}
+
+// startServer serves network on a new Server, returning the address to
+// send to along with a function closing the server
+func startServer(t *testing.T, network string, cfg ServerConfig) (string, func()) {
+
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(cfg)
+	errs := make(chan error, 1)
+
+	var address string
+
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		address = conn.LocalAddr().String()
+		go func() { errs <- s.ServePacket(conn) }()
+	case "tcp":
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		address = l.Addr().String()
+		go func() { errs <- s.Serve(l) }()
+	default:
+		address = filepath.Join(dir, "log")
+		go func() { errs <- s.ListenAndServe(network, address) }()
+
+		// Wait for the socket to be created
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := os.Stat(address); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for socket")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return address, func() {
+		s.Close()
+		if err := <-errs; err != ErrServerClosed {
+			t.Errorf("expected ErrServerClosed, got %v", err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServerListeners(t *testing.T) {
+
+	tests := []struct {
+		network string
+		source  string
+	}{
+		{"udp", "127.0.0.1"},
+		{"tcp", "127.0.0.1"},
+		{"unix", ""},
+		{"unixgram", ""},
+	}
+
+	const msg = "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 - An application event"
+
+	for _, test := range tests {
+		t.Run(test.network, func(t *testing.T) {
+			sub := make(chanSubmitter, 10)
+
+			address, stop := startServer(t, test.network, ServerConfig{Submitter: sub})
+			defer stop()
+
+			conn, err := net.Dial(test.network, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			// Stream sockets are framed by a newline
+			if _, err := conn.Write([]byte(msg + "\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			s := sub.next(t)
+
+			if s.p != journal.PriorityNotice || s.m != "An application event" {
+				t.Errorf("unexpected entry %v %q", s.p, s.m)
+			}
+			if s.f[FieldSourceHost] != test.source {
+				t.Errorf("expected %s=%q, got %q", FieldSourceHost, test.source, s.f[FieldSourceHost])
+			}
+			if _, ok := s.f[FieldSourceHost]; ok != (test.source != "") {
+				t.Errorf("unexpected presence of %s", FieldSourceHost)
+			}
+		})
+	}
+}
+
+func TestServerFields(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		raw      string
+		priority journal.Priority
+		message  string
+		fields   journal.Fields
+	}{
+		{
+			name:     "rfc5424",
+			raw:      "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 - An application event\n",
+			priority: journal.PriorityNotice,
+			message:  "An application event",
+			fields: journal.Fields{
+				journal.FieldSyslogFacility:   "20",
+				journal.FieldSyslogIdentifier: "evntslog",
+				journal.FieldSyslogPID:        "1234",
+				journal.FieldSyslogTimestamp:  "2003-10-11T22:14:15.003Z",
+				journal.FieldSyslogRaw:        "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 - An application event",
+				FieldHostname:                 "mymachine.example.com",
+				FieldSourceHost:               "192.0.2.1",
+			},
+		},
+		{
+			name:     "rfc5424 nil values",
+			raw:      "<14>1 - - - - - - Hello",
+			priority: journal.PriorityInfo,
+			message:  "Hello",
+			fields: journal.Fields{
+				journal.FieldSyslogFacility: "1",
+				journal.FieldSyslogRaw:      "<14>1 - - - - - - Hello",
+				FieldSourceHost:             "192.0.2.1",
+			},
+		},
+		{
+			name:     "rfc3164",
+			raw:      "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed\x00",
+			priority: journal.PriorityCritical,
+			message:  "'su root' failed",
+			fields: journal.Fields{
+				journal.FieldSyslogFacility:   "4",
+				journal.FieldSyslogIdentifier: "su",
+				journal.FieldSyslogPID:        "123",
+				journal.FieldSyslogTimestamp:  "Oct 11 22:14:15",
+				journal.FieldSyslogRaw:        "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed",
+				FieldHostname:                 "mymachine",
+				FieldSourceHost:               "192.0.2.1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		sub := make(chanSubmitter, 1)
+		s := NewServer(ServerConfig{Submitter: sub})
+
+		s.handle([]byte(test.raw), "192.0.2.1")
+
+		got := sub.next(t)
+
+		if got.p != test.priority || got.m != test.message {
+			t.Errorf("%s: expected %v %q, got %v %q", test.name, test.priority, test.message, got.p, got.m)
+		}
+
+		if len(got.f) != len(test.fields) {
+			t.Errorf("%s: expected fields %v, got %v", test.name, test.fields, got.f)
+			continue
+		}
+		for k, v := range test.fields {
+			if got.f[k] != v {
+				t.Errorf("%s: expected %s=%q, got %q", test.name, k, v, got.f[k])
+			}
+		}
+	}
+}
+
+func TestServerReadFrame(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		stream string
+		frames []string
+		err    bool
+	}{
+		{"newline", "<14>a\n<14>b\n", []string{"<14>a", "<14>b"}, false},
+		{"nul", "<14>a\x00<14>b\x00", []string{"<14>a", "<14>b"}, false},
+		{"unterminated", "<14>a\n<14>b", []string{"<14>a", "<14>b"}, false},
+		{"octet counted", "5 <14>a5 <14>b", []string{"<14>a", "<14>b"}, false},
+		{"octet counted with newline", "6 <14>a\n", []string{"<14>a\n"}, false},
+		{"mixed", "5 <14>a<14>b\n5 <14>c", []string{"<14>a", "<14>b", "<14>c"}, false},
+		{"empty lines", "\n\n<14>a\n", []string{"", "", "<14>a"}, false},
+		{"truncated newline", "<14>abcdefghij\n<14>b\n", []string{"<14>abcde", "<14>b"}, false},
+		{"truncated octet counted", "14 <14>abcdefghij<14>b\n", []string{"<14>abcde", "<14>b"}, false},
+		{"invalid length", "5x <14>a", nil, true},
+		{"short octet counted", "10 <14>a", nil, true},
+		{"missing length end", "12", nil, true},
+	}
+
+	for _, test := range tests {
+		s := NewServer(ServerConfig{MaxMessageSize: 9})
+		r := bufio.NewReader(strings.NewReader(test.stream))
+
+		var (
+			frames []string
+			err    error
+		)
+
+		for {
+			var b []byte
+			if b, err = s.readFrame(r); err != nil {
+				break
+			}
+			frames = append(frames, string(b))
+		}
+
+		if strings.Join(frames, "|") != strings.Join(test.frames, "|") {
+			t.Errorf("%s: expected frames %q, got %q", test.name, test.frames, frames)
+		}
+		if failed := err != io.EOF; failed != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestServerTruncate(t *testing.T) {
+
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			sub := make(chanSubmitter, 10)
+
+			address, stop := startServer(t, network, ServerConfig{
+				Submitter:      sub,
+				MaxMessageSize: 20,
+			})
+			defer stop()
+
+			conn, err := net.Dial(network, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			msg := "<14>1 - - - - - - " + strings.Repeat("x", 100)
+			if network == "tcp" {
+				// The remainder of an octet counted message is skipped
+				msg = "118 " + msg + "<14>next\n"
+			}
+
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+
+			if s := sub.next(t); s.m != "xx" {
+				t.Errorf("expected truncated message %q, got %q", "xx", s.m)
+			}
+
+			if network == "tcp" {
+				if s := sub.next(t); s.m != "next" {
+					t.Errorf("expected message %q, got %q", "next", s.m)
+				}
+			}
+		})
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+
+	var (
+		errs  []error
+		mutex sync.Mutex
+	)
+
+	failed := errors.New("failed")
+
+	s := NewServer(ServerConfig{
+		Submitter: failSubmitter{failed},
+		OnError: func(err error) {
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		},
+	})
+
+	s.handle([]byte("<999>1 - - - - - - Hello"), "192.0.2.1")
+	s.handle([]byte("<14>1 - - - - - - Hello"), "192.0.2.1")
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	if !errors.Is(errs[1], failed) {
+		t.Errorf("expected submit error, got %v", errs[1])
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Serving after closing fails
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(l); err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got %v", err)
+	}
+
+	if err := s.ListenAndServe("sctp", "127.0.0.1:0"); err == nil {
+		t.Error("expected error for unsupported network")
+	}
+}
+
+// failSubmitter fails every submission
+type failSubmitter struct {
+	err error
+}
+
+func (f failSubmitter) Submit(journal.Priority, string) error { return f.err }
+
+func (f failSubmitter) SubmitWithFields(journal.Priority, string, journal.Fields) error {
+	return f.err
+}
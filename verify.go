@@ -0,0 +1,454 @@
+// +build linux
+
+package journal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Minimum size of each object type, object header included
+var objectMinSizes = map[uint8]uint64{
+	objectData:           64,
+	objectField:          40,
+	objectEntry:          64,
+	objectDataHashTable:  objectHeaderSize,
+	objectFieldHashTable: objectHeaderSize,
+	objectEntryArray:     24,
+	objectTag:            64,
+}
+
+// Object flags telling how the payload of a data object is compressed
+const (
+	objectCompressedXZ   = 1 << 0
+	objectCompressedLZ4  = 1 << 1
+	objectCompressedZSTD = 1 << 2
+)
+
+// VerifyError describes the first inconsistency found by Verify
+type VerifyError struct {
+	// Offset of the object found inconsistent, or 0 for the file header
+	Offset uint64
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Offset == 0 {
+		return "journal file header: " + e.Reason
+	}
+
+	return fmt.Sprintf("journal file object at offset %d: %s", e.Offset, e.Reason)
+}
+
+// fileVerifier holds the state of a journal file verification
+type fileVerifier struct {
+	r       io.ReaderAt
+	h       *FileHeader
+	compact bool
+	// Type of the object at each offset and number of objects per type
+	objects map[uint64]uint8
+	counts  map[uint8]uint64
+	entries []uint64
+}
+
+// Verify checks the structural consistency of a journal file. It walks
+// all objects checking their types, sizes and the object counts of the
+// header, follows the data and field hash chains and checks that entries
+// and entry arrays only reference objects of the right type. Sealed files
+// are verified without checking their tags. A *VerifyError is returned
+// for the first inconsistency found.
+// NOTE: Files being written to (online) may fail verification.
+func Verify(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open journal file: %w", err)
+	}
+
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat journal file: %w", err)
+	}
+
+	h, err := readFileHeader(f)
+	if err != nil {
+		return &VerifyError{Reason: err.Error()}
+	}
+
+	v := &fileVerifier{
+		r:       f,
+		h:       h,
+		compact: h.IncompatibleFlags&FileCompact != 0,
+		objects: map[uint64]uint8{},
+		counts:  map[uint8]uint64{},
+	}
+
+	checks := []func() error{
+		func() error { return v.checkHeader(uint64(st.Size())) },
+		v.checkObjects,
+		func() error { return v.checkHashTable(h.DataHashTableOffset, h.DataHashTableSize, objectData) },
+		func() error { return v.checkHashTable(h.FieldHashTableOffset, h.FieldHashTableSize, objectField) },
+		v.checkEntries,
+		v.checkEntryArrays,
+	}
+
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *fileVerifier) checkHeader(fileSize uint64) error {
+
+	h := v.h
+
+	if h.HeaderSize%8 != 0 {
+		return &VerifyError{Reason: fmt.Sprintf("header size %d not 8 byte aligned", h.HeaderSize)}
+	}
+
+	if h.HeaderSize+h.ArenaSize > fileSize {
+		return &VerifyError{Reason: fmt.Sprintf("arena ends at %d beyond end of file at %d",
+			h.HeaderSize+h.ArenaSize, fileSize)}
+	}
+
+	known := FileCompressedXZ | FileCompressedLZ4 | FileKeyedHash | FileCompressedZSTD | FileCompact
+	if h.IncompatibleFlags&^known != 0 {
+		return &VerifyError{Reason: fmt.Sprintf("unknown incompatible flags %x", h.IncompatibleFlags&^known)}
+	}
+
+	if h.State > FileArchived {
+		return &VerifyError{Reason: fmt.Sprintf("invalid state %d", h.State)}
+	}
+
+	if h.NEntries > 0 && h.HeadEntrySeqnum > h.TailEntrySeqnum {
+		return &VerifyError{Reason: fmt.Sprintf("head sequence number %d after tail sequence number %d",
+			h.HeadEntrySeqnum, h.TailEntrySeqnum)}
+	}
+
+	if h.TailObjectOffset != 0 &&
+		(h.TailObjectOffset < h.HeaderSize || h.TailObjectOffset >= h.HeaderSize+h.ArenaSize) {
+		return &VerifyError{Reason: fmt.Sprintf("tail object offset %d outside arena", h.TailObjectOffset)}
+	}
+
+	return nil
+}
+
+// checkObjects walks all objects and checks them against the header
+func (v *fileVerifier) checkObjects() error {
+
+	h := v.h
+
+	var (
+		counts     = v.counts
+		total      uint64
+		lastSeqnum uint64
+		last       uint64
+	)
+
+	allowedCompression := uint8(0)
+	if h.IncompatibleFlags&FileCompressedXZ != 0 {
+		allowedCompression |= objectCompressedXZ
+	}
+	if h.IncompatibleFlags&FileCompressedLZ4 != 0 {
+		allowedCompression |= objectCompressedLZ4
+	}
+	if h.IncompatibleFlags&FileCompressedZSTD != 0 {
+		allowedCompression |= objectCompressedZSTD
+	}
+
+	err := walkObjects(v.r, h, func(offset uint64, typ uint8, prefix []byte) error {
+
+		min, ok := objectMinSizes[typ]
+		if !ok {
+			return &VerifyError{Offset: offset, Reason: fmt.Sprintf("invalid object type %d", typ)}
+		}
+
+		if typ == objectData && v.compact {
+			min += 8
+		}
+
+		size := binary.LittleEndian.Uint64(prefix[8:])
+		if size < min {
+			return &VerifyError{Offset: offset, Reason: fmt.Sprintf("object of type %d too small (%d bytes)", typ, size)}
+		}
+
+		flags := prefix[1]
+		if flags != 0 && (typ != objectData || flags&^allowedCompression != 0) {
+			return &VerifyError{Offset: offset, Reason: fmt.Sprintf("invalid object flags %x", flags)}
+		}
+
+		if typ == objectEntry {
+			seqnum := binary.LittleEndian.Uint64(prefix[16:])
+			if seqnum < h.HeadEntrySeqnum || seqnum > h.TailEntrySeqnum {
+				return &VerifyError{Offset: offset, Reason: fmt.Sprintf("entry sequence number %d outside of %d-%d",
+					seqnum, h.HeadEntrySeqnum, h.TailEntrySeqnum)}
+			}
+			if seqnum <= lastSeqnum {
+				return &VerifyError{Offset: offset, Reason: fmt.Sprintf("entry sequence number %d not increasing", seqnum)}
+			}
+			lastSeqnum = seqnum
+			v.entries = append(v.entries, offset)
+		}
+
+		v.objects[offset] = typ
+		counts[typ]++
+		total++
+		last = offset
+
+		return nil
+	})
+
+	if err != nil {
+		if _, ok := err.(*VerifyError); ok {
+			return err
+		}
+		return &VerifyError{Offset: last, Reason: err.Error()}
+	}
+
+	if last != h.TailObjectOffset {
+		return &VerifyError{Offset: last, Reason: fmt.Sprintf("last object not the tail object at %d", h.TailObjectOffset)}
+	}
+
+	expected := []struct {
+		what   string
+		got    uint64
+		header uint64
+		valid  bool
+	}{
+		{"objects", total, h.NObjects, true},
+		{"entry objects", counts[objectEntry], h.NEntries, true},
+		{"data objects", counts[objectData], h.NData, h.HeaderSize >= 224},
+		{"field objects", counts[objectField], h.NFields, h.HeaderSize >= 224},
+		{"tag objects", counts[objectTag], h.NTags, h.HeaderSize >= 240},
+		{"entry array objects", counts[objectEntryArray], h.NEntryArrays, h.HeaderSize >= 240},
+	}
+
+	for _, e := range expected {
+		if e.valid && e.got != e.header {
+			return &VerifyError{Reason: fmt.Sprintf("header claims %d %s but file has %d", e.header, e.what, e.got)}
+		}
+	}
+
+	return nil
+}
+
+// checkHashTable follows every hash chain of a data or field hash table
+func (v *fileVerifier) checkHashTable(offset, size uint64, typ uint8) error {
+
+	if size == 0 {
+		return nil
+	}
+
+	// Number of objects expected in the table, as walked by checkObjects.
+	// The counts in the header are only present if the header is at least
+	// 224 bytes, and have been checked against these when present.
+	n := v.counts[typ]
+
+	tableType := objectDataHashTable
+	if typ == objectField {
+		tableType = objectFieldHashTable
+	}
+
+	// Hash table offsets point past the object header
+	if v.objects[offset-objectHeaderSize] != tableType || size%hashItemSize != 0 {
+		return &VerifyError{Reason: fmt.Sprintf("invalid hash table at offset %d", offset)}
+	}
+
+	table := make([]byte, size)
+	if _, err := v.r.ReadAt(table, int64(offset)); err != nil {
+		return &VerifyError{Offset: offset - objectHeaderSize, Reason: err.Error()}
+	}
+
+	buckets := size / hashItemSize
+	le := binary.LittleEndian
+
+	var chained uint64
+
+	for b := uint64(0); b < buckets; b++ {
+		head := le.Uint64(table[b*hashItemSize:])
+		tail := le.Uint64(table[b*hashItemSize+8:])
+
+		var last uint64
+
+		for p := head; p != 0; {
+			if v.objects[p] != typ {
+				return &VerifyError{Offset: p, Reason: fmt.Sprintf("hash chain of bucket %d references object of wrong type", b)}
+			}
+
+			prefix, err := v.readPrefix(p)
+			if err != nil {
+				return err
+			}
+
+			if hash := le.Uint64(prefix[16:]); hash%buckets != b {
+				return &VerifyError{Offset: p, Reason: fmt.Sprintf("object with hash %x in wrong bucket %d", hash, b)}
+			}
+
+			if typ == objectData {
+				if e := le.Uint64(prefix[40:]); e != 0 && v.objects[e] != objectEntry {
+					return &VerifyError{Offset: p, Reason: fmt.Sprintf("data object references invalid entry at %d", e)}
+				}
+				if a := le.Uint64(prefix[48:]); a != 0 && v.objects[a] != objectEntryArray {
+					return &VerifyError{Offset: p, Reason: fmt.Sprintf("data object references invalid entry array at %d", a)}
+				}
+			}
+
+			chained++
+			if chained > n {
+				return &VerifyError{Offset: p, Reason: "hash chain loop"}
+			}
+
+			last = p
+			p = le.Uint64(prefix[24:])
+		}
+
+		if last != tail {
+			return &VerifyError{Offset: offset - objectHeaderSize,
+				Reason: fmt.Sprintf("tail of hash chain of bucket %d is %d but chain ends at %d", b, tail, last)}
+		}
+	}
+
+	if chained != n {
+		return &VerifyError{Offset: offset - objectHeaderSize,
+			Reason: fmt.Sprintf("hash table references %d objects but file has %d", chained, n)}
+	}
+
+	return nil
+}
+
+// checkEntries checks that all entry items reference data objects
+func (v *fileVerifier) checkEntries() error {
+
+	itemSize := uint64(16)
+	if v.compact {
+		itemSize = 4
+	}
+
+	for _, offset := range v.entries {
+		obj, err := v.readObject(offset)
+		if err != nil {
+			return err
+		}
+
+		items := obj[64:]
+		if uint64(len(items))%itemSize != 0 {
+			return &VerifyError{Offset: offset, Reason: "entry size not a multiple of item size"}
+		}
+
+		for i := uint64(0); i < uint64(len(items)); i += itemSize {
+			var p uint64
+			if v.compact {
+				p = uint64(binary.LittleEndian.Uint32(items[i:]))
+			} else {
+				p = binary.LittleEndian.Uint64(items[i:])
+			}
+
+			if v.objects[p] != objectData {
+				return &VerifyError{Offset: offset, Reason: fmt.Sprintf("entry item references invalid data object at %d", p)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkEntryArrays follows the chain of entry arrays from the header
+// and checks that it references every entry in order
+func (v *fileVerifier) checkEntryArrays() error {
+
+	itemSize := uint64(8)
+	if v.compact {
+		itemSize = 4
+	}
+
+	var (
+		n      uint64
+		arrays uint64
+		last   uint64
+	)
+
+	for p := v.h.EntryArrayOffset; p != 0; {
+		if v.objects[p] != objectEntryArray {
+			return &VerifyError{Offset: p, Reason: "entry array chain references object of wrong type"}
+		}
+
+		arrays++
+		if arrays > v.h.NEntryArrays && v.h.HeaderSize >= 240 {
+			return &VerifyError{Offset: p, Reason: "entry array chain loop"}
+		}
+
+		obj, err := v.readObject(p)
+		if err != nil {
+			return err
+		}
+
+		items := obj[24:]
+		for i := uint64(0); i+itemSize <= uint64(len(items)); i += itemSize {
+			var e uint64
+			if v.compact {
+				e = uint64(binary.LittleEndian.Uint32(items[i:]))
+			} else {
+				e = binary.LittleEndian.Uint64(items[i:])
+			}
+
+			if e == 0 {
+				// Unused trailing items
+				break
+			}
+
+			if v.objects[e] != objectEntry {
+				return &VerifyError{Offset: p, Reason: fmt.Sprintf("entry array references invalid entry at %d", e)}
+			}
+			if e <= last {
+				return &VerifyError{Offset: p, Reason: fmt.Sprintf("entry array references entry at %d out of order", e)}
+			}
+
+			last = e
+			n++
+		}
+
+		p = binary.LittleEndian.Uint64(obj[16:])
+	}
+
+	if n != v.h.NEntries {
+		return &VerifyError{Reason: fmt.Sprintf("entry arrays reference %d entries but header claims %d", n, v.h.NEntries)}
+	}
+
+	return nil
+}
+
+// readPrefix reads the leading bytes of the object at offset
+func (v *fileVerifier) readPrefix(offset uint64) ([]byte, error) {
+
+	prefix := make([]byte, objectPrefixSize)
+
+	n, err := v.r.ReadAt(prefix, int64(offset))
+	if n < objectPrefixSize && err != nil && err != io.EOF {
+		return nil, &VerifyError{Offset: offset, Reason: err.Error()}
+	}
+
+	return prefix[:n], nil
+}
+
+// readObject reads the complete object at offset
+func (v *fileVerifier) readObject(offset uint64) ([]byte, error) {
+
+	hdr := make([]byte, objectHeaderSize)
+	if _, err := v.r.ReadAt(hdr, int64(offset)); err != nil {
+		return nil, &VerifyError{Offset: offset, Reason: err.Error()}
+	}
+
+	obj := make([]byte, binary.LittleEndian.Uint64(hdr[8:]))
+	if _, err := v.r.ReadAt(obj, int64(offset)); err != nil {
+		return nil, &VerifyError{Offset: offset, Reason: err.Error()}
+	}
+
+	return obj, nil
+}
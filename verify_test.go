@@ -0,0 +1,161 @@
+// +build linux
+
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+
+	le := binary.LittleEndian
+
+	// firstEntry returns the offset of the first entry object of the file
+	firstEntry := func(buf []byte) uint64 {
+		array := le.Uint64(buf[176:])
+		return uint64(le.Uint32(buf[array+24:]))
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(buf []byte) []byte
+		// Part of the reason expected, none if the file is consistent
+		reason string
+	}{
+		{
+			name:    "consistent",
+			corrupt: func(buf []byte) []byte { return buf },
+		},
+		{
+			name: "state",
+			corrupt: func(buf []byte) []byte {
+				buf[16] = 7
+				return buf
+			},
+			reason: "invalid state",
+		},
+		{
+			name: "truncated",
+			corrupt: func(buf []byte) []byte {
+				return buf[:len(buf)/2]
+			},
+			reason: "beyond end of file",
+		},
+		{
+			name: "tail object",
+			corrupt: func(buf []byte) []byte {
+				le.PutUint64(buf[136:], uint64(len(buf)))
+				return buf
+			},
+			reason: "outside arena",
+		},
+		{
+			name: "object size",
+			corrupt: func(buf []byte) []byte {
+				le.PutUint64(buf[firstEntry(buf)+8:], objectHeaderSize)
+				return buf
+			},
+			reason: "too small",
+		},
+		{
+			name: "header counts",
+			corrupt: func(buf []byte) []byte {
+				le.PutUint64(buf[208:], le.Uint64(buf[208:])+1)
+				return buf
+			},
+			reason: "data objects",
+		},
+		{
+			name: "hash chain loop",
+			corrupt: func(buf []byte) []byte {
+				table := le.Uint64(buf[104:])
+				for b := table; ; b += hashItemSize {
+					if head := le.Uint64(buf[b:]); head != 0 {
+						le.PutUint64(buf[head+24:], head)
+						return buf
+					}
+				}
+			},
+			reason: "hash chain loop",
+		},
+		{
+			name: "entry item",
+			corrupt: func(buf []byte) []byte {
+				entry := firstEntry(buf)
+				le.PutUint32(buf[entry+64:], uint32(entry))
+				return buf
+			},
+			reason: "invalid data object",
+		},
+		{
+			// Files written before the object counts were added to the
+			// header. The bytes of the counts become an unreferenced entry
+			// array object at the start of the arena.
+			name: "header without counts",
+			corrupt: func(buf []byte) []byte {
+				le.PutUint64(buf[88:], 208)
+				le.PutUint64(buf[96:], le.Uint64(buf[96:])+56)
+				le.PutUint64(buf[144:], le.Uint64(buf[144:])+1)
+
+				array := buf[208:264]
+				for i := range array {
+					array[i] = 0
+				}
+				array[0] = objectEntryArray
+				le.PutUint64(array[8:], uint64(len(array)))
+
+				return buf
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, remove := fixture(t, "entries.journal")
+			defer remove()
+
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, test.corrupt(buf), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err = Verify(path)
+
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("expected file to verify, got %v", err)
+				}
+				return
+			}
+
+			var verr *VerifyError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *VerifyError, got %v", err)
+			}
+			if !strings.Contains(verr.Reason, test.reason) {
+				t.Errorf("expected reason containing %q, got %q", test.reason, verr.Reason)
+			}
+		})
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+
+	path, remove := fixture(b, "entries.journal")
+	defer remove()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := Verify(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}